@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -10,9 +11,14 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/auth"
 	"github.com/quckapp/media-service/internal/config"
 	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/events"
 	"github.com/quckapp/media-service/internal/handlers"
+	"github.com/quckapp/media-service/internal/kms"
+	"github.com/quckapp/media-service/internal/migrations"
+	"github.com/quckapp/media-service/internal/realtime"
 	"github.com/quckapp/media-service/internal/services"
 )
 
@@ -26,6 +32,19 @@ func main() {
 	}
 	defer mongoDB.Close()
 
+	// `media-service migrate [up|status]` runs migrations and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(mongoDB, os.Args[2:])
+		return
+	}
+	if cfg.MigrateOnStartup {
+		migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), 10*time.Minute)
+		if _, err := migrations.Run(migrateCtx, mongoDB); err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+		cancelMigrate()
+	}
+
 	// Initialize Redis
 	redisClient := database.NewRedis(cfg.RedisHost, cfg.RedisPort, cfg.RedisPassword, 7)
 	defer redisClient.Close()
@@ -35,145 +54,276 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to initialize S3: %v", err)
 	}
+	if cfg.KMSLocalFile != "" {
+		if cfg.ContentURLSecret == "" {
+			log.Fatalf("CONTENT_URL_SECRET is required for encryption at rest")
+		}
+		keys, err := kms.NewLocalKMS(cfg.KMSLocalFile)
+		if err != nil {
+			log.Fatalf("Failed to initialize KMS: %v", err)
+		}
+		s3Storage.EnableEncryption(keys, cfg.PublicURL, []byte(cfg.ContentURLSecret))
+	}
+
+	// Initialize token verification
+	verifier, err := auth.NewVerifier(auth.Config{
+		Secret:   cfg.JWTSecret,
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+		JWKSURL:  cfg.JWKSURL,
+		JWKSFile: cfg.JWKSFile,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize token verification: %v", err)
+	}
+
+	// Initialize event publishing
+	var broker events.Broker
+	switch cfg.EventBroker {
+	case "kafka":
+		broker = events.NewKafkaBroker(cfg.KafkaBrokers)
+	case "memory":
+		broker = events.NewMemoryBroker()
+	default:
+		log.Fatalf("Unknown EVENT_BROKER %q", cfg.EventBroker)
+	}
+	defer broker.Close()
+	publisher := events.NewPublisher(mongoDB, broker)
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	defer stopEvents()
+
+	// Live updates for connected clients, fanned out across replicas via Redis
+	hub := realtime.NewHub(redisClient)
+	go hub.Run(eventsCtx)
+	go verifier.Run(eventsCtx)
 
 	// ── Initialize Services ──
-	mediaService := services.NewMediaService(mongoDB, redisClient, s3Storage)
-	albumService := services.NewAlbumService(mongoDB)
-	tagService := services.NewTagService(mongoDB)
-	sharingService := services.NewSharingService(mongoDB)
-	versionService := services.NewVersionService(mongoDB, s3Storage)
-	trashService := services.NewTrashService(mongoDB, redisClient, s3Storage)
-	processingService := services.NewProcessingService(mongoDB)
+	auditor := services.NewAuditor(mongoDB, redisClient)
+	policy := services.NewAccessPolicy(mongoDB)
+	mediaService := services.NewMediaService(mongoDB, redisClient, s3Storage, auditor, publisher, hub)
+	albumService := services.NewAlbumService(mongoDB, auditor)
+	tagService := services.NewTagService(mongoDB, auditor)
+	sharingService := services.NewSharingService(mongoDB, s3Storage, auditor, publisher)
+	versionService := services.NewVersionService(mongoDB, s3Storage, auditor)
+	trashService := services.NewTrashService(mongoDB, redisClient, s3Storage, auditor, publisher)
+	processingService := services.NewProcessingService(mongoDB, publisher, hub)
 	favoriteService := services.NewFavoriteService(mongoDB)
-	commentService := services.NewCommentService(mongoDB)
-	activityService := services.NewActivityService(mongoDB)
+	commentService := services.NewCommentService(mongoDB, hub)
+	activityService := services.NewActivityService(mongoDB, redisClient, auditor)
 	searchService := services.NewSearchService(mongoDB, s3Storage)
 	retentionService := services.NewRetentionService(mongoDB)
 	quotaService := services.NewQuotaService(mongoDB)
 	watermarkService := services.NewWatermarkService(mongoDB)
-	scanningService := services.NewScanningService(mongoDB)
-	analyticsService := services.NewAnalyticsService(mongoDB)
+	scanningService := services.NewScanningService(mongoDB, publisher, hub)
+	analyticsService := services.NewAnalyticsService(mongoDB, redisClient, auditor)
 	galleryService := services.NewGalleryService(mongoDB)
+	savedSearchService := services.NewSavedSearchService(mongoDB, searchService)
+	chargebackService, err := services.NewChargebackService(mongoDB, cfg.ChargebackPricing)
+	if err != nil {
+		log.Fatalf("Failed to initialize chargeback: %v", err)
+	}
+	auditLogService, err := services.NewAuditLogService(mongoDB, cfg.AuditSigningKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize audit log: %v", err)
+	}
+	cleanupService, err := services.NewCleanupService(mongoDB, mediaService, trashService, services.CleanupPolicies{
+		Channel:    cfg.CleanupChannelPolicy,
+		Workspace:  cfg.CleanupWorkspacePolicy,
+		User:       cfg.CleanupUserPolicy,
+		ReassignTo: cfg.CleanupReassignTo,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize cleanup: %v", err)
+	}
+	webhookService := services.NewWebhookService(mongoDB, policy, cfg.WebhookAllowPrivate)
+	realtimeService := services.NewRealtimeService(hub, policy)
+	archiveService := services.NewArchiveService(mongoDB, s3Storage, policy, searchService, processingService, analyticsService)
+	apiKeyService := services.NewAPIKeyService(mongoDB)
+	encryptionService := services.NewEncryptionService(mongoDB, s3Storage)
+
+	// Sinks must be registered before the relay starts
+	publisher.AddSink(webhookService.Sink)
+	go publisher.Run(eventsCtx)
+	go webhookService.Run(eventsCtx)
+
+	// Consume deletions from the chat and account services
+	if cfg.EventBroker == "kafka" {
+		consumer := events.NewKafkaConsumer(mongoDB, cleanupService.HandleEvent, cfg.KafkaBrokers, cfg.ConsumerGroup, []string{
+			events.Topic(events.ChannelDeleted),
+			events.Topic(events.WorkspaceDeleted),
+			events.Topic(events.UserDeleted),
+		})
+		defer consumer.Close()
+		go consumer.Run(eventsCtx)
+	}
 
 	// ── Initialize Handlers ──
-	mediaHandler := handlers.NewMediaHandler(mediaService)
-	albumHandler := handlers.NewAlbumHandler(albumService)
-	tagHandler := handlers.NewTagHandler(tagService)
-	sharingHandler := handlers.NewSharingHandler(sharingService)
+	mediaHandler := handlers.NewMediaHandler(mediaService, analyticsService, policy)
+	albumHandler := handlers.NewAlbumHandler(albumService, policy)
+	tagHandler := handlers.NewTagHandler(tagService, policy)
+	sharingHandler := handlers.NewSharingHandler(sharingService, policy)
 	versionHandler := handlers.NewVersionHandler(versionService)
 	trashHandler := handlers.NewTrashHandler(trashService)
-	processingHandler := handlers.NewProcessingHandler(processingService)
+	processingHandler := handlers.NewProcessingHandler(processingService, policy)
 	favoriteHandler := handlers.NewFavoriteHandler(favoriteService)
 	commentHandler := handlers.NewCommentHandler(commentService)
 	activityHandler := handlers.NewActivityHandler(activityService)
-	searchHandler := handlers.NewSearchHandler(searchService, mediaService)
+	searchHandler := handlers.NewSearchHandler(searchService, mediaService, analyticsService, policy)
 	healthHandler := handlers.NewHealthHandler(mongoDB, redisClient)
-	retentionHandler := handlers.NewRetentionHandler(retentionService)
+	retentionHandler := handlers.NewRetentionHandler(retentionService, policy)
 	quotaHandler := handlers.NewQuotaHandler(quotaService)
-	watermarkHandler := handlers.NewWatermarkHandler(watermarkService)
-	scanningHandler := handlers.NewScanningHandler(scanningService)
+	watermarkHandler := handlers.NewWatermarkHandler(watermarkService, policy)
+	scanningHandler := handlers.NewScanningHandler(scanningService, policy)
 	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService)
-	galleryHandler := handlers.NewGalleryHandler(galleryService)
+	galleryHandler := handlers.NewGalleryHandler(galleryService, policy)
+	savedSearchHandler := handlers.NewSavedSearchHandler(savedSearchService)
+	chargebackHandler := handlers.NewChargebackHandler(chargebackService)
+	auditHandler := handlers.NewAuditHandler(auditLogService)
+	webhookHandler := handlers.NewWebhookHandler(webhookService, policy)
+	realtimeHandler := handlers.NewRealtimeHandler(realtimeService)
+	archiveHandler := handlers.NewArchiveHandler(archiveService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	encryptionHandler := handlers.NewEncryptionHandler(encryptionService)
 
 	// Setup router
 	router := gin.Default()
+	// Client IPs come from X-Forwarded-For only when set by a trusted proxy
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	router.Use(gin.Recovery())
+	router.Use(handlers.RequestInfoMiddleware())
 
 	// Health endpoints
 	router.GET("/health", healthHandler.Health)
 	router.GET("/health/ready", healthHandler.Ready)
 
+	// Access checks
+	canView := handlers.RequireMediaAccess(policy, services.PermView)
+	canDownload := handlers.RequireMediaAccess(policy, services.PermDownload)
+	canEdit := handlers.RequireMediaAccess(policy, services.PermEdit)
+	isOwner := handlers.RequireMediaAccess(policy, services.PermOwner)
+	wsMember := handlers.RequireWorkspaceRole(policy, services.RoleMember)
+	wsAdmin := handlers.RequireWorkspaceRole(policy, services.RoleAdmin)
+	platformAdmin := handlers.RequirePlatformAdmin(policy)
+
+	// Rate limits; buckets live in Redis so they hold across replicas
+	var limiter *services.RateLimiter
+	if cfg.RateLimitEnabled {
+		limiter = services.NewRateLimiter(redisClient)
+	}
+	uploadLimit := handlers.RateLimit(limiter, "upload", services.RateLimit{Rate: 1, Burst: 30}, handlers.ByCaller)
+	// Archives read and repack every item, the most expensive thing to ask for
+	archiveLimit := handlers.RateLimit(limiter, "archive", services.RateLimit{Rate: 0.05, Burst: 5}, handlers.ByCaller)
+	searchLimit := handlers.RateLimit(limiter, "search", services.RateLimit{Rate: 2, Burst: 20}, handlers.ByCaller)
+	shareLinkLimit := handlers.RateLimit(limiter, "share-link", services.RateLimit{Rate: 0.2, Burst: 10}, handlers.ByCaller)
+	sharedLimit := handlers.RateLimit(limiter, "shared", services.RateLimit{Rate: 1, Burst: 30}, handlers.ByIP)
+	// A shared album's listing is followed by a preview fetch per image
+	previewLimit := handlers.RateLimit(limiter, "shared-preview", services.RateLimit{Rate: 5, Burst: 100}, handlers.ByIP)
+	workspaceLimit := handlers.RateLimit(limiter, "workspace", services.RateLimit{Rate: 20, Burst: 100}, handlers.ByWorkspace)
+
 	// API routes
 	api := router.Group("/api/v1/media")
-	api.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	api.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		// ── Upload ──
-		api.POST("/upload", mediaHandler.Upload)
-		api.POST("/upload/presigned", mediaHandler.GetPresignedURL)
+		api.POST("/upload", uploadLimit, mediaHandler.Upload)
+		api.POST("/upload/presigned", uploadLimit, mediaHandler.GetPresignedURL)
 
 		// ── Bulk Operations ──
 		api.POST("/bulk-delete", mediaHandler.BulkDelete)
 		api.POST("/bulk-move", searchHandler.BulkMove)
 		api.POST("/bulk-tag", tagHandler.BulkTag)
+		api.POST("/archive", archiveLimit, archiveHandler.Create)
 
 		// ── Search & Discovery ──
-		api.GET("/search", searchHandler.Search)
+		api.GET("/search", searchLimit, searchHandler.Search)
 		api.GET("/recent", searchHandler.GetRecent)
 		api.GET("/duplicates", searchHandler.GetDuplicates)
 
 		// ── Single Media Operations ──
-		api.GET("/:id", mediaHandler.Get)
-		api.DELETE("/:id", mediaHandler.Delete)
-		api.PUT("/:id/metadata", mediaHandler.UpdateMetadata)
-		api.POST("/:id/thumbnail", mediaHandler.GenerateThumbnail)
-		api.PUT("/:id/rename", searchHandler.Rename)
-		api.POST("/:id/copy", searchHandler.CopyMedia)
-		api.POST("/:id/move", searchHandler.MoveMedia)
-		api.GET("/:id/download-url", searchHandler.GetDownloadURL)
+		api.GET("/:id", canView, mediaHandler.Get)
+		api.DELETE("/:id", isOwner, mediaHandler.Delete)
+		api.PUT("/:id/metadata", canEdit, mediaHandler.UpdateMetadata)
+		api.POST("/:id/thumbnail", canEdit, mediaHandler.GenerateThumbnail)
+		api.PUT("/:id/rename", canEdit, searchHandler.Rename)
+		api.POST("/:id/copy", isOwner, searchHandler.CopyMedia)
+		api.POST("/:id/move", isOwner, searchHandler.MoveMedia)
+		api.GET("/:id/download-url", canDownload, searchHandler.GetDownloadURL)
+		api.GET("/:id/stream-url", canView, mediaHandler.GetStreamURL)
+		api.GET("/:id/usage", canView, analyticsHandler.GetMediaUsage)
 
 		// ── Tags on Media ──
-		api.POST("/:id/tags", tagHandler.TagMedia)
-		api.DELETE("/:id/tags/:tagId", tagHandler.UntagMedia)
-		api.GET("/:id/tags", tagHandler.GetMediaTags)
+		api.POST("/:id/tags", canEdit, tagHandler.TagMedia)
+		api.DELETE("/:id/tags/:tagId", canEdit, tagHandler.UntagMedia)
+		api.GET("/:id/tags", canView, tagHandler.GetMediaTags)
 
 		// ── Versions ──
-		api.POST("/:id/versions", versionHandler.CreateVersion)
-		api.GET("/:id/versions", versionHandler.GetVersions)
-		api.GET("/:id/versions/:versionId", versionHandler.GetVersion)
-		api.DELETE("/:id/versions/:versionId", versionHandler.DeleteVersion)
-		api.POST("/:id/versions/:versionId/restore", versionHandler.RestoreVersion)
+		api.POST("/:id/versions", uploadLimit, canEdit, versionHandler.CreateVersion)
+		api.GET("/:id/versions", canView, versionHandler.GetVersions)
+		api.GET("/:id/versions/:versionId", canView, versionHandler.GetVersion)
+		api.DELETE("/:id/versions/:versionId", canEdit, versionHandler.DeleteVersion)
+		api.POST("/:id/versions/:versionId/restore", canEdit, versionHandler.RestoreVersion)
 
 		// ── Trash (Soft Delete) ──
-		api.POST("/:id/trash", trashHandler.MoveToTrash)
+		api.POST("/:id/trash", isOwner, trashHandler.MoveToTrash)
 
 		// ── Processing Jobs ──
-		api.POST("/:id/process", processingHandler.CreateJob)
-		api.GET("/:id/jobs", processingHandler.GetJobsByMedia)
+		api.POST("/:id/process", canEdit, processingHandler.CreateJob)
+		api.GET("/:id/jobs", canView, processingHandler.GetJobsByMedia)
 
 		// ── Favorites ──
-		api.POST("/:id/favorite", favoriteHandler.AddFavorite)
-		api.DELETE("/:id/favorite", favoriteHandler.RemoveFavorite)
-		api.GET("/:id/favorite", favoriteHandler.IsFavorite)
+		api.POST("/:id/favorite", canView, favoriteHandler.AddFavorite)
+		api.DELETE("/:id/favorite", canView, favoriteHandler.RemoveFavorite)
+		api.GET("/:id/favorite", canView, favoriteHandler.IsFavorite)
 
 		// ── Comments ──
-		api.POST("/:id/comments", commentHandler.Create)
-		api.GET("/:id/comments", commentHandler.GetByMedia)
-		api.GET("/:id/comments/count", commentHandler.CountByMedia)
-		api.GET("/:id/comments/:commentId/replies", commentHandler.GetReplies)
-		api.PUT("/:id/comments/:commentId", commentHandler.Update)
-		api.DELETE("/:id/comments/:commentId", commentHandler.Delete)
+		api.POST("/:id/comments", canView, commentHandler.Create)
+		api.GET("/:id/comments", canView, commentHandler.GetByMedia)
+		api.GET("/:id/comments/count", canView, commentHandler.CountByMedia)
+		api.GET("/:id/comments/:commentId/replies", canView, commentHandler.GetReplies)
+		api.PUT("/:id/comments/:commentId", canView, commentHandler.Update)
+		api.DELETE("/:id/comments/:commentId", canView, commentHandler.Delete)
 
 		// ── Activity / Audit ──
-		api.GET("/:id/activity", activityHandler.GetByMedia)
+		api.GET("/:id/activity", canView, activityHandler.GetByMedia)
 
 		// ── Share Links ──
-		api.POST("/:id/share-links", sharingHandler.CreateShareLink)
-		api.GET("/:id/share-links", sharingHandler.GetShareLinks)
+		api.POST("/:id/share-links", shareLinkLimit, isOwner, sharingHandler.CreateShareLink)
+		api.GET("/:id/share-links", isOwner, sharingHandler.GetShareLinks)
 	}
 
 	// ── Sharing (User-Scoped) ──
 	shares := router.Group("/api/v1/media/shares")
-	shares.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	shares.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		shares.POST("", sharingHandler.ShareWithUser)
 		shares.GET("/received", sharingHandler.GetSharedWithMe)
+		shares.GET("/received/media", sharingHandler.GetSharedMediaWithMe)
 		shares.GET("/sent", sharingHandler.GetSharedByMe)
 		shares.DELETE("/:shareId", sharingHandler.RevokeShare)
 	}
 
 	// ── Public Share Link Access ──
-	router.GET("/api/v1/media/shared/:token", sharingHandler.GetShareLink)
-
-	// ── Share Link Deactivation ──
+	router.GET("/api/v1/media/shared/:token", sharedLimit, sharingHandler.GetShareLink)
+	router.POST("/api/v1/media/shared/:token/unlock", sharedLimit, sharingHandler.UnlockShareLink)
+	router.GET("/api/v1/media/shared/:token/view", sharedLimit, sharingHandler.ViewShareLink)
+	router.GET("/api/v1/media/shared/:token/download", sharedLimit, sharingHandler.DownloadShareLink)
+	router.GET("/api/v1/media/shared/:token/items/:mediaId/view", sharedLimit, sharingHandler.ViewShareLink)
+	router.GET("/api/v1/media/shared/:token/items/:mediaId/download", sharedLimit, sharingHandler.DownloadShareLink)
+	router.GET("/api/v1/media/shared/:token/items/:mediaId/preview", previewLimit, sharingHandler.PreviewShareLink)
+
+	// ── Share Link Management ──
 	shareLinks := router.Group("/api/v1/media/share-links")
-	shareLinks.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	shareLinks.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		shareLinks.DELETE("/:linkId", sharingHandler.DeactivateShareLink)
+		shareLinks.GET("/:linkId/access-log", sharingHandler.GetShareLinkAccessLog)
 	}
 
 	// ── Trash Management ──
 	trash := router.Group("/api/v1/media/trash")
-	trash.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	trash.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		trash.GET("", trashHandler.GetTrash)
 		trash.POST("/:trashId/restore", trashHandler.RestoreFromTrash)
@@ -183,7 +333,7 @@ func main() {
 
 	// ── Processing Jobs (User-Scoped) ──
 	jobs := router.Group("/api/v1/media/jobs")
-	jobs.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	jobs.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		jobs.GET("", processingHandler.GetUserJobs)
 		jobs.GET("/:jobId", processingHandler.GetJob)
@@ -192,7 +342,7 @@ func main() {
 
 	// ── Favorites (User-Scoped) ──
 	favorites := router.Group("/api/v1/media/favorites")
-	favorites.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	favorites.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		favorites.GET("", favoriteHandler.GetFavorites)
 		favorites.GET("/count", favoriteHandler.GetFavoriteCount)
@@ -200,19 +350,36 @@ func main() {
 
 	// ── Albums ──
 	albums := router.Group("/api/v1/media/albums")
-	albums.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	albums.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		albums.POST("", albumHandler.Create)
+		albums.GET("/smart", savedSearchHandler.ListSmartAlbums)
 		albums.GET("/:albumId", albumHandler.GetByID)
 		albums.PUT("/:albumId", albumHandler.Update)
 		albums.DELETE("/:albumId", albumHandler.Delete)
 		albums.POST("/:albumId/media", albumHandler.AddMedia)
 		albums.DELETE("/:albumId/media", albumHandler.RemoveMedia)
+		albums.POST("/:albumId/share-links", shareLinkLimit, sharingHandler.CreateAlbumShareLink)
+		albums.GET("/:albumId/share-links", sharingHandler.GetAlbumShareLinks)
+	}
+
+	// ── Saved Searches ──
+	savedSearches := router.Group("/api/v1/media/saved-searches")
+	savedSearches.Use(handlers.AuthMiddleware(verifier, apiKeyService))
+	{
+		savedSearches.POST("", savedSearchHandler.Create)
+		savedSearches.GET("", savedSearchHandler.List)
+		savedSearches.GET("/:searchId", savedSearchHandler.Get)
+		savedSearches.PUT("/:searchId", savedSearchHandler.Update)
+		savedSearches.DELETE("/:searchId", savedSearchHandler.Delete)
+		savedSearches.GET("/:searchId/run", searchLimit, savedSearchHandler.Run)
+		savedSearches.POST("/:searchId/pin", savedSearchHandler.Pin)
+		savedSearches.DELETE("/:searchId/pin", savedSearchHandler.Unpin)
 	}
 
 	// ── Tags (CRUD) ──
 	tags := router.Group("/api/v1/media/tags")
-	tags.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	tags.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		tags.POST("", tagHandler.Create)
 		tags.PUT("/:tagId", tagHandler.Update)
@@ -222,14 +389,16 @@ func main() {
 
 	// ── User Activity ──
 	userActivity := router.Group("/api/v1/media/activity")
-	userActivity.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	userActivity.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		userActivity.GET("", activityHandler.GetByUser)
+		userActivity.GET("/workspace/:workspaceId", wsMember, activityHandler.GetWorkspaceFeed)
+		userActivity.GET("/workspace/:workspaceId/stream", wsMember, activityHandler.StreamWorkspace)
 	}
 
 	// ── Query Endpoints ──
 	query := router.Group("/api/v1/media/user")
-	query.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	query.Use(handlers.AuthMiddleware(verifier, apiKeyService), handlers.RequireSelf(policy))
 	{
 		query.GET("/:userId", mediaHandler.GetUserMedia)
 		query.GET("/:userId/stats", mediaHandler.GetUserStats)
@@ -240,7 +409,7 @@ func main() {
 
 	// ── Workspace Endpoints ──
 	workspace := router.Group("/api/v1/media/workspace")
-	workspace.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	workspace.Use(handlers.AuthMiddleware(verifier, apiKeyService), wsMember, workspaceLimit)
 	{
 		workspace.GET("/:workspaceId", mediaHandler.GetWorkspaceMedia)
 		workspace.GET("/:workspaceId/stats", searchHandler.GetWorkspaceStats)
@@ -251,72 +420,133 @@ func main() {
 
 	// ── Channel Endpoints ──
 	channel := router.Group("/api/v1/media/channel")
-	channel.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	channel.Use(handlers.AuthMiddleware(verifier, apiKeyService), handlers.RequireChannelMember(policy))
 	{
 		channel.GET("/:channelId", mediaHandler.GetChannelMedia)
 	}
 
-	// ── Retention Policies ──
+	// ── Retention Policies (workspace admins) ──
 	retention := router.Group("/api/v1/media/retention")
-	retention.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	retention.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		retention.POST("", retentionHandler.Create)
 		retention.GET("/:policyId", retentionHandler.Get)
 		retention.PUT("/:policyId", retentionHandler.Update)
 		retention.DELETE("/:policyId", retentionHandler.Delete)
-		retention.GET("/workspace/:workspaceId", retentionHandler.GetByWorkspace)
+		retention.GET("/workspace/:workspaceId", wsMember, retentionHandler.GetByWorkspace)
 	}
 
-	// ── Storage Quotas ──
+	// ── Storage Quotas (set by platform admins) ──
 	quotas := router.Group("/api/v1/media/quotas")
-	quotas.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	quotas.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
-		quotas.GET("/:workspaceId", quotaHandler.GetQuota)
-		quotas.POST("", quotaHandler.SetQuota)
-		quotas.GET("/:workspaceId/usage", quotaHandler.GetUsage)
-		quotas.GET("/over-quota", quotaHandler.ListOverQuota)
+		quotas.GET("/:workspaceId", wsMember, quotaHandler.GetQuota)
+		quotas.POST("", platformAdmin, quotaHandler.SetQuota)
+		quotas.GET("/:workspaceId/usage", wsMember, quotaHandler.GetUsage)
+		quotas.GET("/over-quota", platformAdmin, quotaHandler.ListOverQuota)
 	}
 
-	// ── Watermarks ──
+	// ── Watermarks (uploaded by workspace admins) ──
 	watermarks := router.Group("/api/v1/media/watermarks")
-	watermarks.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	watermarks.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		watermarks.POST("", watermarkHandler.Upload)
-		watermarks.GET("/workspace/:workspaceId", watermarkHandler.List)
+		watermarks.GET("/workspace/:workspaceId", wsMember, watermarkHandler.List)
 		watermarks.POST("/apply", watermarkHandler.Apply)
-		watermarks.DELETE("/:mediaId", watermarkHandler.Remove)
-		watermarks.GET("/settings/:workspaceId", watermarkHandler.GetSettings)
+		watermarks.DELETE("/:mediaId", canEdit, watermarkHandler.Remove)
+		watermarks.GET("/settings/:workspaceId", wsMember, watermarkHandler.GetSettings)
 	}
 
-	// ── Media Scanning / Moderation ──
+	// ── Media Scanning / Moderation (moderated by platform admins) ──
 	scanning := router.Group("/api/v1/media/scanning")
-	scanning.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	scanning.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		scanning.POST("/scan", scanningHandler.ScanMedia)
-		scanning.GET("/:mediaId/results", scanningHandler.GetResults)
-		scanning.GET("/flagged", scanningHandler.ListFlagged)
-		scanning.PUT("/:scanId/status", scanningHandler.UpdateStatus)
+		scanning.GET("/:mediaId/results", canView, scanningHandler.GetResults)
+		scanning.GET("/flagged", platformAdmin, scanningHandler.ListFlagged)
+		scanning.PUT("/:scanId/status", platformAdmin, scanningHandler.UpdateStatus)
 	}
 
 	// ── Media Analytics ──
 	analytics := router.Group("/api/v1/media/analytics")
-	analytics.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	analytics.Use(handlers.AuthMiddleware(verifier, apiKeyService), wsMember, workspaceLimit)
 	{
 		analytics.GET("/:workspaceId/upload-trends", analyticsHandler.GetUploadTrends)
 		analytics.GET("/:workspaceId/storage-trends", analyticsHandler.GetStorageTrends)
 		analytics.GET("/:workspaceId/file-types", analyticsHandler.GetFileTypeDistribution)
 		analytics.GET("/:workspaceId/user-stats", analyticsHandler.GetUserUploadStats)
+		analytics.GET("/:workspaceId/most-viewed", analyticsHandler.GetMostViewed)
+		analytics.GET("/:workspaceId/unique-viewers", analyticsHandler.GetUniqueViewers)
+		analytics.GET("/:workspaceId/never-accessed", analyticsHandler.GetNeverAccessed)
+		analytics.GET("/:workspaceId/export/:report", analyticsHandler.Export)
+		analytics.GET("/:workspaceId/chargeback", chargebackHandler.GetInvoice)
+		analytics.GET("/:workspaceId/chargeback/pricing", chargebackHandler.GetPricing)
 	}
 
 	// ── Media Galleries ──
 	galleries := router.Group("/api/v1/media/galleries")
-	galleries.Use(handlers.AuthMiddleware(cfg.JWTSecret))
+	galleries.Use(handlers.AuthMiddleware(verifier, apiKeyService))
 	{
 		galleries.POST("", galleryHandler.Create)
-		galleries.GET("/workspace/:workspaceId", galleryHandler.List)
+		galleries.GET("/workspace/:workspaceId", wsMember, galleryHandler.List)
 		galleries.GET("/:galleryId", galleryHandler.Get)
 		galleries.PUT("/:galleryId", galleryHandler.Update)
 		galleries.DELETE("/:galleryId", galleryHandler.Delete)
+		galleries.POST("/:galleryId/share-links", shareLinkLimit, sharingHandler.CreateGalleryShareLink)
+		galleries.GET("/:galleryId/share-links", sharingHandler.GetGalleryShareLinks)
+	}
+
+	// ── Audit Log (workspace admins) ──
+	audit := router.Group("/api/v1/media/audit")
+	audit.Use(handlers.AuthMiddleware(verifier, apiKeyService))
+	{
+		audit.GET("/public-key", auditHandler.GetPublicKey)
+		audit.GET("/:workspaceId/verify", wsAdmin, auditHandler.Verify)
+		audit.GET("/:workspaceId/export", wsAdmin, auditHandler.Export)
+	}
+
+	// ── Webhooks (workspace admins) ──
+	webhooks := router.Group("/api/v1/media/webhooks")
+	webhooks.Use(handlers.AuthMiddleware(verifier, apiKeyService))
+	{
+		webhooks.POST("", webhookHandler.Create)
+		webhooks.GET("/workspace/:workspaceId", wsAdmin, webhookHandler.List)
+		webhooks.GET("/:webhookId", webhookHandler.Get)
+		webhooks.PUT("/:webhookId", webhookHandler.Update)
+		webhooks.DELETE("/:webhookId", webhookHandler.Delete)
+		webhooks.GET("/:webhookId/deliveries", webhookHandler.ListDeliveries)
+		webhooks.GET("/:webhookId/deliveries/:deliveryId", webhookHandler.GetDelivery)
+		webhooks.POST("/:webhookId/deliveries/:deliveryId/redeliver", webhookHandler.Redeliver)
+	}
+
+	// ── Encryption at Rest (workspace admins) ──
+	encryption := router.Group("/api/v1/media/encryption")
+	encryption.Use(handlers.AuthMiddleware(verifier, apiKeyService), wsAdmin)
+	{
+		encryption.GET("/:workspaceId", encryptionHandler.Get)
+		encryption.PUT("/:workspaceId", encryptionHandler.Enable)
+		encryption.POST("/:workspaceId/rotate", encryptionHandler.Rotate)
+	}
+
+	// ── Encrypted Content (authorized by signed URL) ──
+	router.GET("/api/v1/media/content/:id", encryptionHandler.GetContent)
+	router.PUT("/api/v1/media/content/:id", encryptionHandler.PutContent)
+
+	// ── API Keys (managed by platform admins) ──
+	apiKeys := router.Group("/api/v1/media/api-keys")
+	apiKeys.Use(handlers.AuthMiddleware(verifier, apiKeyService), platformAdmin)
+	{
+		apiKeys.POST("", apiKeyHandler.Create)
+		apiKeys.GET("", apiKeyHandler.List)
+		apiKeys.GET("/:keyId", apiKeyHandler.Get)
+		apiKeys.DELETE("/:keyId", apiKeyHandler.Revoke)
+	}
+
+	// ── Realtime Updates ──
+	live := router.Group("/api/v1/media/realtime")
+	live.Use(handlers.AuthMiddleware(verifier, apiKeyService))
+	{
+		live.GET("/stream", realtimeHandler.Stream)
 	}
 
 	// Start server
@@ -340,5 +570,43 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	srv.Shutdown(ctx)
+	auditor.Close(ctx)
 	log.Println("Media service stopped")
 }
+
+func runMigrateCommand(db *database.MongoDB, args []string) {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	switch action {
+	case "up":
+		applied, err := migrations.Run(ctx, db)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			log.Println("No pending migrations")
+			return
+		}
+		log.Printf("Applied migrations: %v", applied)
+	case "status":
+		statuses, err := migrations.Status(ctx, db)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-60s %s\n", st.Version, st.Description, state)
+		}
+	default:
+		log.Fatalf("Unknown migrate action %q (expected up or status)", action)
+	}
+}
@@ -0,0 +1,63 @@
+package auditchain
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAuditEntryHashSurvivesStorage(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after map[string]string
+	}{
+		{name: "empty maps", before: map[string]string{}, after: map[string]string{}},
+		{name: "nil maps"},
+		{name: "populated maps", before: map[string]string{"filename": "a.png"}, after: map[string]string{"filename": "b.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &models.MediaActivity{
+				ID:          "entry-1",
+				MediaID:     "media-1",
+				WorkspaceID: "ws-1",
+				UserID:      "user-1",
+				Action:      "rename",
+				Before:      tt.before,
+				After:       tt.after,
+				CreatedAt:   time.Now(),
+			}
+			Link([]*models.MediaActivity{entry}, 4, "prev-hash")
+
+			// Entries are read back from Mongo and from exported NDJSON
+			codecs := []struct {
+				name      string
+				marshal   func(interface{}) ([]byte, error)
+				unmarshal func([]byte, interface{}) error
+			}{
+				{"bson", bson.Marshal, bson.Unmarshal},
+				{"json", json.Marshal, json.Unmarshal},
+			}
+			for _, codec := range codecs {
+				data, err := codec.marshal(entry)
+				if err != nil {
+					t.Fatalf("%s marshal: %v", codec.name, err)
+				}
+				var stored models.MediaActivity
+				if err := codec.unmarshal(data, &stored); err != nil {
+					t.Fatalf("%s unmarshal: %v", codec.name, err)
+				}
+
+				if stored.Hash != entry.Hash {
+					t.Fatalf("%s: stored hash %q, want %q", codec.name, stored.Hash, entry.Hash)
+				}
+				if got := Hash(&stored); got != stored.Hash {
+					t.Errorf("%s: stored entry hashes to %q, want %q", codec.name, got, stored.Hash)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	jwksRefreshInterval = 5 * time.Minute
+	// A token with an unknown kid triggers a refresh, at most this often,
+	// so keys rotated in upstream are picked up without a restart
+	jwksMinRefresh = 30 * time.Second
+	jwksTimeout    = 10 * time.Second
+	maxJWKSSize    = 1 << 20
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type publicKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// keySet holds the signing keys of a JWKS by kid. A failed refresh keeps
+// the previous keys; a successful one replaces them, so keys dropped
+// upstream stop verifying.
+type keySet struct {
+	url    string
+	file   string
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]publicKey
+	fileMod     time.Time
+	lastRefresh time.Time
+}
+
+func newKeySet(url, file string) (*keySet, error) {
+	ks := &keySet{url: url, file: file, client: &http.Client{Timeout: jwksTimeout}}
+	ctx, cancel := context.WithTimeout(context.Background(), jwksTimeout)
+	defer cancel()
+	if err := ks.refresh(ctx); err != nil {
+		return nil, fmt.Errorf("load JWKS: %w", err)
+	}
+	return ks, nil
+}
+
+func (ks *keySet) run(ctx context.Context) {
+	ticker := time.NewTicker(jwksRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.refresh(ctx); err != nil {
+				log.Printf("Failed to refresh JWKS: %v", err)
+			}
+		}
+	}
+}
+
+func (ks *keySet) lookup(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	key, ok := ks.get(kid)
+	if !ok && ks.claimRefresh() {
+		if err := ks.refresh(ctx); err != nil {
+			log.Printf("Failed to refresh JWKS: %v", err)
+		}
+		key, ok = ks.get(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if key.alg != alg {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, key.alg, alg)
+	}
+	return key.key, nil
+}
+
+func (ks *keySet) get(kid string) (publicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// claimRefresh lets one caller refresh early per jwksMinRefresh, so a
+// burst of tokens with an unknown kid causes a single fetch.
+func (ks *keySet) claimRefresh() bool {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if time.Since(ks.lastRefresh) < jwksMinRefresh {
+		return false
+	}
+	ks.lastRefresh = time.Now()
+	return true
+}
+
+func (ks *keySet) refresh(ctx context.Context) error {
+	var (
+		data []byte
+		mod  time.Time
+		err  error
+	)
+	if ks.file != "" {
+		data, mod, err = ks.readFile()
+	} else {
+		data, err = ks.fetch(ctx)
+	}
+	if err != nil || data == nil {
+		return err
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	ks.mu.Lock()
+	ks.keys = keys
+	if !mod.IsZero() {
+		ks.fileMod = mod
+	}
+	ks.mu.Unlock()
+	return nil
+}
+
+// readFile returns nil data if the file hasn't changed since it was last
+// loaded.
+func (ks *keySet) readFile() ([]byte, time.Time, error) {
+	info, err := os.Stat(ks.file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	ks.mu.RLock()
+	unchanged := ks.keys != nil && info.ModTime().Equal(ks.fileMod)
+	ks.mu.RUnlock()
+	if unchanged {
+		return nil, time.Time{}, nil
+	}
+	data, err := os.ReadFile(ks.file)
+	return data, info.ModTime(), err
+}
+
+func (ks *keySet) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// parseJWKS keeps the RSA and P-256 signing keys of a set, skipping
+// anything else so one unsupported key doesn't lock out the rest.
+func parseJWKS(data []byte) (map[string]publicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+
+	keys := map[string]publicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (publicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		if k.Alg != "" && k.Alg != "RS256" {
+			return publicKey{}, fmt.Errorf("unsupported alg %s", k.Alg)
+		}
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return publicKey{}, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return publicKey{}, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 || e.Int64() < 3 {
+			return publicKey{}, errors.New("bad RSA exponent")
+		}
+		if n.BitLen() < 2048 {
+			return publicKey{}, errors.New("RSA key is shorter than 2048 bits")
+		}
+		return publicKey{alg: "RS256", key: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+
+	case "EC":
+		if k.Crv != "P-256" || (k.Alg != "" && k.Alg != "ES256") {
+			return publicKey{}, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return publicKey{}, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return publicKey{}, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return publicKey{}, errors.New("point is not on P-256")
+		}
+		return publicKey{alg: "ES256", key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	}
+	return publicKey{}, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("bad key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
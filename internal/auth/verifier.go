@@ -0,0 +1,139 @@
+// Package auth verifies the access tokens issued by the QuckApp auth
+// service. Tokens are signed with a shared HS256 secret or with RS256 and
+// ES256 keys published as a JWKS. Each key is only accepted with its own
+// algorithm, so a public key can never be replayed as an HMAC secret.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Clock skew tolerated on exp, nbf and iat
+const leeway = 30 * time.Second
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Config struct {
+	Secret   string // HS256 secret; empty disables HS256
+	Issuer   string // required iss, if set
+	Audience string // required aud, if set
+	JWKSURL  string // RS256/ES256 keys, fetched and refreshed periodically
+	JWKSFile string // or read from a local file, reloaded when it changes
+}
+
+// Claims are the claims of an access token. Membership comes as lists,
+// or as a single ID for tokens scoped to one workspace or channel.
+type Claims struct {
+	jwt.RegisteredClaims
+	Workspaces     []string          `json:"workspaces,omitempty"`
+	WorkspaceID    string            `json:"workspaceId,omitempty"`
+	Channels       []string          `json:"channels,omitempty"`
+	ChannelID      string            `json:"channelId,omitempty"`
+	Roles          []string          `json:"roles,omitempty"`
+	Role           string            `json:"role,omitempty"`
+	WorkspaceRoles map[string]string `json:"workspaceRoles,omitempty"` // workspace ID -> owner, admin, member or guest
+}
+
+func (c *Claims) WorkspaceIDs() []string { return withSingle(c.Workspaces, c.WorkspaceID) }
+func (c *Claims) ChannelIDs() []string   { return withSingle(c.Channels, c.ChannelID) }
+func (c *Claims) RoleNames() []string    { return withSingle(c.Roles, c.Role) }
+
+func withSingle(list []string, single string) []string {
+	var out []string
+	for _, v := range list {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	if single != "" {
+		out = append(out, single)
+	}
+	return out
+}
+
+type Verifier struct {
+	secret []byte
+	keys   *keySet
+	parser *jwt.Parser
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	v := &Verifier{}
+	var methods []string
+	if cfg.Secret != "" {
+		v.secret = []byte(cfg.Secret)
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JWKSURL != "" && cfg.JWKSFile != "" {
+		return nil, errors.New("set either a JWKS URL or a JWKS file, not both")
+	}
+	if cfg.JWKSURL != "" || cfg.JWKSFile != "" {
+		keys, err := newKeySet(cfg.JWKSURL, cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no token signing keys configured")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+	return v, nil
+}
+
+// Run keeps the JWKS current until ctx is cancelled. It returns at once
+// if no JWKS is configured.
+func (v *Verifier) Run(ctx context.Context) {
+	if v.keys != nil {
+		v.keys.run(ctx)
+	}
+}
+
+// Verify checks the token's signature, algorithm, expiry, issuer and
+// audience, and that it names a subject.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	var claims Claims
+	_, err := v.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return v.key(ctx, t)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	return &claims, nil
+}
+
+func (v *Verifier) key(ctx context.Context, t *jwt.Token) (interface{}, error) {
+	alg := t.Method.Alg()
+	if alg == jwt.SigningMethodHS256.Alg() {
+		if v.secret == nil {
+			return nil, errors.New("HS256 is not accepted")
+		}
+		return v.secret, nil
+	}
+	if v.keys == nil {
+		return nil, fmt.Errorf("%s is not accepted", alg)
+	}
+	kid, _ := t.Header["kid"].(string)
+	return v.keys.lookup(ctx, kid, alg)
+}
@@ -1,19 +1,65 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strings"
+)
 
 type Config struct {
 	Port          string
-	MongoURI      string
+	MongoURI      string // a replica set or mongos; events are written in transactions
 	RedisHost     string
 	RedisPort     string
 	RedisPassword string
-	JWTSecret     string
+	JWTSecret     string // HS256; empty accepts only JWKS-signed tokens
 	AWSRegion     string
 	AWSAccessKey  string
 	AWSSecretKey  string
 	S3Bucket      string
 	KafkaBrokers  string
+	EventBroker   string // kafka or memory
+
+	MigrateOnStartup bool
+
+	// JSON models.ChargebackPricing; empty uses the built-in price list
+	ChargebackPricing string
+
+	// Base64 Ed25519 seed or private key; audit exports are disabled without it
+	AuditSigningKey string
+
+	// What happens to media of deleted channels, workspaces and users:
+	// trash, delete or reassign (to CleanupReassignTo)
+	ConsumerGroup          string
+	CleanupChannelPolicy   string
+	CleanupWorkspacePolicy string
+	CleanupUserPolicy      string
+	CleanupReassignTo      string
+
+	// Token validation; issuer and audience are checked when set. JWKS keys
+	// (RS256/ES256) come from a URL or a local file, not both.
+	JWTIssuer   string
+	JWTAudience string
+	JWKSURL     string
+	JWKSFile    string
+
+	// Lets webhooks target loopback and private addresses, for local setups
+	WebhookAllowPrivate bool
+
+	RateLimitEnabled bool
+
+	// Proxies (IPs or CIDRs) whose X-Forwarded-For is believed when taking
+	// the client IP for rate limits and audit entries. None by default, so
+	// the IP is the connection's peer; set it when behind a load balancer
+	TrustedProxies []string
+
+	// Encryption at rest is available once a KMS is configured. Encrypted
+	// media are served by this service at PublicURL, through URLs signed
+	// with ContentURLSecret. KMSLocalFile is for a single instance (or
+	// replicas sharing one host's disk); replicas elsewhere can't see keys
+	// each other create
+	KMSLocalFile     string
+	PublicURL        string
+	ContentURLSecret string
 }
 
 func Load() *Config {
@@ -23,12 +69,39 @@ func Load() *Config {
 		RedisHost:     getEnv("REDIS_HOST", "localhost"),
 		RedisPort:     getEnv("REDIS_PORT", "6379"),
 		RedisPassword: getEnv("REDIS_PASSWORD", ""),
-		JWTSecret:     getEnv("JWT_SECRET", "your-secret-key"),
+		JWTSecret:     getEnv("JWT_SECRET", ""),
 		AWSRegion:     getEnv("AWS_REGION", "ap-south-1"),
 		AWSAccessKey:  getEnv("AWS_ACCESS_KEY_ID", ""),
 		AWSSecretKey:  getEnv("AWS_SECRET_ACCESS_KEY", ""),
 		S3Bucket:      getEnv("AWS_S3_BUCKET", "quckapp-media"),
 		KafkaBrokers:  getEnv("KAFKA_BROKERS", "localhost:9092"),
+		EventBroker:   getEnv("EVENT_BROKER", "kafka"),
+
+		MigrateOnStartup: getEnv("MIGRATE_ON_STARTUP", "true") == "true",
+
+		ChargebackPricing: getEnv("CHARGEBACK_PRICING", ""),
+
+		AuditSigningKey: getEnv("AUDIT_SIGNING_KEY", ""),
+
+		ConsumerGroup:          getEnv("KAFKA_CONSUMER_GROUP", "media-service"),
+		CleanupChannelPolicy:   getEnv("CLEANUP_CHANNEL_POLICY", "trash"),
+		CleanupWorkspacePolicy: getEnv("CLEANUP_WORKSPACE_POLICY", "trash"),
+		CleanupUserPolicy:      getEnv("CLEANUP_USER_POLICY", "trash"),
+		CleanupReassignTo:      getEnv("CLEANUP_REASSIGN_TO", ""),
+
+		JWTIssuer:   getEnv("JWT_ISSUER", ""),
+		JWTAudience: getEnv("JWT_AUDIENCE", ""),
+		JWKSURL:     getEnv("JWT_JWKS_URL", ""),
+		JWKSFile:    getEnv("JWT_JWKS_FILE", ""),
+
+		WebhookAllowPrivate: getEnv("WEBHOOK_ALLOW_PRIVATE", "false") == "true",
+
+		RateLimitEnabled: getEnv("RATE_LIMIT_ENABLED", "true") == "true",
+		TrustedProxies:   getEnvList("TRUSTED_PROXIES"),
+
+		KMSLocalFile:     getEnv("KMS_LOCAL_FILE", ""),
+		PublicURL:        getEnv("PUBLIC_URL", "http://localhost:"+getEnv("PORT", "5001")),
+		ContentURLSecret: getEnv("CONTENT_URL_SECRET", ""),
 	}
 }
 
@@ -38,3 +111,14 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvList splits a comma-separated variable, skipping empty entries.
+func getEnvList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -38,6 +38,22 @@ func (m *MongoDB) Close() {
 	m.Client.Disconnect(ctx)
 }
 
+// WithTransaction runs fn in a transaction, retrying it on transient
+// errors. Writes made with the ctx passed to fn commit or abort together,
+// which needs a replica set or sharded cluster.
+func (m *MongoDB) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := m.Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
 func (m *MongoDB) Collection(name string) *mongo.Collection {
 	return m.Database.Collection(name)
 }
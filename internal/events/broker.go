@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+type Message struct {
+	Topic   string
+	Key     string
+	Value   []byte
+	Headers map[string]string
+
+	// Set on consumed messages
+	Partition int
+	Offset    int64
+}
+
+// Broker delivers messages. Publish returns only once every message is
+// acknowledged, or an error if any may not have been.
+type Broker interface {
+	Publish(ctx context.Context, messages ...Message) error
+	Close() error
+}
+
+type KafkaBroker struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaBroker connects to a comma-separated list of brokers. Messages
+// with the same key land on the same partition.
+func NewKafkaBroker(brokers string) *KafkaBroker {
+	var addrs []string
+	for _, addr := range strings.Split(brokers, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return &KafkaBroker{writer: &kafka.Writer{
+		Addr:                   kafka.TCP(addrs...),
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		BatchTimeout:           10 * time.Millisecond,
+		AllowAutoTopicCreation: true,
+	}}
+}
+
+func (b *KafkaBroker) Publish(ctx context.Context, messages ...Message) error {
+	msgs := make([]kafka.Message, len(messages))
+	for i, m := range messages {
+		msgs[i] = kafka.Message{Topic: m.Topic, Key: []byte(m.Key), Value: m.Value}
+		for k, v := range m.Headers {
+			msgs[i].Headers = append(msgs[i].Headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+	}
+	return b.writer.WriteMessages(ctx, msgs...)
+}
+
+func (b *KafkaBroker) Close() error {
+	return b.writer.Close()
+}
+
+// MemoryBroker keeps published messages in memory, for tests and local
+// runs without Kafka. Setting Err makes Publish fail, simulating an outage.
+type MemoryBroker struct {
+	mu       sync.Mutex
+	messages []Message
+	Err      error
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, messages ...Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.Err != nil {
+		return b.Err
+	}
+	b.messages = append(b.messages, messages...)
+	return nil
+}
+
+// Messages returns what was published to topic, or everything if topic is
+// empty, in publish order.
+func (b *MemoryBroker) Messages(topic string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []Message
+	for _, m := range b.messages {
+		if topic == "" || m.Topic == topic {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func (b *MemoryBroker) Close() error {
+	return nil
+}
@@ -0,0 +1,209 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/segmentio/kafka-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	processedCollection  = "processed_events"
+	deadLetterCollection = "event_dead_letters"
+
+	consumeAttempts = 5
+	consumeBackoff  = time.Second
+)
+
+// Handler processes one event. It may run more than once for the same event
+// if the process dies before the event is recorded as processed, so it must
+// be idempotent. Unknown event types should be ignored.
+type Handler func(ctx context.Context, event *Event) error
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler error as not worth retrying; the event goes
+// straight to the dead-letter collection.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type processedEvent struct {
+	ID          string    `bson:"_id"`
+	Type        string    `bson:"type"`
+	ProcessedAt time.Time `bson:"processedAt"`
+}
+
+// DeadLetter is a message that could not be processed, kept with enough
+// detail to inspect and replay it.
+type DeadLetter struct {
+	ID        string    `json:"id" bson:"_id"`
+	EventID   string    `json:"eventId,omitempty" bson:"eventId,omitempty"`
+	EventType string    `json:"eventType,omitempty" bson:"eventType,omitempty"`
+	Topic     string    `json:"topic" bson:"topic"`
+	Partition int       `json:"partition" bson:"partition"`
+	Offset    int64     `json:"offset" bson:"offset"`
+	Key       string    `json:"key" bson:"key"`
+	Payload   string    `json:"payload" bson:"payload"`
+	Error     string    `json:"error" bson:"error"`
+	Attempts  int       `json:"attempts" bson:"attempts"`
+	FailedAt  time.Time `json:"failedAt" bson:"failedAt"`
+}
+
+// Consumer feeds each event ID to a Handler once, retrying failures with
+// backoff and dead-lettering events that keep failing, so one bad event
+// never blocks its partition.
+type Consumer struct {
+	db      *database.MongoDB
+	handler Handler
+	reader  *kafka.Reader
+}
+
+func NewConsumer(db *database.MongoDB, handler Handler) *Consumer {
+	return &Consumer{db: db, handler: handler}
+}
+
+// NewKafkaConsumer reads topics as part of consumer group groupID.
+func NewKafkaConsumer(db *database.MongoDB, handler Handler, brokers, groupID string, topics []string) *Consumer {
+	c := NewConsumer(db, handler)
+	c.reader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     strings.Split(brokers, ","),
+		GroupID:     groupID,
+		GroupTopics: topics,
+		StartOffset: kafka.FirstOffset,
+		MaxWait:     time.Second,
+	})
+	return c
+}
+
+// Run consumes until ctx is cancelled. Offsets are committed only after a
+// message is handled or dead-lettered.
+func (c *Consumer) Run(ctx context.Context) {
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Event consumer fetch failed: %v", err)
+			time.Sleep(consumeBackoff)
+			continue
+		}
+
+		headers := map[string]string{}
+		for _, h := range msg.Headers {
+			headers[h.Key] = string(h.Value)
+		}
+		err = c.Handle(ctx, Message{
+			Topic:     msg.Topic,
+			Key:       string(msg.Key),
+			Value:     msg.Value,
+			Headers:   headers,
+			Partition: msg.Partition,
+			Offset:    msg.Offset,
+		})
+		if err != nil {
+			// Only returned when ctx is done or the outcome couldn't be
+			// stored; leave the offset so the message is redelivered.
+			log.Printf("Event consumer stopped on %s/%d@%d: %v", msg.Topic, msg.Partition, msg.Offset, err)
+			if ctx.Err() != nil {
+				return
+			}
+			time.Sleep(consumeBackoff)
+			continue
+		}
+		if err := c.reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to commit %s/%d@%d: %v", msg.Topic, msg.Partition, msg.Offset, err)
+		}
+	}
+}
+
+func (c *Consumer) Close() error {
+	if c.reader == nil {
+		return nil
+	}
+	return c.reader.Close()
+}
+
+// Handle processes one message. It returns an error only when the message
+// should be redelivered; handler failures end up dead-lettered instead.
+func (c *Consumer) Handle(ctx context.Context, msg Message) error {
+	var event Event
+	if err := json.Unmarshal(msg.Value, &event); err != nil || event.ID == "" || event.Type == "" {
+		if err == nil {
+			err = fmt.Errorf("event is missing id or type")
+		}
+		return c.deadLetter(ctx, msg, nil, fmt.Errorf("decode event: %w", err), 0)
+	}
+
+	processed := c.db.Collection(processedCollection)
+	err := processed.FindOne(ctx, bson.M{"_id": event.ID}).Err()
+	if err == nil {
+		return nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	var handleErr error
+	attempts := 0
+	for attempts < consumeAttempts {
+		attempts++
+		if handleErr = c.handler(ctx, &event); handleErr == nil {
+			break
+		}
+		var permanent *permanentError
+		if errors.As(handleErr, &permanent) || attempts == consumeAttempts {
+			break
+		}
+		log.Printf("Event %s (%s) failed, attempt %d: %v", event.ID, event.Type, attempts, handleErr)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(consumeBackoff << (attempts - 1)):
+		}
+	}
+	if handleErr != nil {
+		if err := c.deadLetter(ctx, msg, &event, handleErr, attempts); err != nil {
+			return err
+		}
+	}
+
+	_, err = processed.InsertOne(ctx, &processedEvent{ID: event.ID, Type: event.Type, ProcessedAt: time.Now()})
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *Consumer) deadLetter(ctx context.Context, msg Message, event *Event, cause error, attempts int) error {
+	dl := &DeadLetter{
+		ID:        uuid.New().String(),
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       msg.Key,
+		Payload:   string(msg.Value),
+		Error:     cause.Error(),
+		Attempts:  attempts,
+		FailedAt:  time.Now(),
+	}
+	if event != nil {
+		dl.EventID, dl.EventType = event.ID, event.Type
+	}
+	log.Printf("Dead-lettering %s/%d@%d: %v", msg.Topic, msg.Partition, msg.Offset, cause)
+	_, err := c.db.Collection(deadLetterCollection).InsertOne(ctx, dl)
+	return err
+}
@@ -0,0 +1,154 @@
+// Package events publishes versioned domain events for other QuckApp
+// services. Events are written to a Mongo outbox and relayed to a Broker,
+// so a broker outage delays delivery instead of losing events.
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const Source = "media-service"
+
+// Event types. Consumers switch on Type and Version; a payload change that
+// isn't backwards compatible bumps that type's version in versions.
+const (
+	MediaCreated  = "media.created"
+	MediaDeleted  = "media.deleted"
+	MediaShared   = "media.shared"
+	JobCompleted  = "job.completed"
+	ScanFlagged   = "scan.flagged"
+	QuotaExceeded = "quota.exceeded"
+)
+
+// Event types consumed from other services.
+const (
+	ChannelDeleted   = "channel.deleted"
+	WorkspaceDeleted = "workspace.deleted"
+	UserDeleted      = "user.deleted"
+)
+
+var versions = map[string]int{
+	MediaCreated:  1,
+	MediaDeleted:  1,
+	MediaShared:   1,
+	JobCompleted:  1,
+	ScanFlagged:   1,
+	QuotaExceeded: 1,
+}
+
+// Event is the envelope every message carries. Subject is the ID of the
+// entity the event is about and doubles as the partition key, so events for
+// one entity stay in order.
+type Event struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Version     int             `json:"version"`
+	Source      string          `json:"source"`
+	WorkspaceID string          `json:"workspaceId,omitempty"`
+	Subject     string          `json:"subject"`
+	OccurredAt  time.Time       `json:"occurredAt"`
+	Data        json.RawMessage `json:"data"`
+}
+
+func New(eventType, workspaceID, subject string, data interface{}) (*Event, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	version, ok := versions[eventType]
+	if !ok {
+		version = 1
+	}
+	return &Event{
+		ID:          uuid.New().String(),
+		Type:        eventType,
+		Version:     version,
+		Source:      Source,
+		WorkspaceID: workspaceID,
+		Subject:     subject,
+		OccurredAt:  time.Now().UTC(),
+		Data:        payload,
+	}, nil
+}
+
+// Topic maps an event type to its topic, quckapp.<domain>, where the domain
+// is the part of the type before the first dot.
+func Topic(eventType string) string {
+	domain, _, _ := strings.Cut(eventType, ".")
+	return "quckapp." + domain
+}
+
+// Payloads
+
+type MediaCreatedData struct {
+	MediaID  string `json:"mediaId"`
+	UserID   string `json:"userId"`
+	Filename string `json:"filename"`
+	MimeType string `json:"mimeType"`
+	Type     string `json:"type"`
+	Size     int64  `json:"size"`
+}
+
+type MediaDeletedData struct {
+	MediaID string `json:"mediaId"`
+	UserID  string `json:"userId"`
+	Size    int64  `json:"size"`
+}
+
+type MediaSharedData struct {
+	MediaID    string     `json:"mediaId"`
+	SharedBy   string     `json:"sharedBy"`
+	SharedWith string     `json:"sharedWith,omitempty"`
+	Permission string     `json:"permission,omitempty"`
+	LinkID     string     `json:"linkId,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// JobCompletedData is sent for every job that finishes, successfully or not.
+type JobCompletedData struct {
+	JobID   string                 `json:"jobId"`
+	MediaID string                 `json:"mediaId"`
+	UserID  string                 `json:"userId"`
+	Type    string                 `json:"type"`
+	Status  string                 `json:"status"`
+	Result  map[string]interface{} `json:"result,omitempty"`
+	Error   string                 `json:"error,omitempty"`
+}
+
+type ScanFlaggedData struct {
+	ScanID     string  `json:"scanId"`
+	MediaID    string  `json:"mediaId"`
+	ScanType   string  `json:"scanType"`
+	Confidence float64 `json:"confidence"`
+	Details    string  `json:"details,omitempty"`
+}
+
+type QuotaExceededData struct {
+	WorkspaceID    string `json:"workspaceId"`
+	Limit          string `json:"limit"` // storage or files
+	MaxStorageMB   int64  `json:"maxStorageMB"`
+	UsedStorageMB  int64  `json:"usedStorageMB"`
+	MaxFileCount   int64  `json:"maxFileCount"`
+	FileCount      int64  `json:"fileCount"`
+	TriggerMediaID string `json:"triggerMediaId,omitempty"`
+}
+
+type ChannelDeletedData struct {
+	ChannelID   string `json:"channelId"`
+	WorkspaceID string `json:"workspaceId,omitempty"`
+}
+
+type WorkspaceDeletedData struct {
+	WorkspaceID string `json:"workspaceId"`
+}
+
+// UserDeletedData may name who inherits the user's media; otherwise the
+// configured default owner does.
+type UserDeletedData struct {
+	UserID     string `json:"userId"`
+	ReassignTo string `json:"reassignTo,omitempty"`
+}
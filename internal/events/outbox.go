@@ -0,0 +1,281 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/quckapp/media-service/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	outboxCollection = "event_outbox"
+
+	outboxPending   = "pending"
+	outboxPublished = "published"
+
+	relayInterval  = time.Second
+	relayBatchSize = 100
+	// A claimed batch is retried by any relay once its lease runs out, so a
+	// crashed instance can't strand events.
+	relayLease     = 30 * time.Second
+	relayTimeout   = 20 * time.Second
+	maxRelayDelay  = 5 * time.Minute
+	enqueueTimeout = 5 * time.Second
+)
+
+type outboxRecord struct {
+	ID            string     `bson:"_id"`
+	Type          string     `bson:"type"`
+	Topic         string     `bson:"topic"`
+	Key           string     `bson:"key"`
+	Payload       []byte     `bson:"payload"`
+	Version       int        `bson:"version"`
+	Status        string     `bson:"status"`
+	Attempts      int        `bson:"attempts"`
+	LastError     string     `bson:"lastError,omitempty"`
+	NextAttemptAt time.Time  `bson:"nextAttemptAt"`
+	LockedUntil   time.Time  `bson:"lockedUntil"`
+	CreatedAt     time.Time  `bson:"createdAt"`
+	PublishedAt   *time.Time `bson:"publishedAt,omitempty"`
+}
+
+// Sink receives each relayed batch after the broker accepts it, e.g. to fan
+// events out to webhooks. A failing sink reschedules the batch, which is
+// then published and sunk again, so sinks must be idempotent.
+type Sink func(ctx context.Context, events []Event) error
+
+// Publisher writes events to the event_outbox collection and relays them to
+// the broker in the background. Events describing a change are enqueued in
+// the same transaction as the change, so one is never stored without the
+// other.
+type Publisher struct {
+	db     *database.MongoDB
+	broker Broker
+	sinks  []Sink
+	wake   chan struct{}
+}
+
+func NewPublisher(db *database.MongoDB, broker Broker) *Publisher {
+	return &Publisher{db: db, broker: broker, wake: make(chan struct{}, 1)}
+}
+
+// AddSink registers a sink; call it before Run.
+func (p *Publisher) AddSink(sink Sink) {
+	p.sinks = append(p.sinks, sink)
+}
+
+// Enqueue records an event for delivery. Call it with the ctx of the
+// transaction making the change (see database.MongoDB.WithTransaction) and
+// return its error from there, so a failed write aborts the change too. A
+// nil Publisher is a no-op.
+func (p *Publisher) Enqueue(ctx context.Context, eventType, workspaceID, subject string, data interface{}) error {
+	if p == nil {
+		return nil
+	}
+	return p.enqueue(ctx, eventType, workspaceID, subject, data)
+}
+
+// Publish records an event outside any transaction, for notifications
+// worked out after the fact, such as a quota being crossed. Failures are
+// logged and the event is lost.
+func (p *Publisher) Publish(ctx context.Context, eventType, workspaceID, subject string, data interface{}) {
+	if p == nil {
+		return
+	}
+	if err := p.enqueue(ctx, eventType, workspaceID, subject, data); err != nil {
+		log.Printf("Failed to enqueue %s event for %s: %v", eventType, subject, err)
+	}
+}
+
+func (p *Publisher) enqueue(ctx context.Context, eventType, workspaceID, subject string, data interface{}) error {
+	event, err := New(eventType, workspaceID, subject, data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	// Outside a transaction the request may be cancelled right after the
+	// change it describes; the event must still be written. The session,
+	// if any, is a value and carries over.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), enqueueTimeout)
+	defer cancel()
+
+	now := time.Now()
+	_, err = p.db.Collection(outboxCollection).InsertOne(ctx, &outboxRecord{
+		ID:            event.ID,
+		Type:          event.Type,
+		Topic:         Topic(event.Type),
+		Key:           subject,
+		Payload:       payload,
+		Version:       event.Version,
+		Status:        outboxPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run relays pending events until ctx is cancelled. Delivery is at least
+// once: consumers dedupe on the event ID.
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := p.relayBatch(ctx)
+			if err != nil {
+				log.Printf("Event relay failed: %v", err)
+			}
+			if err != nil || n < relayBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+	}
+}
+
+// relayBatch claims up to relayBatchSize due events, publishes them
+// together and marks the outcome. It returns how many were claimed.
+func (p *Publisher) relayBatch(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, relayTimeout)
+	defer cancel()
+
+	coll := p.db.Collection(outboxCollection)
+	now := time.Now()
+	due := bson.M{
+		"status":        outboxPending,
+		"nextAttemptAt": bson.M{"$lte": now},
+		"lockedUntil":   bson.M{"$lte": now},
+	}
+	cursor, err := coll.Find(ctx, due,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(relayBatchSize),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var candidates []outboxRecord
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return 0, err
+	}
+
+	var claimed []outboxRecord
+	for _, rec := range candidates {
+		filter := bson.M{"_id": rec.ID}
+		for k, v := range due {
+			filter[k] = v
+		}
+		res, err := coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"lockedUntil": now.Add(relayLease)}})
+		if err != nil {
+			return len(claimed), err
+		}
+		if res.ModifiedCount == 1 {
+			claimed = append(claimed, rec)
+		}
+	}
+	if len(claimed) == 0 {
+		return 0, nil
+	}
+
+	messages := make([]Message, len(claimed))
+	ids := make([]string, len(claimed))
+	for i, rec := range claimed {
+		ids[i] = rec.ID
+		messages[i] = Message{
+			Topic: rec.Topic,
+			Key:   rec.Key,
+			Value: rec.Payload,
+			Headers: map[string]string{
+				"event-id":      rec.ID,
+				"event-type":    rec.Type,
+				"event-version": strconv.Itoa(rec.Version),
+				"event-source":  Source,
+			},
+		}
+	}
+
+	if pubErr := p.deliver(ctx, claimed, messages); pubErr != nil {
+		// The whole batch is retried; consumers dedupe any that got through
+		var writes []mongo.WriteModel
+		for _, rec := range claimed {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": rec.ID}).
+				SetUpdate(bson.M{
+					"$set": bson.M{
+						"nextAttemptAt": time.Now().Add(relayBackoff(rec.Attempts + 1)),
+						"lockedUntil":   time.Time{},
+						"lastError":     pubErr.Error(),
+					},
+					"$inc": bson.M{"attempts": 1},
+				}))
+		}
+		if _, err := coll.BulkWrite(ctx, writes); err != nil {
+			log.Printf("Failed to reschedule %d events: %v", len(writes), err)
+		}
+		return len(claimed), pubErr
+	}
+
+	_, err = coll.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{
+		"$set":   bson.M{"status": outboxPublished, "publishedAt": time.Now()},
+		"$unset": bson.M{"lastError": ""},
+		"$inc":   bson.M{"attempts": 1},
+	})
+	return len(claimed), err
+}
+
+func (p *Publisher) deliver(ctx context.Context, claimed []outboxRecord, messages []Message) error {
+	if err := p.broker.Publish(ctx, messages...); err != nil {
+		return err
+	}
+	if len(p.sinks) == 0 {
+		return nil
+	}
+	batch := make([]Event, 0, len(claimed))
+	for _, rec := range claimed {
+		var event Event
+		if err := json.Unmarshal(rec.Payload, &event); err != nil {
+			log.Printf("Skipping sinks for undecodable event %s: %v", rec.ID, err)
+			continue
+		}
+		batch = append(batch, event)
+	}
+	for _, sink := range p.sinks {
+		if err := sink(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relayBackoff doubles from one second up to maxRelayDelay.
+func relayBackoff(attempts int) time.Duration {
+	if attempts > 10 {
+		return maxRelayDelay
+	}
+	d := time.Second << (attempts - 1)
+	if d > maxRelayDelay {
+		return maxRelayDelay
+	}
+	return d
+}
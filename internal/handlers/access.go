@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/services"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RequireMediaAccess checks the caller has want on the media named by the
+// :id or :mediaId route parameter, and passes the loaded media on in the
+// request context.
+func RequireMediaAccess(policy *services.AccessPolicy, want services.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mediaID := c.Param("id")
+		if mediaID == "" {
+			mediaID = c.Param("mediaId")
+		}
+		ctx := c.Request.Context()
+		media, err := policy.LoadMedia(ctx, services.PrincipalFrom(ctx), mediaID, want)
+		if err != nil {
+			abortAccess(c, err)
+			return
+		}
+		c.Request = c.Request.WithContext(services.WithMedia(ctx, media))
+		c.Next()
+	}
+}
+
+// RequireWorkspaceRole checks the caller holds at least want in
+// :workspaceId.
+func RequireWorkspaceRole(policy *services.AccessPolicy, want services.WorkspaceRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if err := policy.RequireRole(ctx, services.PrincipalFrom(ctx), c.Param("workspaceId"), want); err != nil {
+			abortAccess(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePlatformAdmin checks the caller is a platform admin.
+func RequirePlatformAdmin(policy *services.AccessPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := policy.RequirePlatformAdmin(services.PrincipalFrom(c.Request.Context())); err != nil {
+			abortAccess(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireChannelMember checks the caller belongs to :channelId.
+func RequireChannelMember(policy *services.AccessPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := policy.RequireChannel(services.PrincipalFrom(c.Request.Context()), c.Param("channelId")); err != nil {
+			abortAccess(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSelf checks :userId is the caller.
+func RequireSelf(policy *services.AccessPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := policy.RequireSelf(services.PrincipalFrom(c.Request.Context()), c.Param("userId")); err != nil {
+			abortAccess(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortAccess(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrForbidden):
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"success": false, "error": "forbidden"})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"success": false, "error": "Media not found"})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+	}
+}
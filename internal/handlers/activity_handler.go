@@ -1,13 +1,20 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/quckapp/media-service/internal/services"
 )
 
+const sseHeartbeat = 15 * time.Second
+
 type ActivityHandler struct {
 	service *services.ActivityService
 }
@@ -41,3 +48,72 @@ func (h *ActivityHandler) GetByUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": activities})
 }
+
+func activityFilter(c *gin.Context) services.ActivityFilter {
+	f := services.ActivityFilter{
+		ActorID:   c.Query("userId"),
+		MediaType: c.Query("mediaType"),
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+	}
+	for _, action := range strings.Split(c.Query("action"), ",") {
+		if action = strings.TrimSpace(action); action != "" {
+			f.Actions = append(f.Actions, action)
+		}
+	}
+	return f
+}
+
+func (h *ActivityHandler) GetWorkspaceFeed(c *gin.Context) {
+	workspaceID := c.Param("workspaceId")
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+
+	feed, err := h.service.GetWorkspaceFeed(c.Request.Context(), workspaceID, activityFilter(c), c.Query("cursor"), limit)
+	if err != nil {
+		respondAnalyticsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": feed})
+}
+
+// StreamWorkspace sends matching activity as Server-Sent Events. Each event
+// id is the entry's chain seq, so a reconnecting EventSource resumes from
+// Last-Event-ID.
+func (h *ActivityHandler) StreamWorkspace(c *gin.Context) {
+	workspaceID := c.Param("workspaceId")
+	afterSeq, _ := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64)
+
+	entries, err := h.service.SubscribeWorkspace(c.Request.Context(), workspaceID, activityFilter(c), afterSeq)
+	if err != nil {
+		respondAnalyticsError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				return false
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return true
+			}
+			fmt.Fprintf(w, "id: %d\nevent: activity\ndata: %s\n\n", entry.Seq, data)
+		case <-heartbeat.C:
+			// Comment line keeps proxies from closing an idle stream
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		return true
+	})
+}
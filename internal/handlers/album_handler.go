@@ -11,10 +11,11 @@ import (
 
 type AlbumHandler struct {
 	service *services.AlbumService
+	policy  *services.AccessPolicy
 }
 
-func NewAlbumHandler(service *services.AlbumService) *AlbumHandler {
-	return &AlbumHandler{service: service}
+func NewAlbumHandler(service *services.AlbumService, policy *services.AccessPolicy) *AlbumHandler {
+	return &AlbumHandler{service: service, policy: policy}
 }
 
 func (h *AlbumHandler) Create(c *gin.Context) {
@@ -43,6 +44,10 @@ func (h *AlbumHandler) GetByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Album not found"})
 		return
 	}
+	if err := h.policy.RequireCollection(c.Request.Context(), services.PrincipalFrom(c.Request.Context()), album.UserID, album.WorkspaceID, album.IsPublic); err != nil {
+		abortAccess(c, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": album})
 }
@@ -126,6 +131,12 @@ func (h *AlbumHandler) AddMedia(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
+	// Albums can be public, so only media the caller may share onwards
+	// can be added
+	if err := h.policy.RequireMediaAll(c.Request.Context(), services.PrincipalFrom(c.Request.Context()), req.MediaIDs, services.PermDownload); err != nil {
+		abortAccess(c, err)
+		return
+	}
 
 	if err := h.service.AddMedia(c.Request.Context(), albumID, userID, req.MediaIDs); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/services"
+)
+
+// Flush to the client every flushEvery rows so large exports stream.
+const flushEvery = 500
+
+// exportSink writes report rows straight to the response. The status and
+// headers are sent on Columns, so errors before that point can still become
+// a JSON error response.
+type exportSink interface {
+	services.ExportSink
+	started() bool
+	flush()
+}
+
+type exportResponse struct {
+	c           *gin.Context
+	contentType string
+	filename    string
+	rows        int
+	sent        bool
+}
+
+func (r *exportResponse) start() {
+	r.c.Header("Content-Type", r.contentType)
+	r.c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", r.filename))
+	r.c.Header("Cache-Control", "no-store")
+	r.c.Status(http.StatusOK)
+	r.sent = true
+}
+
+func (r *exportResponse) started() bool {
+	return r.sent
+}
+
+type csvExportSink struct {
+	exportResponse
+	w *csv.Writer
+}
+
+func newCSVExportSink(c *gin.Context, filename string) *csvExportSink {
+	return &csvExportSink{
+		exportResponse: exportResponse{c: c, contentType: "text/csv; charset=utf-8", filename: filename},
+		w:              csv.NewWriter(c.Writer),
+	}
+}
+
+func (s *csvExportSink) Columns(names ...string) error {
+	s.start()
+	return s.w.Write(names)
+}
+
+func (s *csvExportSink) Row(values ...interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = csvSafe(formatExportValue(v))
+	}
+	if err := s.w.Write(record); err != nil {
+		return err
+	}
+	if s.rows++; s.rows%flushEvery == 0 {
+		s.flush()
+	}
+	return s.w.Error()
+}
+
+func (s *csvExportSink) flush() {
+	s.w.Flush()
+	s.c.Writer.Flush()
+}
+
+type ndjsonExportSink struct {
+	exportResponse
+	columns []string
+	buf     bytes.Buffer
+}
+
+func newNDJSONExportSink(c *gin.Context, filename string) *ndjsonExportSink {
+	return &ndjsonExportSink{
+		exportResponse: exportResponse{c: c, contentType: "application/x-ndjson", filename: filename},
+	}
+}
+
+func (s *ndjsonExportSink) Columns(names ...string) error {
+	s.columns = names
+	s.start()
+	return nil
+}
+
+// Row writes one object per line with keys in column order.
+func (s *ndjsonExportSink) Row(values ...interface{}) error {
+	s.buf.Reset()
+	s.buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			s.buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(s.columns[i])
+		value, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		s.buf.Write(key)
+		s.buf.WriteByte(':')
+		s.buf.Write(value)
+	}
+	s.buf.WriteString("}\n")
+	if _, err := s.c.Writer.Write(s.buf.Bytes()); err != nil {
+		return err
+	}
+	if s.rows++; s.rows%flushEvery == 0 {
+		s.flush()
+	}
+	return nil
+}
+
+func (s *ndjsonExportSink) flush() {
+	s.c.Writer.Flush()
+}
+
+func (h *AnalyticsHandler) Export(c *gin.Context) {
+	workspaceID := c.Param("workspaceId")
+	report := c.Param("report")
+
+	format := c.DefaultQuery("format", "csv")
+	filename := fmt.Sprintf("%s-%s-%s.%s", report, workspaceID, time.Now().UTC().Format("20060102"), format)
+	var sink exportSink
+	switch format {
+	case "csv":
+		sink = newCSVExportSink(c, filename)
+	case "ndjson":
+		sink = newNDJSONExportSink(c, filename)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "format must be csv or ndjson"})
+		return
+	}
+
+	if err := h.service.Export(c.Request.Context(), workspaceID, report, trendQuery(c), sink); err != nil {
+		if !sink.started() {
+			respondAnalyticsError(c, err)
+			return
+		}
+		// Too late for an error status; the body is truncated instead
+		_ = c.Error(err)
+	}
+	sink.flush()
+}
+
+func formatExportValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 3, 64)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// csvSafe stops spreadsheets from evaluating user-controlled cells such as
+// filenames as formulas.
+func csvSafe(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		if _, err := strconv.ParseFloat(cell, 64); err != nil {
+			return "'" + cell
+		}
+	}
+	return cell
+}
@@ -1,11 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/quckapp/media-service/internal/services"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AnalyticsHandler struct {
@@ -18,11 +20,9 @@ func NewAnalyticsHandler(service *services.AnalyticsService) *AnalyticsHandler {
 
 func (h *AnalyticsHandler) GetUploadTrends(c *gin.Context) {
 	workspaceID := c.Param("workspaceId")
-	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
-
-	trends, err := h.service.GetUploadTrends(c.Request.Context(), workspaceID, days)
+	trends, err := h.service.GetUploadTrends(c.Request.Context(), workspaceID, trendQuery(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		respondAnalyticsError(c, err)
 		return
 	}
 
@@ -31,11 +31,9 @@ func (h *AnalyticsHandler) GetUploadTrends(c *gin.Context) {
 
 func (h *AnalyticsHandler) GetStorageTrends(c *gin.Context) {
 	workspaceID := c.Param("workspaceId")
-	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
-
-	trends, err := h.service.GetStorageTrends(c.Request.Context(), workspaceID, days)
+	trends, err := h.service.GetStorageTrends(c.Request.Context(), workspaceID, trendQuery(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		respondAnalyticsError(c, err)
 		return
 	}
 
@@ -66,3 +64,80 @@ func (h *AnalyticsHandler) GetUserUploadStats(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": stats})
 }
+
+func (h *AnalyticsHandler) GetMostViewed(c *gin.Context) {
+	workspaceID := c.Param("workspaceId")
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "20"), 10, 64)
+
+	usage, err := h.service.GetMostViewed(c.Request.Context(), workspaceID, days, limit)
+	if err != nil {
+		respondAnalyticsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": usage})
+}
+
+func (h *AnalyticsHandler) GetUniqueViewers(c *gin.Context) {
+	workspaceID := c.Param("workspaceId")
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+
+	count, err := h.service.GetUniqueViewers(c.Request.Context(), workspaceID, days)
+	if err != nil {
+		respondAnalyticsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"days": days, "uniqueViewers": count}})
+}
+
+func (h *AnalyticsHandler) GetNeverAccessed(c *gin.Context) {
+	workspaceID := c.Param("workspaceId")
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+
+	media, err := h.service.GetNeverAccessed(c.Request.Context(), workspaceID, days, limit)
+	if err != nil {
+		respondAnalyticsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": media})
+}
+
+func (h *AnalyticsHandler) GetMediaUsage(c *gin.Context) {
+	mediaID := c.Param("id")
+
+	report, err := h.service.GetMediaUsage(c.Request.Context(), mediaID, trendQuery(c))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Media not found"})
+			return
+		}
+		respondAnalyticsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": report})
+}
+
+func trendQuery(c *gin.Context) services.TrendQuery {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+	return services.TrendQuery{
+		Days:     days,
+		Interval: c.DefaultQuery("interval", "day"),
+		Timezone: c.DefaultQuery("tz", "UTC"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+	}
+}
+
+func respondAnalyticsError(c *gin.Context, err error) {
+	var paramErr *services.InvalidParamError
+	if errors.As(err, &paramErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": paramErr.Error(), "details": paramErr})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+}
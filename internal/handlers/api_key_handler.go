@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/models"
+	"github.com/quckapp/media-service/internal/services"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type APIKeyHandler struct {
+	service *services.APIKeyService
+}
+
+func NewAPIKeyHandler(service *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{service: service}
+}
+
+// Create returns the new key in full; this is the only time it is shown.
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	key, err := h.service.Create(c.Request.Context(), userID, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": key})
+}
+
+func (h *APIKeyHandler) List(c *gin.Context) {
+	keys, err := h.service.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": keys})
+}
+
+func (h *APIKeyHandler) Get(c *gin.Context) {
+	key, err := h.service.Get(c.Request.Context(), c.Param("keyId"))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "API key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": key})
+}
+
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	key, err := h.service.Revoke(c.Request.Context(), c.Param("keyId"))
+	if err == mongo.ErrNoDocuments {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "API key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": key})
+}
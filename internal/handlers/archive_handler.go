@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/models"
+	"github.com/quckapp/media-service/internal/services"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ArchiveHandler struct {
+	service *services.ArchiveService
+}
+
+func NewArchiveHandler(service *services.ArchiveService) *ArchiveHandler {
+	return &ArchiveHandler{service: service}
+}
+
+// Create streams a ZIP of the requested media. Archives too big to stream,
+// or requested with async, are built by a background job instead and the
+// job is returned with 202.
+func (h *ArchiveHandler) Create(c *gin.Context) {
+	userID := c.GetString("userID")
+	ctx := c.Request.Context()
+
+	var req models.CreateArchiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	plan, err := h.service.Plan(ctx, services.PrincipalFrom(ctx), &req)
+	if err != nil {
+		respondArchiveError(c, err)
+		return
+	}
+
+	if req.Async || !plan.Streamable() {
+		job, err := h.service.StartJob(ctx, userID, plan)
+		if err != nil {
+			respondArchiveError(c, err)
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"success": true, "data": job})
+		return
+	}
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": plan.Filename}))
+	c.Header("X-Archive-Items", strconv.Itoa(len(plan.Items)))
+	c.Header("X-Archive-Skipped", strconv.Itoa(plan.Skipped))
+	c.Status(http.StatusOK)
+	if err := h.service.Write(ctx, c.Writer, plan, userID); err != nil {
+		// Too late for an error response; the truncated archive won't open
+		c.Error(err)
+	}
+}
+
+func respondArchiveError(c *gin.Context, err error) {
+	var paramErr *services.InvalidParamError
+	var queryErr *services.QueryError
+	switch {
+	case errors.As(err, &paramErr):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": paramErr.Error(), "details": paramErr})
+	case errors.As(err, &queryErr):
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": queryErr.Error(), "details": queryErr})
+	case errors.Is(err, services.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+	case errors.Is(err, services.ErrArchiveTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": err.Error()})
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+	}
+}
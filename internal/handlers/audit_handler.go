@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/services"
+)
+
+type AuditHandler struct {
+	service *services.AuditLogService
+}
+
+func NewAuditHandler(service *services.AuditLogService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+func (h *AuditHandler) Verify(c *gin.Context) {
+	rng, err := h.service.ResolveAuditRange(c.Request.Context(), c.Param("workspaceId"), c.Query("from"), c.Query("to"))
+	if err != nil {
+		respondAnalyticsError(c, err)
+		return
+	}
+
+	result, err := h.service.Verify(c.Request.Context(), rng)
+	if err != nil {
+		respondAnalyticsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+func (h *AuditHandler) Export(c *gin.Context) {
+	if h.service.PublicKey() == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": services.ErrAuditSigningDisabled.Error()})
+		return
+	}
+
+	workspaceID := c.Param("workspaceId")
+	rng, err := h.service.ResolveAuditRange(c.Request.Context(), workspaceID, c.Query("from"), c.Query("to"))
+	if err != nil {
+		respondAnalyticsError(c, err)
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s-%s.zip", workspaceID, time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+	if err := h.service.ExportBundle(c.Request.Context(), rng, c.Writer); err != nil {
+		// Headers are already sent; the truncated zip fails to open
+		_ = c.Error(err)
+	}
+}
+
+func (h *AuditHandler) GetPublicKey(c *gin.Context) {
+	key := h.service.PublicKey()
+	if key == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"success": false, "error": services.ErrAuditSigningDisabled.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"algorithm": "ed25519", "publicKey": key}})
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/services"
+)
+
+type ChargebackHandler struct {
+	service *services.ChargebackService
+}
+
+func NewChargebackHandler(service *services.ChargebackService) *ChargebackHandler {
+	return &ChargebackHandler{service: service}
+}
+
+func (h *ChargebackHandler) GetInvoice(c *gin.Context) {
+	workspaceID := c.Param("workspaceId")
+
+	invoice, err := h.service.GetInvoice(c.Request.Context(), workspaceID, c.Query("month"))
+	if err != nil {
+		respondAnalyticsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": invoice})
+}
+
+func (h *ChargebackHandler) GetPricing(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": h.service.Pricing()})
+}
@@ -50,9 +50,10 @@ func (h *CommentHandler) GetByMedia(c *gin.Context) {
 }
 
 func (h *CommentHandler) GetReplies(c *gin.Context) {
+	mediaID := c.Param("id")
 	commentID := c.Param("commentId")
 
-	replies, err := h.service.GetReplies(c.Request.Context(), commentID)
+	replies, err := h.service.GetReplies(c.Request.Context(), mediaID, commentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/models"
+	"github.com/quckapp/media-service/internal/services"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type EncryptionHandler struct {
+	service *services.EncryptionService
+}
+
+func NewEncryptionHandler(service *services.EncryptionService) *EncryptionHandler {
+	return &EncryptionHandler{service: service}
+}
+
+func (h *EncryptionHandler) Get(c *gin.Context) {
+	settings, err := h.service.Get(c.Request.Context(), c.Param("workspaceId"))
+	if err != nil {
+		respondEncryptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+func (h *EncryptionHandler) Enable(c *gin.Context) {
+	var req models.EnableEncryptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	settings, err := h.service.Enable(c.Request.Context(), c.Param("workspaceId"), c.GetString("userID"), &req)
+	if err != nil {
+		respondEncryptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": settings})
+}
+
+func (h *EncryptionHandler) Rotate(c *gin.Context) {
+	result, err := h.service.Rotate(c.Request.Context(), c.Param("workspaceId"))
+	if err != nil {
+		respondEncryptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
+}
+
+// GetContent serves decrypted media to holders of a signed content URL,
+// with range support for playback.
+func (h *EncryptionHandler) GetContent(c *gin.Context) {
+	ctx := c.Request.Context()
+	mediaID := c.Param("id")
+	if err := h.service.VerifyContentURL(http.MethodGet, mediaID, c.Request.URL.Query()); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	media, err := h.service.Media(ctx, mediaID)
+	if err != nil {
+		respondEncryptionError(c, err)
+		return
+	}
+	if media.Encryption == nil {
+		// Restored to an unencrypted version since the URL was signed
+		c.JSON(http.StatusGone, gin.H{"success": false, "error": "Media is no longer encrypted; request a new URL"})
+		return
+	}
+
+	body, err := h.service.Open(ctx, media)
+	if err != nil {
+		respondEncryptionError(c, err)
+		return
+	}
+	defer body.Close()
+
+	disposition := "inline"
+	if c.Query("disposition") == "attachment" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Type", media.MimeType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": media.Filename}))
+	c.Header("Cache-Control", "private, no-store")
+	http.ServeContent(c.Writer, c.Request, media.Filename, media.UpdatedAt, body)
+}
+
+// PutContent takes the upload of encrypted media and encrypts it on the
+// way to S3. It is the upload URL given out instead of a presigned one.
+func (h *EncryptionHandler) PutContent(c *gin.Context) {
+	ctx := c.Request.Context()
+	mediaID := c.Param("id")
+	if err := h.service.VerifyContentURL(http.MethodPut, mediaID, c.Request.URL.Query()); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	media, err := h.service.Media(ctx, mediaID)
+	if err != nil {
+		respondEncryptionError(c, err)
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, media.Size)
+	if err := h.service.Store(ctx, media, body); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"success": false, "error": "Upload is larger than the declared size"})
+			return
+		}
+		respondEncryptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Media uploaded"})
+}
+
+func respondEncryptionError(c *gin.Context, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Not found"})
+	case errors.Is(err, services.ErrEncryptionDisabled):
+		c.JSON(http.StatusNotImplemented, gin.H{"success": false, "error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+	}
+}
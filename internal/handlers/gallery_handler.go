@@ -11,10 +11,11 @@ import (
 
 type GalleryHandler struct {
 	service *services.GalleryService
+	policy  *services.AccessPolicy
 }
 
-func NewGalleryHandler(service *services.GalleryService) *GalleryHandler {
-	return &GalleryHandler{service: service}
+func NewGalleryHandler(service *services.GalleryService, policy *services.AccessPolicy) *GalleryHandler {
+	return &GalleryHandler{service: service, policy: policy}
 }
 
 func (h *GalleryHandler) Create(c *gin.Context) {
@@ -56,6 +57,10 @@ func (h *GalleryHandler) Get(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Gallery not found"})
 		return
 	}
+	if err := h.policy.RequireCollection(c.Request.Context(), services.PrincipalFrom(c.Request.Context()), gallery.CreatedBy, gallery.WorkspaceID, gallery.IsPublic); err != nil {
+		abortAccess(c, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": gallery})
 }
@@ -69,6 +74,12 @@ func (h *GalleryHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
+	if req.MediaIDs != nil {
+		if err := h.policy.RequireMediaAll(c.Request.Context(), services.PrincipalFrom(c.Request.Context()), req.MediaIDs, services.PermDownload); err != nil {
+			abortAccess(c, err)
+			return
+		}
+	}
 
 	gallery, err := h.service.Update(c.Request.Context(), galleryID, userID, &req)
 	if err != nil {
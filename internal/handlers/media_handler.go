@@ -10,23 +10,40 @@ import (
 )
 
 type MediaHandler struct {
-	service *services.MediaService
+	service   *services.MediaService
+	analytics *services.AnalyticsService
+	policy    *services.AccessPolicy
 }
 
-func NewMediaHandler(service *services.MediaService) *MediaHandler {
-	return &MediaHandler{service: service}
+func NewMediaHandler(service *services.MediaService, analytics *services.AnalyticsService, policy *services.AccessPolicy) *MediaHandler {
+	return &MediaHandler{service: service, analytics: analytics, policy: policy}
 }
 
-func (h *MediaHandler) Upload(c *gin.Context) {
-	userID := c.GetString("userID")
-
+// bindUpload binds an upload request, which may only name a workspace the
+// caller is a member of.
+func (h *MediaHandler) bindUpload(c *gin.Context) (*models.UploadRequest, bool) {
 	var req models.UploadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return nil, false
+	}
+	ctx := c.Request.Context()
+	if err := h.policy.RequirePlacement(ctx, services.PrincipalFrom(ctx), req.WorkspaceID, req.ChannelID); err != nil {
+		abortAccess(c, err)
+		return nil, false
+	}
+	return &req, true
+}
+
+func (h *MediaHandler) Upload(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	req, ok := h.bindUpload(c)
+	if !ok {
 		return
 	}
 
-	media, err := h.service.Create(c.Request.Context(), userID, &req)
+	media, err := h.service.Create(c.Request.Context(), userID, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
@@ -38,13 +55,12 @@ func (h *MediaHandler) Upload(c *gin.Context) {
 func (h *MediaHandler) GetPresignedURL(c *gin.Context) {
 	userID := c.GetString("userID")
 
-	var req models.UploadRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+	req, ok := h.bindUpload(c)
+	if !ok {
 		return
 	}
 
-	resp, err := h.service.GetPresignedUploadURL(c.Request.Context(), userID, &req)
+	resp, err := h.service.GetPresignedUploadURL(c.Request.Context(), userID, req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
@@ -62,9 +78,24 @@ func (h *MediaHandler) Get(c *gin.Context) {
 		return
 	}
 
+	h.analytics.RecordAccess(c.Request.Context(), media.ID, c.GetString("userID"), services.AccessView)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": media})
 }
 
+// GetStreamURL returns a short-lived URL for in-app playback and records a stream.
+func (h *MediaHandler) GetStreamURL(c *gin.Context) {
+	mediaID := c.Param("id")
+
+	url, err := h.service.GetDownloadURL(c.Request.Context(), mediaID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Media not found"})
+		return
+	}
+
+	h.analytics.RecordAccess(c.Request.Context(), mediaID, c.GetString("userID"), services.AccessStream)
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"streamUrl": url}})
+}
+
 func (h *MediaHandler) Delete(c *gin.Context) {
 	mediaID := c.Param("id")
 	userID := c.GetString("userID")
@@ -156,7 +187,23 @@ func (h *MediaHandler) UpdateMetadata(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.UpdateMetadata(c.Request.Context(), mediaID, userID, metadata); err != nil {
+	// Changing the workspace or channel needs membership of the new one
+	ctx := c.Request.Context()
+	workspaceID, channelID := metadata["workspaceId"], metadata["channelId"]
+	if current, ok := services.MediaFrom(ctx, mediaID); ok {
+		if workspaceID == current.Metadata["workspaceId"] {
+			workspaceID = ""
+		}
+		if channelID == current.Metadata["channelId"] {
+			channelID = ""
+		}
+	}
+	if err := h.policy.RequirePlacement(ctx, services.PrincipalFrom(ctx), workspaceID, channelID); err != nil {
+		abortAccess(c, err)
+		return
+	}
+
+	if err := h.service.UpdateMetadata(ctx, mediaID, userID, metadata); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
@@ -1,39 +1,118 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/quckapp/media-service/internal/auth"
+	"github.com/quckapp/media-service/internal/services"
 )
 
-func AuthMiddleware(secret string) gin.HandlerFunc {
+// RequestInfoMiddleware puts the client IP and user agent on the request
+// context so services can attribute audit entries.
+func RequestInfoMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing authorization"})
-			return
-		}
+		info := services.RequestInfoFrom(c.Request.Context())
+		info.IP = c.ClientIP()
+		info.UserAgent = c.Request.UserAgent()
+		c.Request = c.Request.WithContext(services.WithRequestInfo(c.Request.Context(), info))
+		c.Next()
+	}
+}
 
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
+// Header carrying the API keys of other backend services
+const apiKeyHeader = "X-API-Key"
 
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+// AuthMiddleware requires a bearer token accepted by verifier, or an API
+// key, and puts the caller's principal on the request context.
+func AuthMiddleware(verifier *auth.Verifier, apiKeys *services.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key := c.GetHeader(apiKeyHeader); key != "" {
+			authenticateAPIKey(c, apiKeys, key)
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
+		tokenString, ok := bearerToken(c.GetHeader("Authorization"))
 		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid claims"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing authorization"})
 			return
 		}
 
-		c.Set("userID", claims["sub"])
+		claims, err := verifier.Verify(c.Request.Context(), tokenString)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		c.Set("userID", claims.Subject)
+		info := services.RequestInfoFrom(c.Request.Context())
+		info.ActorID = claims.Subject
+		principal := &services.Principal{
+			UserID:         claims.Subject,
+			WorkspaceIDs:   claims.WorkspaceIDs(),
+			ChannelIDs:     claims.ChannelIDs(),
+			Roles:          claims.RoleNames(),
+			WorkspaceRoles: claims.WorkspaceRoles,
+		}
+		ctx := services.WithRequestInfo(c.Request.Context(), info)
+		c.Request = c.Request.WithContext(services.WithPrincipal(ctx, principal))
 		c.Next()
 	}
 }
+
+func authenticateAPIKey(c *gin.Context, apiKeys *services.APIKeyService, raw string) {
+	key, err := apiKeys.Authenticate(c.Request.Context(), raw)
+	if errors.Is(err, services.ErrInvalidAPIKey) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	principal := &services.Principal{
+		UserID:       services.APIKeyUserID(key.ID),
+		WorkspaceIDs: key.WorkspaceIDs,
+		KeyID:        key.ID,
+		Scopes:       key.Scopes,
+		AnyWorkspace: len(key.WorkspaceIDs) == 0,
+	}
+	if scope := requiredScope(c.Request.Method, c.FullPath()); !principal.HasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + scope + " scope"})
+		return
+	}
+
+	c.Set("userID", principal.UserID)
+	info := services.RequestInfoFrom(c.Request.Context())
+	info.ActorID = principal.UserID
+	ctx := services.WithRequestInfo(c.Request.Context(), info)
+	c.Request = c.Request.WithContext(services.WithPrincipal(ctx, principal))
+	c.Next()
+}
+
+// requiredScope is the scope an API key needs for a route: jobs:write to
+// start or cancel processing jobs, media:read for other reads and
+// media:write for everything else. Admin routes also check roles, which
+// keys only hold with the admin scope.
+func requiredScope(method, route string) string {
+	read := method == http.MethodGet || method == http.MethodHead
+	switch {
+	case !read && (strings.HasSuffix(route, "/process") || strings.HasPrefix(route, "/api/v1/media/jobs/")):
+		return services.ScopeJobsWrite
+	case read:
+		return services.ScopeMediaRead
+	}
+	return services.ScopeMediaWrite
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
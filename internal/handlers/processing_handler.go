@@ -11,10 +11,11 @@ import (
 
 type ProcessingHandler struct {
 	service *services.ProcessingService
+	policy  *services.AccessPolicy
 }
 
-func NewProcessingHandler(service *services.ProcessingService) *ProcessingHandler {
-	return &ProcessingHandler{service: service}
+func NewProcessingHandler(service *services.ProcessingService, policy *services.AccessPolicy) *ProcessingHandler {
+	return &ProcessingHandler{service: service, policy: policy}
 }
 
 func (h *ProcessingHandler) CreateJob(c *gin.Context) {
@@ -44,6 +45,12 @@ func (h *ProcessingHandler) GetJob(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Job not found"})
 		return
 	}
+	if job.UserID != c.GetString("userID") {
+		if err := h.policy.RequireMedia(c.Request.Context(), services.PrincipalFrom(c.Request.Context()), job.MediaID, services.PermView); err != nil {
+			abortAccess(c, err)
+			return
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": job})
 }
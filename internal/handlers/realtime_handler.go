@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/services"
+)
+
+type RealtimeHandler struct {
+	service *services.RealtimeService
+}
+
+func NewRealtimeHandler(service *services.RealtimeService) *RealtimeHandler {
+	return &RealtimeHandler{service: service}
+}
+
+func splitQuery(c *gin.Context, key string) []string {
+	var out []string
+	for _, v := range strings.Split(c.Query(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Stream pushes live updates as server-sent events. Query parameters media,
+// channel and workspace take comma-separated IDs to follow.
+func (h *RealtimeHandler) Stream(c *gin.Context) {
+	sub, err := h.service.Subscribe(c.Request.Context(), services.PrincipalFrom(c.Request.Context()), services.RealtimeTopics{
+		MediaIDs:     splitQuery(c, "media"),
+		ChannelIDs:   splitQuery(c, "channel"),
+		WorkspaceIDs: splitQuery(c, "workspace"),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrForbidden) {
+			abortAccess(c, err)
+			return
+		}
+		respondAnalyticsError(c, err)
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	ctx := c.Request.Context()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case update, ok := <-sub.C:
+			if !ok {
+				return false
+			}
+			data, err := json.Marshal(update)
+			if err != nil {
+				return true
+			}
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", update.ID, update.Type, data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		return true
+	})
+}
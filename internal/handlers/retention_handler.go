@@ -10,10 +10,11 @@ import (
 
 type RetentionHandler struct {
 	service *services.RetentionService
+	policy  *services.AccessPolicy
 }
 
-func NewRetentionHandler(service *services.RetentionService) *RetentionHandler {
-	return &RetentionHandler{service: service}
+func NewRetentionHandler(service *services.RetentionService, policy *services.AccessPolicy) *RetentionHandler {
+	return &RetentionHandler{service: service, policy: policy}
 }
 
 func (h *RetentionHandler) Create(c *gin.Context) {
@@ -24,8 +25,13 @@ func (h *RetentionHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
+	ctx := c.Request.Context()
+	if err := h.policy.RequireRole(ctx, services.PrincipalFrom(ctx), req.WorkspaceID, services.RoleAdmin); err != nil {
+		abortAccess(c, err)
+		return
+	}
 
-	policy, err := h.service.Create(c.Request.Context(), userID, &req)
+	policy, err := h.service.Create(ctx, userID, &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
@@ -35,11 +41,8 @@ func (h *RetentionHandler) Create(c *gin.Context) {
 }
 
 func (h *RetentionHandler) Get(c *gin.Context) {
-	policyID := c.Param("policyId")
-
-	policy, err := h.service.GetByID(c.Request.Context(), policyID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Policy not found"})
+	policy, ok := h.requirePolicyRole(c, services.RoleMember)
+	if !ok {
 		return
 	}
 
@@ -47,16 +50,17 @@ func (h *RetentionHandler) Get(c *gin.Context) {
 }
 
 func (h *RetentionHandler) Update(c *gin.Context) {
-	userID := c.GetString("userID")
-	policyID := c.Param("policyId")
-
 	var req models.UpdateRetentionPolicyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
+	existing, ok := h.requirePolicyRole(c, services.RoleAdmin)
+	if !ok {
+		return
+	}
 
-	policy, err := h.service.Update(c.Request.Context(), policyID, userID, &req)
+	policy, err := h.service.Update(c.Request.Context(), existing.ID, &req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
@@ -66,10 +70,12 @@ func (h *RetentionHandler) Update(c *gin.Context) {
 }
 
 func (h *RetentionHandler) Delete(c *gin.Context) {
-	userID := c.GetString("userID")
-	policyID := c.Param("policyId")
+	policy, ok := h.requirePolicyRole(c, services.RoleAdmin)
+	if !ok {
+		return
+	}
 
-	if err := h.service.Delete(c.Request.Context(), policyID, userID); err != nil {
+	if err := h.service.Delete(c.Request.Context(), policy.ID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
@@ -88,3 +94,20 @@ func (h *RetentionHandler) GetByWorkspace(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": policies})
 }
+
+// requirePolicyRole loads :policyId and checks the caller holds want in
+// its workspace. Policies are managed by workspace admins rather than
+// whoever created them.
+func (h *RetentionHandler) requirePolicyRole(c *gin.Context, want services.WorkspaceRole) (*models.RetentionPolicy, bool) {
+	ctx := c.Request.Context()
+	policy, err := h.service.GetByID(ctx, c.Param("policyId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Policy not found"})
+		return nil, false
+	}
+	if err := h.policy.RequireRole(ctx, services.PrincipalFrom(ctx), policy.WorkspaceID, want); err != nil {
+		abortAccess(c, err)
+		return nil, false
+	}
+	return policy, true
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/models"
+	"github.com/quckapp/media-service/internal/services"
+)
+
+type SavedSearchHandler struct {
+	service *services.SavedSearchService
+}
+
+func NewSavedSearchHandler(service *services.SavedSearchService) *SavedSearchHandler {
+	return &SavedSearchHandler{service: service}
+}
+
+func (h *SavedSearchHandler) Create(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.CreateSavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	saved, err := h.service.Create(c.Request.Context(), userID, &req)
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": saved})
+}
+
+func (h *SavedSearchHandler) List(c *gin.Context) {
+	userID := c.GetString("userID")
+	pinned := c.Query("pinned") == "true"
+
+	searches, err := h.service.List(c.Request.Context(), userID, pinned)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": searches})
+}
+
+func (h *SavedSearchHandler) Get(c *gin.Context) {
+	userID := c.GetString("userID")
+	searchID := c.Param("searchId")
+
+	saved, err := h.service.GetByID(c.Request.Context(), searchID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Saved search not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": saved})
+}
+
+func (h *SavedSearchHandler) Update(c *gin.Context) {
+	userID := c.GetString("userID")
+	searchID := c.Param("searchId")
+
+	var req models.UpdateSavedSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	saved, err := h.service.Update(c.Request.Context(), searchID, userID, &req)
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": saved})
+}
+
+func (h *SavedSearchHandler) Delete(c *gin.Context) {
+	userID := c.GetString("userID")
+	searchID := c.Param("searchId")
+
+	if err := h.service.Delete(c.Request.Context(), searchID, userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Saved search deleted"})
+}
+
+func (h *SavedSearchHandler) Run(c *gin.Context) {
+	userID := c.GetString("userID")
+	searchID := c.Param("searchId")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	result, err := h.service.Run(c.Request.Context(), searchID, userID, page, limit)
+	if err != nil {
+		respondSearchError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    result.Media,
+		"total":   result.Total,
+		"page":    page,
+		"limit":   limit,
+	})
+}
+
+func (h *SavedSearchHandler) Pin(c *gin.Context) {
+	userID := c.GetString("userID")
+	searchID := c.Param("searchId")
+
+	if err := h.service.SetPinned(c.Request.Context(), searchID, userID, true); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Saved search pinned"})
+}
+
+func (h *SavedSearchHandler) Unpin(c *gin.Context) {
+	userID := c.GetString("userID")
+	searchID := c.Param("searchId")
+
+	if err := h.service.SetPinned(c.Request.Context(), searchID, userID, false); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Saved search unpinned"})
+}
+
+func (h *SavedSearchHandler) ListSmartAlbums(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	albums, err := h.service.ListSmartAlbums(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": albums})
+}
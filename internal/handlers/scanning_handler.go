@@ -11,10 +11,11 @@ import (
 
 type ScanningHandler struct {
 	service *services.ScanningService
+	policy  *services.AccessPolicy
 }
 
-func NewScanningHandler(service *services.ScanningService) *ScanningHandler {
-	return &ScanningHandler{service: service}
+func NewScanningHandler(service *services.ScanningService, policy *services.AccessPolicy) *ScanningHandler {
+	return &ScanningHandler{service: service, policy: policy}
 }
 
 func (h *ScanningHandler) ScanMedia(c *gin.Context) {
@@ -23,8 +24,13 @@ func (h *ScanningHandler) ScanMedia(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
+	ctx := c.Request.Context()
+	if err := h.policy.RequireMedia(ctx, services.PrincipalFrom(ctx), req.MediaID, services.PermEdit); err != nil {
+		abortAccess(c, err)
+		return
+	}
 
-	scan, err := h.service.ScanMedia(c.Request.Context(), &req)
+	scan, err := h.service.ScanMedia(ctx, &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -12,10 +13,12 @@ import (
 type SearchHandler struct {
 	service     *services.SearchService
 	mediaSvc    *services.MediaService
+	analytics   *services.AnalyticsService
+	policy      *services.AccessPolicy
 }
 
-func NewSearchHandler(service *services.SearchService, mediaSvc *services.MediaService) *SearchHandler {
-	return &SearchHandler{service: service, mediaSvc: mediaSvc}
+func NewSearchHandler(service *services.SearchService, mediaSvc *services.MediaService, analytics *services.AnalyticsService, policy *services.AccessPolicy) *SearchHandler {
+	return &SearchHandler{service: service, mediaSvc: mediaSvc, analytics: analytics, policy: policy}
 }
 
 func (h *SearchHandler) Search(c *gin.Context) {
@@ -27,19 +30,23 @@ func (h *SearchHandler) Search(c *gin.Context) {
 		return
 	}
 
-	media, total, err := h.service.Search(c.Request.Context(), userID, params)
+	result, err := h.service.Search(c.Request.Context(), userID, params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		respondSearchError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"success": true,
-		"data":    media,
-		"total":   total,
+		"data":    result.Media,
+		"total":   result.Total,
 		"page":    params.Page,
 		"limit":   params.Limit,
-	})
+	}
+	if result.Facets != nil {
+		resp["facets"] = result.Facets
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 func (h *SearchHandler) GetWorkspaceStats(c *gin.Context) {
@@ -94,7 +101,13 @@ func (h *SearchHandler) CopyMedia(c *gin.Context) {
 		return
 	}
 
-	newMedia, err := h.mediaSvc.CopyMedia(c.Request.Context(), mediaID, userID, req.TargetWorkspaceID)
+	ctx := c.Request.Context()
+	if err := h.policy.RequirePlacement(ctx, services.PrincipalFrom(ctx), req.TargetWorkspaceID, ""); err != nil {
+		abortAccess(c, err)
+		return
+	}
+
+	newMedia, err := h.mediaSvc.CopyMedia(ctx, mediaID, userID, req.TargetWorkspaceID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
@@ -113,7 +126,13 @@ func (h *SearchHandler) MoveMedia(c *gin.Context) {
 		return
 	}
 
-	if err := h.mediaSvc.MoveMedia(c.Request.Context(), mediaID, userID, req.TargetWorkspaceID); err != nil {
+	ctx := c.Request.Context()
+	if err := h.policy.RequirePlacement(ctx, services.PrincipalFrom(ctx), req.TargetWorkspaceID, ""); err != nil {
+		abortAccess(c, err)
+		return
+	}
+
+	if err := h.mediaSvc.MoveMedia(ctx, mediaID, userID, req.TargetWorkspaceID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
@@ -130,7 +149,13 @@ func (h *SearchHandler) BulkMove(c *gin.Context) {
 		return
 	}
 
-	result := h.mediaSvc.BulkMove(c.Request.Context(), req.MediaIDs, userID, req.TargetWorkspaceID)
+	ctx := c.Request.Context()
+	if err := h.policy.RequirePlacement(ctx, services.PrincipalFrom(ctx), req.TargetWorkspaceID, ""); err != nil {
+		abortAccess(c, err)
+		return
+	}
+
+	result := h.mediaSvc.BulkMove(ctx, req.MediaIDs, userID, req.TargetWorkspaceID)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": result})
 }
 
@@ -157,6 +182,7 @@ func (h *SearchHandler) GetDownloadURL(c *gin.Context) {
 		return
 	}
 
+	h.analytics.RecordAccess(c.Request.Context(), mediaID, c.GetString("userID"), services.AccessDownload)
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": gin.H{"downloadUrl": url}})
 }
 
@@ -172,3 +198,17 @@ func (h *SearchHandler) GetRecent(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": media})
 }
+
+func respondSearchError(c *gin.Context, err error) {
+	var queryErr *services.QueryError
+	if errors.As(err, &queryErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": queryErr.Error(), "details": queryErr})
+		return
+	}
+	var paramErr *services.InvalidParamError
+	if errors.As(err, &paramErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": paramErr.Error(), "details": paramErr})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+}
@@ -1,20 +1,24 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/quckapp/media-service/internal/models"
 	"github.com/quckapp/media-service/internal/services"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type SharingHandler struct {
 	service *services.SharingService
+	policy  *services.AccessPolicy
 }
 
-func NewSharingHandler(service *services.SharingService) *SharingHandler {
-	return &SharingHandler{service: service}
+func NewSharingHandler(service *services.SharingService, policy *services.AccessPolicy) *SharingHandler {
+	return &SharingHandler{service: service, policy: policy}
 }
 
 func (h *SharingHandler) ShareWithUser(c *gin.Context) {
@@ -25,10 +29,16 @@ func (h *SharingHandler) ShareWithUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
+	ctx := c.Request.Context()
+	media, err := h.policy.LoadMedia(ctx, services.PrincipalFrom(ctx), req.MediaID, services.PermOwner)
+	if err != nil {
+		abortAccess(c, err)
+		return
+	}
 
-	share, err := h.service.ShareWithUser(c.Request.Context(), userID, &req)
+	share, err := h.service.ShareWithUser(services.WithMedia(ctx, media), userID, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
 
@@ -48,6 +58,19 @@ func (h *SharingHandler) GetSharedWithMe(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "data": shares})
 }
 
+func (h *SharingHandler) GetSharedMediaWithMe(c *gin.Context) {
+	userID := c.GetString("userID")
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+
+	items, err := h.service.GetSharedMedia(c.Request.Context(), userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": items})
+}
+
 func (h *SharingHandler) GetSharedByMe(c *gin.Context) {
 	userID := c.GetString("userID")
 	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
@@ -92,16 +115,184 @@ func (h *SharingHandler) CreateShareLink(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"success": true, "data": link})
 }
 
-func (h *SharingHandler) GetShareLink(c *gin.Context) {
+func (h *SharingHandler) CreateAlbumShareLink(c *gin.Context) {
+	h.createCollectionShareLink(c, models.ShareTargetAlbum, c.Param("albumId"))
+}
+
+func (h *SharingHandler) CreateGalleryShareLink(c *gin.Context) {
+	h.createCollectionShareLink(c, models.ShareTargetGallery, c.Param("galleryId"))
+}
+
+func (h *SharingHandler) createCollectionShareLink(c *gin.Context, targetType, targetID string) {
+	userID := c.GetString("userID")
+
+	var req models.CreateShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	link, err := h.service.CreateCollectionShareLink(c.Request.Context(), targetType, targetID, userID, &req)
+	if err != nil {
+		respondCollectionShareError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": link})
+}
+
+func (h *SharingHandler) GetAlbumShareLinks(c *gin.Context) {
+	h.getCollectionShareLinks(c, models.ShareTargetAlbum, c.Param("albumId"))
+}
+
+func (h *SharingHandler) GetGalleryShareLinks(c *gin.Context) {
+	h.getCollectionShareLinks(c, models.ShareTargetGallery, c.Param("galleryId"))
+}
+
+func (h *SharingHandler) getCollectionShareLinks(c *gin.Context, targetType, targetID string) {
+	userID := c.GetString("userID")
+
+	links, err := h.service.GetCollectionShareLinks(c.Request.Context(), targetType, targetID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": links})
+}
+
+func respondCollectionShareError(c *gin.Context, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Not found"})
+	case errors.Is(err, services.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+	}
+}
+
+// Password-protected links take the password in this header rather than
+// the URL, which ends up in logs and browser history. Browsers, which can't
+// add it when following a link, unlock the link instead and send the
+// access cookie.
+const (
+	sharePasswordHeader = "X-Share-Password"
+	shareAccessCookie   = "share_access"
+)
+
+// sharePassword returns the password header, or else the access cookie;
+// the service takes either.
+func sharePassword(c *gin.Context) string {
+	if password := c.GetHeader(sharePasswordHeader); password != "" {
+		return password
+	}
+	access, _ := c.Cookie(shareAccessCookie)
+	return access
+}
+
+// UnlockShareLink checks a link's password and returns an access token,
+// also set as a cookie scoped to the link's URLs so view and download
+// links work in the browser. The token can be sent in place of the
+// password header too.
+func (h *SharingHandler) UnlockShareLink(c *gin.Context) {
+	var req models.UnlockShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
 	token := c.Param("token")
+	access, err := h.service.UnlockShareLink(ctx, token, req.Password, services.RequestInfoFrom(ctx))
+	if err != nil {
+		respondShareLinkError(c, err)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(shareAccessCookie, access.AccessToken, int(time.Until(access.ExpiresAt).Seconds()),
+		"/api/v1/media/shared/"+token, "", true, true)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": access})
+}
+
+func (h *SharingHandler) GetShareLink(c *gin.Context) {
+	ctx := c.Request.Context()
+	shared, err := h.service.GetSharedLink(ctx, c.Param("token"), sharePassword(c), services.RequestInfoFrom(ctx))
+	if err != nil {
+		respondShareLinkError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": shared})
+}
+
+// ViewShareLink redirects to the media, or the :mediaId item of a shared
+// album or gallery, for inline preview.
+func (h *SharingHandler) ViewShareLink(c *gin.Context) {
+	h.openShareLink(c, services.ShareLinkView)
+}
+
+// DownloadShareLink redirects to the media, or the :mediaId item of a
+// shared album or gallery, as an attachment.
+func (h *SharingHandler) DownloadShareLink(c *gin.Context) {
+	h.openShareLink(c, services.ShareLinkDownload)
+}
+
+// PreviewShareLink serves a downscaled preview of an image in a shared
+// album or gallery, for links that don't allow downloads.
+func (h *SharingHandler) PreviewShareLink(c *gin.Context) {
+	preview, err := h.service.OpenSharedLinkPreview(c.Request.Context(), c.Param("token"), sharePassword(c), c.Param("mediaId"))
+	if err != nil {
+		respondShareLinkError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "image/jpeg", preview)
+}
+
+func (h *SharingHandler) openShareLink(c *gin.Context, action string) {
+	ctx := c.Request.Context()
+	url, err := h.service.OpenSharedLinkMedia(ctx, c.Param("token"), sharePassword(c), c.Param("mediaId"), action, services.RequestInfoFrom(ctx))
+	if err != nil {
+		respondShareLinkError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, url)
+}
+
+func (h *SharingHandler) GetShareLinkAccessLog(c *gin.Context) {
+	userID := c.GetString("userID")
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "100"), 10, 64)
 
-	link, err := h.service.GetShareLink(c.Request.Context(), token)
+	entries, err := h.service.GetShareLinkAccessLog(c.Request.Context(), c.Param("linkId"), userID, limit)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Share link not found"})
+		abortAccess(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"success": true, "data": link})
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": entries})
+}
+
+func respondShareLinkError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrShareLinkNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrShareLinkExpired), errors.Is(err, services.ErrShareLinkExhausted):
+		status = http.StatusGone
+	case errors.Is(err, services.ErrShareLinkPassword):
+		status = http.StatusUnauthorized
+	case errors.Is(err, services.ErrShareLinkNoDownloads):
+		status = http.StatusForbidden
+	case errors.Is(err, services.ErrPreviewUnsupported):
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, gin.H{"success": false, "error": err.Error()})
 }
 
 func (h *SharingHandler) DeactivateShareLink(c *gin.Context) {
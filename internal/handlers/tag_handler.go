@@ -11,10 +11,11 @@ import (
 
 type TagHandler struct {
 	service *services.TagService
+	policy  *services.AccessPolicy
 }
 
-func NewTagHandler(service *services.TagService) *TagHandler {
-	return &TagHandler{service: service}
+func NewTagHandler(service *services.TagService, policy *services.AccessPolicy) *TagHandler {
+	return &TagHandler{service: service, policy: policy}
 }
 
 func (h *TagHandler) Create(c *gin.Context) {
@@ -135,7 +136,14 @@ func (h *TagHandler) GetMediaByTag(c *gin.Context) {
 	tagID := c.Param("tagId")
 	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
 
-	mediaIDs, err := h.service.GetMediaByTag(c.Request.Context(), tagID, limit)
+	ctx := c.Request.Context()
+	mediaIDs, err := h.service.GetMediaByTag(ctx, tagID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	// Tags are shared, so the media under one belong to many people
+	mediaIDs, err = h.policy.FilterViewable(ctx, services.PrincipalFrom(ctx), mediaIDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
@@ -150,6 +158,10 @@ func (h *TagHandler) BulkTag(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
+	if err := h.policy.RequireMediaAll(c.Request.Context(), services.PrincipalFrom(c.Request.Context()), req.MediaIDs, services.PermEdit); err != nil {
+		abortAccess(c, err)
+		return
+	}
 
 	if err := h.service.BulkTag(c.Request.Context(), req.MediaIDs, req.TagIDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
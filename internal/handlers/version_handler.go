@@ -51,7 +51,7 @@ func (h *VersionHandler) GetVersion(c *gin.Context) {
 	versionID := c.Param("versionId")
 
 	version, err := h.service.GetVersion(c.Request.Context(), versionID)
-	if err != nil {
+	if err != nil || version.MediaID != c.Param("id") {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Version not found"})
 		return
 	}
@@ -62,6 +62,9 @@ func (h *VersionHandler) GetVersion(c *gin.Context) {
 func (h *VersionHandler) DeleteVersion(c *gin.Context) {
 	userID := c.GetString("userID")
 	versionID := c.Param("versionId")
+	if !h.versionOfMedia(c) {
+		return
+	}
 
 	if err := h.service.DeleteVersion(c.Request.Context(), versionID, userID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
@@ -74,6 +77,9 @@ func (h *VersionHandler) DeleteVersion(c *gin.Context) {
 func (h *VersionHandler) RestoreVersion(c *gin.Context) {
 	userID := c.GetString("userID")
 	versionID := c.Param("versionId")
+	if !h.versionOfMedia(c) {
+		return
+	}
 
 	if err := h.service.RestoreVersion(c.Request.Context(), versionID, userID); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
@@ -82,3 +88,14 @@ func (h *VersionHandler) RestoreVersion(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Version restored"})
 }
+
+// versionOfMedia stops version routes reaching another media's versions
+// through a media ID the caller has access to.
+func (h *VersionHandler) versionOfMedia(c *gin.Context) bool {
+	version, err := h.service.GetVersion(c.Request.Context(), c.Param("versionId"))
+	if err != nil || version.MediaID != c.Param("id") {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Version not found"})
+		return false
+	}
+	return true
+}
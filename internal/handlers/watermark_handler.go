@@ -10,10 +10,11 @@ import (
 
 type WatermarkHandler struct {
 	service *services.WatermarkService
+	policy  *services.AccessPolicy
 }
 
-func NewWatermarkHandler(service *services.WatermarkService) *WatermarkHandler {
-	return &WatermarkHandler{service: service}
+func NewWatermarkHandler(service *services.WatermarkService, policy *services.AccessPolicy) *WatermarkHandler {
+	return &WatermarkHandler{service: service, policy: policy}
 }
 
 func (h *WatermarkHandler) Upload(c *gin.Context) {
@@ -24,8 +25,13 @@ func (h *WatermarkHandler) Upload(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
 		return
 	}
+	ctx := c.Request.Context()
+	if err := h.policy.RequireRole(ctx, services.PrincipalFrom(ctx), req.WorkspaceID, services.RoleAdmin); err != nil {
+		abortAccess(c, err)
+		return
+	}
 
-	watermark, err := h.service.Upload(c.Request.Context(), userID, &req)
+	watermark, err := h.service.Upload(ctx, userID, &req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
@@ -53,7 +59,24 @@ func (h *WatermarkHandler) Apply(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.Apply(c.Request.Context(), &req); err != nil {
+	// Editors may apply their own workspace's watermarks
+	ctx := c.Request.Context()
+	principal := services.PrincipalFrom(ctx)
+	watermark, err := h.service.GetByID(ctx, req.WatermarkID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Watermark not found"})
+		return
+	}
+	if err := h.policy.RequireRole(ctx, principal, watermark.WorkspaceID, services.RoleMember); err != nil {
+		abortAccess(c, err)
+		return
+	}
+	if err := h.policy.RequireMedia(ctx, principal, req.MediaID, services.PermEdit); err != nil {
+		abortAccess(c, err)
+		return
+	}
+
+	if err := h.service.Apply(ctx, &req); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
 	}
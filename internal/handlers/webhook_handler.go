@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quckapp/media-service/internal/models"
+	"github.com/quckapp/media-service/internal/services"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type WebhookHandler struct {
+	service *services.WebhookService
+	policy  *services.AccessPolicy
+}
+
+func NewWebhookHandler(service *services.WebhookService, policy *services.AccessPolicy) *WebhookHandler {
+	return &WebhookHandler{service: service, policy: policy}
+}
+
+func (h *WebhookHandler) Create(c *gin.Context) {
+	userID := c.GetString("userID")
+
+	var req models.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	if err := h.policy.RequireRole(ctx, services.PrincipalFrom(ctx), req.WorkspaceID, services.RoleAdmin); err != nil {
+		abortAccess(c, err)
+		return
+	}
+
+	webhook, err := h.service.Create(ctx, userID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"success": true, "data": webhook})
+}
+
+func (h *WebhookHandler) List(c *gin.Context) {
+	webhooks, err := h.service.List(c.Request.Context(), c.Param("workspaceId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": webhooks})
+}
+
+func (h *WebhookHandler) Get(c *gin.Context) {
+	ctx := c.Request.Context()
+	webhook, err := h.service.Get(ctx, c.Param("webhookId"), services.PrincipalFrom(ctx))
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": webhook})
+}
+
+func (h *WebhookHandler) Update(c *gin.Context) {
+	var req models.UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	webhook, err := h.service.Update(ctx, c.Param("webhookId"), services.PrincipalFrom(ctx), &req)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": webhook})
+}
+
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	ctx := c.Request.Context()
+	if err := h.service.Delete(ctx, c.Param("webhookId"), services.PrincipalFrom(ctx)); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Webhook deleted"})
+}
+
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	ctx := c.Request.Context()
+	limit, _ := strconv.ParseInt(c.DefaultQuery("limit", "50"), 10, 64)
+
+	deliveries, err := h.service.ListDeliveries(ctx, c.Param("webhookId"), services.PrincipalFrom(ctx), c.Query("status"), limit)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": deliveries})
+}
+
+func (h *WebhookHandler) GetDelivery(c *gin.Context) {
+	ctx := c.Request.Context()
+	delivery, err := h.service.GetDelivery(ctx, c.Param("webhookId"), c.Param("deliveryId"), services.PrincipalFrom(ctx))
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true, "data": delivery})
+}
+
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	ctx := c.Request.Context()
+	delivery, err := h.service.Redeliver(ctx, c.Param("webhookId"), c.Param("deliveryId"), services.PrincipalFrom(ctx))
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "data": delivery})
+}
+
+func respondWebhookError(c *gin.Context, err error) {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Not found"})
+	case errors.Is(err, services.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+	}
+}
@@ -0,0 +1,21 @@
+// Package kms holds the key-encryption keys that wrap the per-object data
+// keys of encrypted media. Keys are versioned: rotating a key adds a new
+// current version used for wrapping, while older versions keep unwrapping
+// what they wrapped.
+package kms
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrKeyNotFound = errors.New("key not found")
+
+type KMS interface {
+	// Wrap encrypts dataKey under the current version of keyID, creating
+	// the key on first use.
+	Wrap(ctx context.Context, keyID string, dataKey []byte) (version int, wrapped []byte, err error)
+	Unwrap(ctx context.Context, keyID string, version int, wrapped []byte) ([]byte, error)
+	// Rotate makes a new version of keyID current and returns it.
+	Rotate(ctx context.Context, keyID string) (int, error)
+}
@@ -0,0 +1,268 @@
+package kms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const localKeySize = 32
+
+type localKeyVersion struct {
+	Version   int       `json:"version"`
+	Key       []byte    `json:"key"` // base64 in the file
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// LocalKMS keeps AES-256 keys in a JSON file, for development and for
+// deployments that manage the file's secrecy themselves. It is meant for a
+// single instance: writes take a lock file and merge what is on disk, and
+// unknown keys are reloaded, but replicas only share keys through a file
+// on one host. The file is rewritten atomically whenever a key is created
+// or rotated.
+type LocalKMS struct {
+	path string
+
+	mu   sync.Mutex
+	keys map[string][]localKeyVersion
+	file os.FileInfo // what was last read, to notice replacements
+}
+
+func NewLocalKMS(path string) (*LocalKMS, error) {
+	k := &LocalKMS{path: path, keys: map[string][]localKeyVersion{}}
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (k *LocalKMS) Wrap(ctx context.Context, keyID string, dataKey []byte) (int, []byte, error) {
+	k.mu.Lock()
+	// Pick up versions rotated by another process since the last read
+	if err := k.reloadIfChanged(); err != nil {
+		k.mu.Unlock()
+		return 0, nil, err
+	}
+	if len(k.keys[keyID]) == 0 {
+		if err := k.locked(func() error {
+			if len(k.keys[keyID]) > 0 {
+				return nil
+			}
+			_, err := k.addVersion(keyID)
+			return err
+		}); err != nil {
+			k.mu.Unlock()
+			return 0, nil, err
+		}
+	}
+	versions := k.keys[keyID]
+	current := versions[len(versions)-1]
+	k.mu.Unlock()
+
+	aead, err := newGCM(current.Key)
+	if err != nil {
+		return 0, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, nil, err
+	}
+	return current.Version, aead.Seal(nonce, nonce, dataKey, wrapAAD(keyID, current.Version)), nil
+}
+
+func (k *LocalKMS) Unwrap(ctx context.Context, keyID string, version int, wrapped []byte) ([]byte, error) {
+	key, err := k.version(keyID, version)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key is truncated")
+	}
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, wrapAAD(keyID, version))
+}
+
+func (k *LocalKMS) Rotate(ctx context.Context, keyID string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	var version int
+	err := k.locked(func() error {
+		var err error
+		version, err = k.addVersion(keyID)
+		return err
+	})
+	return version, err
+}
+
+// version finds a key version, rereading the file once if it isn't known
+// yet, since another process may have created it.
+func (k *LocalKMS) version(keyID string, version int) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for attempt := 0; attempt < 2; attempt++ {
+		for _, v := range k.keys[keyID] {
+			if v.Version == version {
+				return v.Key, nil
+			}
+		}
+		if attempt == 0 {
+			if err := k.reload(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s version %d", ErrKeyNotFound, keyID, version)
+}
+
+// locked runs fn holding an exclusive lock on the key file, after
+// rereading it so fn works on what other processes have written. It must
+// be called with mu held.
+func (k *LocalKMS) locked(fn func() error) error {
+	lock, err := os.OpenFile(k.path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock %s: %w", k.path, err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	if err := k.reload(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// reloadIfChanged rereads the file when it has been replaced since the
+// last read. It must be called with mu held.
+func (k *LocalKMS) reloadIfChanged() error {
+	info, err := os.Stat(k.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Every save renames a new file into place
+	if k.file != nil && os.SameFile(info, k.file) {
+		return nil
+	}
+	return k.reload()
+}
+
+// reload replaces the keys held with those in the file. Versions are only
+// ever added to the file, so it always holds everything already loaded.
+// It must be called with mu held.
+func (k *LocalKMS) reload() error {
+	info, err := os.Stat(k.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(k.path)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Keys map[string][]localKeyVersion `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse %s: %w", k.path, err)
+	}
+	for id, versions := range file.Keys {
+		for _, v := range versions {
+			if len(v.Key) != localKeySize {
+				return fmt.Errorf("key %s version %d is not %d bytes", id, v.Version, localKeySize)
+			}
+		}
+	}
+	if file.Keys == nil {
+		file.Keys = map[string][]localKeyVersion{}
+	}
+	k.keys = file.Keys
+	k.file = info
+	return nil
+}
+
+// addVersion must be called through locked. The new key is only kept once
+// it is on disk, so a failed save never leaves data wrapped by a key that
+// would be lost on restart.
+func (k *LocalKMS) addVersion(keyID string) (int, error) {
+	key := make([]byte, localKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return 0, err
+	}
+	versions := k.keys[keyID]
+	next := localKeyVersion{Version: len(versions) + 1, Key: key, CreatedAt: time.Now()}
+
+	k.keys[keyID] = append(versions[:len(versions):len(versions)], next)
+	if err := k.save(); err != nil {
+		k.keys[keyID] = versions
+		return 0, err
+	}
+	return next.Version, nil
+}
+
+func (k *LocalKMS) save() error {
+	data, err := json.MarshalIndent(map[string]interface{}{"keys": k.keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), filepath.Base(k.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), k.path); err != nil {
+		return err
+	}
+	if info, err := os.Stat(k.path); err == nil {
+		k.file = info
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrapAAD binds a wrapped key to the key and version that wrapped it.
+func wrapAAD(keyID string, version int) []byte {
+	return []byte(keyID + "/" + strconv.Itoa(version))
+}
@@ -0,0 +1,179 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quckapp/media-service/internal/auditchain"
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func backfillMediaFields(ctx context.Context, db *database.MongoDB) error {
+	media := db.Collection("media")
+
+	_, err := media.UpdateMany(ctx,
+		bson.M{"updatedAt": bson.M{"$exists": false}},
+		bson.A{bson.M{"$set": bson.M{"updatedAt": "$createdAt"}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = media.UpdateMany(ctx,
+		bson.M{"viewCount": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"viewCount": int64(0)}},
+	)
+	return err
+}
+
+// backfillStorageEvents seeds the chargeback ledger with one event per object
+// that already exists: live media, versions and trashed media. IDs are
+// derived from the source document so re-running is a no-op.
+func backfillStorageEvents(ctx context.Context, db *database.MongoDB) error {
+	sources := []struct {
+		collection string
+		prefix     string
+		pipeline   bson.A
+	}{
+		{"media", "backfill-media-", bson.A{
+			bson.M{"$project": bson.M{
+				"workspaceId":  bson.M{"$ifNull": bson.A{"$metadata.workspaceId", ""}},
+				"userId":       1,
+				"mediaId":      "$_id",
+				"storageClass": bson.M{"$ifNull": bson.A{"$storageClass", "standard"}},
+				"delta":        "$size",
+				"at":           "$createdAt",
+			}},
+		}},
+		{"media_trash", "backfill-trash-", bson.A{
+			bson.M{"$project": bson.M{
+				"workspaceId":  bson.M{"$ifNull": bson.A{"$originalDoc.metadata.workspaceId", ""}},
+				"userId":       "$originalDoc.userId",
+				"mediaId":      "$mediaId",
+				"storageClass": bson.M{"$ifNull": bson.A{"$originalDoc.storageClass", "standard"}},
+				"delta":        "$originalDoc.size",
+				"at":           "$originalDoc.createdAt",
+			}},
+		}},
+		{"media_versions", "backfill-version-", bson.A{
+			bson.M{"$lookup": bson.M{
+				"from":         "media",
+				"localField":   "mediaId",
+				"foreignField": "_id",
+				"as":           "media",
+			}},
+			bson.M{"$unwind": bson.M{"path": "$media", "preserveNullAndEmptyArrays": true}},
+			bson.M{"$project": bson.M{
+				"workspaceId":  bson.M{"$ifNull": bson.A{"$media.metadata.workspaceId", ""}},
+				"userId":       bson.M{"$ifNull": bson.A{"$media.userId", "$uploadedBy"}},
+				"mediaId":      1,
+				"storageClass": bson.M{"$ifNull": bson.A{"$media.storageClass", "standard"}},
+				"delta":        "$size",
+				"at":           "$createdAt",
+			}},
+		}},
+	}
+
+	for _, src := range sources {
+		pipeline := append(src.pipeline,
+			bson.M{"$match": bson.M{"delta": bson.M{"$gt": 0}}},
+			bson.M{"$set": bson.M{"_id": bson.M{"$concat": bson.A{src.prefix, "$_id"}}, "reason": "backfill"}},
+			bson.M{"$merge": bson.M{"into": "storage_events", "on": "_id", "whenMatched": "keepExisting", "whenNotMatched": "insert"}},
+		)
+		cursor, err := db.Collection(src.collection).Aggregate(ctx, pipeline)
+		if err != nil {
+			return fmt.Errorf("backfill storage events from %s: %w", src.collection, err)
+		}
+		cursor.Close(ctx)
+	}
+
+	return ensureIndexes(ctx, db, []indexSpec{
+		{"storage_events", "workspaceId_at", bson.D{{Key: "workspaceId", Value: 1}, {Key: "at", Value: 1}}, false},
+	})
+}
+
+// chainAuditLog links activity written before the hash chain existed onto
+// each workspace's chain in createdAt order, then enforces one entry per
+// chain position. Only unchained entries are touched, so re-running resumes.
+func chainAuditLog(ctx context.Context, db *database.MongoDB) error {
+	coll := db.Collection("media_activity")
+	_, err := coll.UpdateMany(ctx,
+		bson.M{"workspaceId": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"workspaceId": ""}},
+	)
+	if err != nil {
+		return err
+	}
+
+	workspaces, err := coll.Distinct(ctx, "workspaceId", bson.M{"seq": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	for _, ws := range workspaces {
+		workspaceID, _ := ws.(string)
+		if err := chainWorkspaceAudit(ctx, coll, workspaceID); err != nil {
+			return fmt.Errorf("chain audit log for workspace %q: %w", workspaceID, err)
+		}
+	}
+
+	return ensureIndexes(ctx, db, []indexSpec{
+		{"media_activity", "workspaceId_seq", bson.D{{Key: "workspaceId", Value: 1}, {Key: "seq", Value: 1}}, true},
+		{"media_activity", "workspaceId_createdAt", bson.D{{Key: "workspaceId", Value: 1}, {Key: "createdAt", Value: 1}}, false},
+	})
+}
+
+func chainWorkspaceAudit(ctx context.Context, coll *mongo.Collection, workspaceID string) error {
+	seq, prev, err := auditchain.Head(ctx, coll, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := coll.Find(ctx,
+		bson.M{"workspaceId": workspaceID, "seq": bson.M{"$exists": false}},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	const batchSize = 500
+	var writes []mongo.WriteModel
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := coll.BulkWrite(ctx, writes)
+		writes = writes[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var entry models.MediaActivity
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		auditchain.Link([]*models.MediaActivity{&entry}, seq, prev)
+		seq, prev = entry.Seq, entry.Hash
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": entry.ID, "seq": bson.M{"$exists": false}}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"seq":       entry.Seq,
+				"prevHash":  entry.PrevHash,
+				"hash":      entry.Hash,
+				"createdAt": entry.CreatedAt,
+			}}))
+		if len(writes) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	return flush()
+}
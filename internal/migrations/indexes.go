@@ -0,0 +1,297 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/quckapp/media-service/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type indexSpec struct {
+	collection string
+	name       string
+	keys       bson.D
+	unique     bool
+}
+
+func ensureIndexes(ctx context.Context, db *database.MongoDB, specs []indexSpec) error {
+	for _, spec := range specs {
+		opts := options.Index().SetName(spec.name)
+		if spec.unique {
+			opts.SetUnique(true)
+		}
+		_, err := db.Collection(spec.collection).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: spec.keys, Options: opts})
+		if err != nil {
+			return fmt.Errorf("create index %s.%s: %w", spec.collection, spec.name, err)
+		}
+	}
+	return nil
+}
+
+func createQueryIndexes(ctx context.Context, db *database.MongoDB) error {
+	var specs []indexSpec
+
+	// Search sort indexes; names match the ones created by earlier releases.
+	for _, field := range []string{"createdAt", "updatedAt", "size", "filename", "takenAt", "viewCount"} {
+		specs = append(specs, indexSpec{
+			collection: "media",
+			name:       "search_userId_" + field,
+			keys:       bson.D{{Key: "userId", Value: 1}, {Key: field, Value: -1}, {Key: "_id", Value: -1}},
+		})
+	}
+
+	specs = append(specs,
+		indexSpec{"media", "search_workspaceId_createdAt", bson.D{{Key: "metadata.workspaceId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		indexSpec{"media", "channelId_createdAt", bson.D{{Key: "metadata.channelId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		indexSpec{"media", "userId_type_createdAt", bson.D{{Key: "userId", Value: 1}, {Key: "type", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+
+		indexSpec{"media_albums", "userId_createdAt", bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		indexSpec{"media_albums", "workspaceId_isPublic_createdAt", bson.D{{Key: "workspaceId", Value: 1}, {Key: "isPublic", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+
+		indexSpec{"media_tags", "userId_name", bson.D{{Key: "userId", Value: 1}, {Key: "name", Value: 1}}, false},
+		indexSpec{"media_tags", "workspaceId_name", bson.D{{Key: "workspaceId", Value: 1}, {Key: "name", Value: 1}}, false},
+		indexSpec{"media_tag_mappings", "tagId", bson.D{{Key: "tagId", Value: 1}}, false},
+
+		indexSpec{"media_shares", "sharedWith_createdAt", bson.D{{Key: "sharedWith", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		indexSpec{"media_shares", "sharedBy_createdAt", bson.D{{Key: "sharedBy", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		indexSpec{"media_shares", "mediaId_sharedWith", bson.D{{Key: "mediaId", Value: 1}, {Key: "sharedWith", Value: 1}}, false},
+		indexSpec{"media_share_links", "mediaId_createdBy", bson.D{{Key: "mediaId", Value: 1}, {Key: "createdBy", Value: 1}}, false},
+
+		indexSpec{"media_trash", "userId_trashedAt", bson.D{{Key: "userId", Value: 1}, {Key: "trashedAt", Value: -1}}, false},
+		indexSpec{"media_trash", "expiresAt", bson.D{{Key: "expiresAt", Value: 1}}, false},
+
+		indexSpec{"media_processing_jobs", "mediaId_createdAt", bson.D{{Key: "mediaId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		indexSpec{"media_processing_jobs", "userId_status_createdAt", bson.D{{Key: "userId", Value: 1}, {Key: "status", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+
+		indexSpec{"media_favorites", "userId_createdAt", bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+
+		indexSpec{"media_comments", "mediaId_parentId_createdAt", bson.D{{Key: "mediaId", Value: 1}, {Key: "parentId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		indexSpec{"media_comments", "parentId_createdAt", bson.D{{Key: "parentId", Value: 1}, {Key: "createdAt", Value: 1}}, false},
+
+		indexSpec{"media_activity", "mediaId_createdAt", bson.D{{Key: "mediaId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		indexSpec{"media_activity", "userId_createdAt", bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+
+		indexSpec{"media_scans", "mediaId_scannedAt", bson.D{{Key: "mediaId", Value: 1}, {Key: "scannedAt", Value: -1}}, false},
+		indexSpec{"media_scans", "status_scannedAt", bson.D{{Key: "status", Value: 1}, {Key: "scannedAt", Value: -1}}, false},
+
+		indexSpec{"media_versions", "mediaId_version", bson.D{{Key: "mediaId", Value: 1}, {Key: "version", Value: -1}}, false},
+
+		indexSpec{"retention_policies", "workspaceId", bson.D{{Key: "workspaceId", Value: 1}}, false},
+		indexSpec{"watermarks", "workspaceId", bson.D{{Key: "workspaceId", Value: 1}}, false},
+		indexSpec{"watermark_settings", "workspaceId", bson.D{{Key: "workspaceId", Value: 1}}, false},
+		indexSpec{"media_galleries", "workspaceId_createdAt", bson.D{{Key: "workspaceId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		indexSpec{"media_saved_searches", "userId_position_createdAt", bson.D{{Key: "userId", Value: 1}, {Key: "position", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+	)
+
+	return ensureIndexes(ctx, db, specs)
+}
+
+func createUniqueIndexes(ctx context.Context, db *database.MongoDB) error {
+	// Duplicates would make the unique index builds fail
+	if err := dedupe(ctx, db, "media_favorites",
+		bson.D{{Key: "userId", Value: "$userId"}, {Key: "mediaId", Value: "$mediaId"}},
+		bson.D{{Key: "createdAt", Value: 1}},
+	); err != nil {
+		return err
+	}
+	if err := dedupe(ctx, db, "media_tag_mappings",
+		bson.D{{Key: "mediaId", Value: "$mediaId"}, {Key: "tagId", Value: "$tagId"}},
+		bson.D{{Key: "addedAt", Value: 1}},
+	); err != nil {
+		return err
+	}
+	if err := dedupe(ctx, db, "storage_quotas",
+		bson.D{{Key: "workspaceId", Value: "$workspaceId"}},
+		bson.D{{Key: "updatedAt", Value: -1}},
+	); err != nil {
+		return err
+	}
+	if err := recountTags(ctx, db); err != nil {
+		return err
+	}
+
+	return ensureIndexes(ctx, db, []indexSpec{
+		{"media_share_links", "token_unique", bson.D{{Key: "token", Value: 1}}, true},
+		{"media_favorites", "userId_mediaId_unique", bson.D{{Key: "userId", Value: 1}, {Key: "mediaId", Value: 1}}, true},
+		{"media_tag_mappings", "mediaId_tagId_unique", bson.D{{Key: "mediaId", Value: 1}, {Key: "tagId", Value: 1}}, true},
+		{"storage_quotas", "workspaceId_unique", bson.D{{Key: "workspaceId", Value: 1}}, true},
+	})
+}
+
+func createUsageIndexes(ctx context.Context, db *database.MongoDB) error {
+	return ensureIndexes(ctx, db, []indexSpec{
+		{"media_usage_hourly", "workspaceId_hour", bson.D{{Key: "workspaceId", Value: 1}, {Key: "hour", Value: -1}}, false},
+		{"media_usage_hourly", "mediaId_hour", bson.D{{Key: "mediaId", Value: 1}, {Key: "hour", Value: -1}}, false},
+		{"media", "workspaceId_lastAccessedAt_createdAt", bson.D{{Key: "metadata.workspaceId", Value: 1}, {Key: "lastAccessedAt", Value: 1}, {Key: "createdAt", Value: 1}}, false},
+	})
+}
+
+// Published outbox events are kept this long for debugging and replay.
+const outboxRetention = 7 * 24 * time.Hour
+
+func createOutboxIndexes(ctx context.Context, db *database.MongoDB) error {
+	err := ensureIndexes(ctx, db, []indexSpec{
+		{"event_outbox", "status_nextAttemptAt", bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}, {Key: "createdAt", Value: 1}}, false},
+	})
+	if err != nil {
+		return err
+	}
+	// TTL indexes only delete documents that have the field, so pending
+	// events are never expired.
+	_, err = db.Collection("event_outbox").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "publishedAt", Value: 1}},
+		Options: options.Index().SetName("publishedAt_ttl").SetExpireAfterSeconds(int32(outboxRetention.Seconds())),
+	})
+	if err != nil {
+		return fmt.Errorf("create index event_outbox.publishedAt_ttl: %w", err)
+	}
+	return nil
+}
+
+// Consumed event IDs are remembered this long; redeliveries arrive well
+// within it.
+const processedEventRetention = 30 * 24 * time.Hour
+
+func createConsumerIndexes(ctx context.Context, db *database.MongoDB) error {
+	err := ensureIndexes(ctx, db, []indexSpec{
+		{"event_dead_letters", "failedAt", bson.D{{Key: "failedAt", Value: -1}}, false},
+		{"event_dead_letters", "eventType_failedAt", bson.D{{Key: "eventType", Value: 1}, {Key: "failedAt", Value: -1}}, false},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("processed_events").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "processedAt", Value: 1}},
+		Options: options.Index().SetName("processedAt_ttl").SetExpireAfterSeconds(int32(processedEventRetention.Seconds())),
+	})
+	if err != nil {
+		return fmt.Errorf("create index processed_events.processedAt_ttl: %w", err)
+	}
+	return nil
+}
+
+func createWebhookIndexes(ctx context.Context, db *database.MongoDB) error {
+	return ensureIndexes(ctx, db, []indexSpec{
+		{"webhooks", "workspaceId_active", bson.D{{Key: "workspaceId", Value: 1}, {Key: "active", Value: 1}}, false},
+		{"webhook_deliveries", "status_nextAttemptAt", bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}, false},
+		{"webhook_deliveries", "subscriptionId_createdAt", bson.D{{Key: "subscriptionId", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+	})
+}
+
+// createShareExpiryIndex removes shares once expiresAt passes; shares
+// without an expiry are kept.
+func createShareExpiryIndex(ctx context.Context, db *database.MongoDB) error {
+	_, err := db.Collection("media_shares").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("create index media_shares.expiresAt_ttl: %w", err)
+	}
+	return nil
+}
+
+func createShareLinkAccessIndexes(ctx context.Context, db *database.MongoDB) error {
+	return ensureIndexes(ctx, db, []indexSpec{
+		{"share_link_access", "linkId_at", bson.D{{Key: "linkId", Value: 1}, {Key: "at", Value: -1}}, false},
+	})
+}
+
+func createCollectionShareLinkIndexes(ctx context.Context, db *database.MongoDB) error {
+	return ensureIndexes(ctx, db, []indexSpec{
+		{"media_share_links", "target_createdBy", bson.D{{Key: "targetType", Value: 1}, {Key: "targetId", Value: 1}, {Key: "createdBy", Value: 1}}, false},
+	})
+}
+
+func createWorkspaceMemberIndexes(ctx context.Context, db *database.MongoDB) error {
+	return ensureIndexes(ctx, db, []indexSpec{
+		{"workspace_members", "workspaceId_userId_unique", bson.D{{Key: "workspaceId", Value: 1}, {Key: "userId", Value: 1}}, true},
+	})
+}
+
+// Key rotation finds the media whose data keys an older key version wraps
+func createEncryptionKeyIndexes(ctx context.Context, db *database.MongoDB) error {
+	return ensureIndexes(ctx, db, []indexSpec{
+		{"media", "encryption_keyId_keyVersion", bson.D{{Key: "encryption.keyId", Value: 1}, {Key: "encryption.keyVersion", Value: 1}}, false},
+	})
+}
+
+func createEncryptedArchiveIndexes(ctx context.Context, db *database.MongoDB) error {
+	err := ensureIndexes(ctx, db, []indexSpec{
+		{"media_versions", "encryption_keyId_keyVersion", bson.D{{Key: "encryption.keyId", Value: 1}, {Key: "encryption.keyVersion", Value: 1}}, false},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.Collection("media_archives").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("create index media_archives.expiresAt_ttl: %w", err)
+	}
+	return nil
+}
+
+// dedupe keeps the first document for each key in keep order and deletes the rest.
+func dedupe(ctx context.Context, db *database.MongoDB, collection string, key, keep bson.D) error {
+	cursor, err := db.Collection(collection).Aggregate(ctx, bson.A{
+		bson.M{"$sort": keep},
+		bson.M{"$group": bson.M{"_id": key, "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}},
+		bson.M{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var group struct {
+			IDs []interface{} `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return err
+		}
+		if _, err := db.Collection(collection).DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// recountTags resets media_tags.mediaCount from the (now deduplicated) mappings.
+func recountTags(ctx context.Context, db *database.MongoDB) error {
+	if _, err := db.Collection("media_tags").UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"mediaCount": 0}}); err != nil {
+		return err
+	}
+
+	cursor, err := db.Collection("media_tag_mappings").Aggregate(ctx, bson.A{
+		bson.M{"$group": bson.M{"_id": "$tagId", "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var row struct {
+			TagID string `bson:"_id"`
+			Count int    `bson:"count"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return err
+		}
+		_, err := db.Collection("media_tags").UpdateOne(ctx,
+			bson.M{"_id": row.TagID},
+			bson.M{"$set": bson.M{"mediaCount": row.Count}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,228 @@
+// Package migrations applies versioned, idempotent schema changes (indexes,
+// backfills, document transforms) to the media database.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quckapp/media-service/internal/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	migrationsCollection = "schema_migrations"
+	lockCollection       = "schema_migrations_lock"
+	lockID               = "migrations"
+	lockLease            = 10 * time.Minute
+	// The holder extends its lease this often for as long as migrations
+	// run, so a long migration never outlives it
+	lockRenewInterval = lockLease / 5
+)
+
+// Migration is a single schema change. Up must be safe to re-run: a crash
+// after Up but before the version is recorded will run it again.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *database.MongoDB) error
+}
+
+type AppliedMigration struct {
+	Version     int       `json:"version" bson:"_id"`
+	Description string    `json:"description" bson:"description"`
+	AppliedAt   time.Time `json:"appliedAt" bson:"appliedAt"`
+	DurationMs  int64     `json:"durationMs" bson:"durationMs"`
+}
+
+type MigrationStatus struct {
+	Version     int        `json:"version"`
+	Description string     `json:"description"`
+	Applied     bool       `json:"applied"`
+	AppliedAt   *time.Time `json:"appliedAt,omitempty"`
+}
+
+// all lists every migration in version order. Never renumber or edit a
+// released migration; add a new one instead.
+var all = []Migration{
+	{Version: 1, Description: "create query indexes", Up: createQueryIndexes},
+	{Version: 2, Description: "dedupe favorites and tag mappings, create unique indexes", Up: createUniqueIndexes},
+	{Version: 3, Description: "backfill media updatedAt and viewCount", Up: backfillMediaFields},
+	{Version: 4, Description: "create media usage rollup indexes", Up: createUsageIndexes},
+	{Version: 5, Description: "backfill storage_events chargeback ledger", Up: backfillStorageEvents},
+	{Version: 6, Description: "hash-chain existing media_activity per workspace", Up: chainAuditLog},
+	{Version: 7, Description: "create event outbox indexes", Up: createOutboxIndexes},
+	{Version: 8, Description: "create event consumer indexes", Up: createConsumerIndexes},
+	{Version: 9, Description: "create webhook indexes", Up: createWebhookIndexes},
+	{Version: 10, Description: "expire media shares past expiresAt", Up: createShareExpiryIndex},
+	{Version: 11, Description: "create share link access log indexes", Up: createShareLinkAccessIndexes},
+	{Version: 12, Description: "create album and gallery share link indexes", Up: createCollectionShareLinkIndexes},
+	{Version: 13, Description: "create workspace member role indexes", Up: createWorkspaceMemberIndexes},
+	{Version: 14, Description: "create media encryption key indexes", Up: createEncryptionKeyIndexes},
+	{Version: 15, Description: "create version encryption key and encrypted archive expiry indexes", Up: createEncryptedArchiveIndexes},
+}
+
+// Run applies all pending migrations in order and returns the versions applied.
+func Run(ctx context.Context, db *database.MongoDB) ([]int, error) {
+	release, err := acquireLock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []int
+	for _, m := range sorted() {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", m.Version, m.Description)
+		start := time.Now()
+		if err := m.Up(ctx, db); err != nil {
+			return ran, fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+
+		record := AppliedMigration{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   time.Now(),
+			DurationMs:  time.Since(start).Milliseconds(),
+		}
+		_, err := db.Collection(migrationsCollection).ReplaceOne(ctx,
+			bson.M{"_id": m.Version}, record, options.Replace().SetUpsert(true),
+		)
+		if err != nil {
+			return ran, fmt.Errorf("record migration %d: %w", m.Version, err)
+		}
+		ran = append(ran, m.Version)
+	}
+	return ran, nil
+}
+
+// Status reports every known migration and whether it has been applied.
+func Status(ctx context.Context, db *database.MongoDB) ([]MigrationStatus, error) {
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(all))
+	for _, m := range sorted() {
+		status := MigrationStatus{Version: m.Version, Description: m.Description}
+		if a, ok := applied[m.Version]; ok {
+			status.Applied = true
+			appliedAt := a.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func sorted() []Migration {
+	ms := make([]Migration, len(all))
+	copy(ms, all)
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms
+}
+
+func appliedVersions(ctx context.Context, db *database.MongoDB) (map[int]AppliedMigration, error) {
+	cursor, err := db.Collection(migrationsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []AppliedMigration
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]AppliedMigration, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// acquireLock takes a lease so that replicas starting together don't run
+// migrations concurrently. It waits until the lease is free or ctx ends,
+// and keeps renewing the lease until released.
+func acquireLock(ctx context.Context, db *database.MongoDB) (func(), error) {
+	hostname, _ := os.Hostname()
+	owner := hostname + "/" + uuid.New().String()
+	coll := db.Collection(lockCollection)
+
+	for {
+		now := time.Now()
+		_, err := coll.UpdateOne(ctx,
+			bson.M{"_id": lockID, "lockedUntil": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{"owner": owner, "lockedUntil": now.Add(lockLease)}},
+			options.Update().SetUpsert(true),
+		)
+		if err == nil {
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				renewLock(coll, owner, stop)
+			}()
+			release := func() {
+				close(stop)
+				<-done
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_, _ = coll.DeleteOne(releaseCtx, bson.M{"_id": lockID, "owner": owner})
+			}
+			return release, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		log.Printf("Waiting for migration lock held by another instance")
+		select {
+		case <-ctx.Done():
+			return nil, errors.New("timed out waiting for migration lock")
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func renewLock(coll *mongo.Collection, owner string, stop <-chan struct{}) {
+	ticker := time.NewTicker(lockRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		res, err := coll.UpdateOne(ctx,
+			bson.M{"_id": lockID, "owner": owner},
+			bson.M{"$set": bson.M{"lockedUntil": time.Now().Add(lockLease)}},
+		)
+		cancel()
+		switch {
+		case err != nil:
+			log.Printf("Failed to renew migration lock: %v", err)
+		case res.MatchedCount == 0:
+			log.Printf("Migration lock was lost; another instance may run migrations")
+			return
+		}
+	}
+}
@@ -13,14 +13,23 @@ type Media struct {
 	ThumbnailURL string           `json:"thumbnailUrl,omitempty" bson:"thumbnailUrl,omitempty"`
 	S3Key       string            `json:"s3Key" bson:"s3Key"`
 	Metadata    map[string]string `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	TakenAt     *time.Time        `json:"takenAt,omitempty" bson:"takenAt,omitempty"`
+	ViewCount   int64             `json:"viewCount" bson:"viewCount"`
+	LastAccessedAt *time.Time     `json:"lastAccessedAt,omitempty" bson:"lastAccessedAt,omitempty"`
+	StorageClass string           `json:"storageClass,omitempty" bson:"storageClass,omitempty"` // standard (default), infrequent, archive
+	Encryption  *MediaEncryption  `json:"encryption,omitempty" bson:"encryption,omitempty"`
 	CreatedAt   time.Time         `json:"createdAt" bson:"createdAt"`
 	UpdatedAt   time.Time         `json:"updatedAt" bson:"updatedAt"`
 }
 
 type UploadRequest struct {
-	Filename string `json:"filename" binding:"required"`
-	MimeType string `json:"mimeType" binding:"required"`
-	Size     int64  `json:"size" binding:"required"`
+	Filename string     `json:"filename" binding:"required"`
+	MimeType string     `json:"mimeType" binding:"required"`
+	Size     int64      `json:"size" binding:"required"`
+	TakenAt  *time.Time `json:"takenAt"` // capture time, e.g. from EXIF
+	StorageClass string `json:"storageClass" binding:"omitempty,oneof=standard infrequent archive"`
+	WorkspaceID  string `json:"workspaceId"` // uploads to encrypted workspaces are encrypted
+	ChannelID    string `json:"channelId"`
 }
 
 type PresignedURLResponse struct {
@@ -28,6 +37,7 @@ type PresignedURLResponse struct {
 	MediaID   string `json:"mediaId"`
 	S3Key     string `json:"s3Key"`
 	ExpiresAt string `json:"expiresAt"`
+	Encrypted bool   `json:"encrypted,omitempty"` // UploadURL is the service, which encrypts on the way to S3
 }
 
 type BulkDeleteRequest struct {
@@ -45,6 +55,18 @@ type MediaStatsResponse struct {
 	ByType     map[string]int64 `json:"byType"`
 }
 
+// ── Workspace Roles ──
+
+// WorkspaceMember records a user's role in a workspace for tokens that
+// don't carry a workspaceRoles claim.
+type WorkspaceMember struct {
+	ID          string    `json:"id" bson:"_id"`
+	WorkspaceID string    `json:"workspaceId" bson:"workspaceId"`
+	UserID      string    `json:"userId" bson:"userId"`
+	Role        string    `json:"role" bson:"role"` // owner, admin, member, guest
+	UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
 // ── Albums ──
 
 type MediaAlbum struct {
@@ -132,8 +154,15 @@ type MediaShare struct {
 type ShareMediaRequest struct {
 	MediaID    string `json:"mediaId" binding:"required"`
 	SharedWith string `json:"sharedWith" binding:"required"`
-	Permission string `json:"permission" binding:"required"`
-	ExpiresIn  int    `json:"expiresIn"` // hours, 0 = no expiry
+	Permission string `json:"permission" binding:"required,oneof=view download edit"`
+	ExpiresIn  int    `json:"expiresIn" binding:"min=0"` // hours, 0 = no expiry
+}
+
+// SharedMedia is a share received by the caller with the media it grants
+// access to.
+type SharedMedia struct {
+	Share MediaShare `json:"share"`
+	Media Media      `json:"media"`
 }
 
 type ShareLinkResponse struct {
@@ -142,19 +171,83 @@ type ShareLinkResponse struct {
 	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
 }
 
+// Share link targets; links created before albums and galleries could be
+// shared have no target type and point at MediaID.
+const (
+	ShareTargetMedia   = "media"
+	ShareTargetAlbum   = "album"
+	ShareTargetGallery = "gallery"
+)
+
 type MediaShareLink struct {
-	ID        string     `json:"id" bson:"_id"`
-	MediaID   string     `json:"mediaId" bson:"mediaId"`
-	CreatedBy string     `json:"createdBy" bson:"createdBy"`
-	Token     string     `json:"token" bson:"token"`
-	IsActive  bool       `json:"isActive" bson:"isActive"`
-	ViewCount int        `json:"viewCount" bson:"viewCount"`
-	ExpiresAt *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
-	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	ID            string     `json:"id" bson:"_id"`
+	MediaID       string     `json:"mediaId,omitempty" bson:"mediaId"`
+	TargetType    string     `json:"targetType,omitempty" bson:"targetType,omitempty"` // media (default), album, gallery
+	TargetID      string     `json:"targetId,omitempty" bson:"targetId,omitempty"`     // album or gallery ID
+	CreatedBy     string     `json:"createdBy" bson:"createdBy"`
+	Token         string     `json:"token" bson:"token"`
+	IsActive      bool       `json:"isActive" bson:"isActive"`
+	ViewCount     int        `json:"viewCount" bson:"viewCount"`
+	DownloadCount int        `json:"downloadCount" bson:"downloadCount"`
+	MaxViews      int        `json:"maxViews,omitempty" bson:"maxViews,omitempty"`         // 0 = unlimited
+	MaxDownloads  int        `json:"maxDownloads,omitempty" bson:"maxDownloads,omitempty"` // 0 = unlimited
+	AllowDownload bool       `json:"allowDownload" bson:"allowDownload"`
+	PasswordHash  string     `json:"-" bson:"passwordHash,omitempty"`
+	HasPassword   bool       `json:"hasPassword" bson:"hasPassword"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt" bson:"createdAt"`
 }
 
 type CreateShareLinkRequest struct {
-	ExpiresIn int `json:"expiresIn"` // hours, 0 = no expiry
+	ExpiresIn     int    `json:"expiresIn" binding:"min=0"` // hours, 0 = no expiry
+	Password      string `json:"password" binding:"omitempty,min=4,max=72"`
+	MaxViews      int    `json:"maxViews" binding:"min=0"`
+	MaxDownloads  int    `json:"maxDownloads" binding:"min=0"`
+	AllowDownload *bool  `json:"allowDownload"` // default true
+}
+
+// SharedLink is what an anonymous visitor of a share link sees: a single
+// media item, or the current contents of an album or gallery.
+type SharedLink struct {
+	TargetType    string           `json:"targetType"`
+	Media         *SharedLinkItem  `json:"media,omitempty"`
+	Name          string           `json:"name,omitempty"`
+	Description   string           `json:"description,omitempty"`
+	Items         []SharedLinkItem `json:"items,omitempty"`
+	AllowDownload bool             `json:"allowDownload"`
+	ViewsLeft     *int             `json:"viewsLeft,omitempty"`
+	DownloadsLeft *int             `json:"downloadsLeft,omitempty"`
+	ExpiresAt     *time.Time       `json:"expiresAt,omitempty"`
+}
+
+type SharedLinkItem struct {
+	MediaID      string `json:"mediaId,omitempty"`
+	Filename     string `json:"filename"`
+	MimeType     string `json:"mimeType"`
+	Type         string `json:"type"`
+	Size         int64  `json:"size"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty"` // short-lived
+}
+
+type UnlockShareLinkRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// ShareLinkAccessToken stands in for a link's password until it expires.
+type ShareLinkAccessToken struct {
+	AccessToken string    `json:"accessToken"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+type ShareLinkAccess struct {
+	ID        string    `json:"id" bson:"_id"`
+	LinkID    string    `json:"linkId" bson:"linkId"`
+	MediaID   string    `json:"mediaId" bson:"mediaId"`
+	Action    string    `json:"action" bson:"action"`   // info, unlock, view, download
+	Outcome   string    `json:"outcome" bson:"outcome"` // granted or the reason it was denied
+	IP        string    `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+	At        time.Time `json:"at" bson:"at"`
 }
 
 // ── Versions ──
@@ -168,9 +261,12 @@ type MediaVersion struct {
 	Size       int64     `json:"size" bson:"size"`
 	S3Key      string    `json:"s3Key" bson:"s3Key"`
 	URL        string    `json:"url,omitempty" bson:"url,omitempty"`
+	UploadURL  string    `json:"uploadUrl,omitempty" bson:"-"`
 	UploadedBy string    `json:"uploadedBy" bson:"uploadedBy"`
 	Comment    string    `json:"comment,omitempty" bson:"comment,omitempty"`
 	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+
+	Encryption *MediaEncryption `json:"encryption,omitempty" bson:"encryption,omitempty"`
 }
 
 type CreateVersionRequest struct {
@@ -199,6 +295,7 @@ type ProcessingJob struct {
 	UserID    string                 `json:"userId" bson:"userId"`
 	Type      string                 `json:"type" bson:"type"`     // thumbnail, resize, compress, transcode
 	Status    string                 `json:"status" bson:"status"` // pending, processing, completed, failed
+	Progress  int                    `json:"progress" bson:"progress"` // percent
 	Params    map[string]interface{} `json:"params,omitempty" bson:"params,omitempty"`
 	Result    map[string]interface{} `json:"result,omitempty" bson:"result,omitempty"`
 	Error     string                 `json:"error,omitempty" bson:"error,omitempty"`
@@ -250,7 +347,7 @@ type MediaSearchParams struct {
 	ChannelID   string `form:"channelId"`
 	AlbumID     string `form:"albumId"`
 	TagID       string `form:"tagId"`
-	SortBy      string `form:"sortBy"`    // createdAt, size, filename
+	SortBy      string `form:"sortBy"`    // createdAt, updatedAt, size, filename, takenAt, viewCount; comma-separated, "-" prefix for desc
 	SortOrder   string `form:"sortOrder"` // asc, desc
 	Page        int    `form:"page"`
 	Limit       int    `form:"limit"`
@@ -258,6 +355,61 @@ type MediaSearchParams struct {
 	MaxSize     int64  `form:"maxSize"`
 	DateFrom    string `form:"dateFrom"`
 	DateTo      string `form:"dateTo"`
+	Expr        string `form:"expr"`   // search DSL, e.g. `type:image tag:design size:>5MB "logo"`
+	Facets      string `form:"facets"` // comma-separated: type, tag, workspace, month, size
+}
+
+type FacetBucket struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int64  `json:"count"`
+}
+
+type SearchResult struct {
+	Media  []Media                  `json:"data"`
+	Total  int64                    `json:"total"`
+	Facets map[string][]FacetBucket `json:"facets,omitempty"`
+}
+
+// ── Saved Searches ──
+
+type SavedSearch struct {
+	ID          string     `json:"id" bson:"_id"`
+	UserID      string     `json:"userId" bson:"userId"`
+	WorkspaceID string     `json:"workspaceId,omitempty" bson:"workspaceId,omitempty"`
+	Name        string     `json:"name" bson:"name"`
+	Query       string     `json:"query" bson:"query"`
+	SortBy      string     `json:"sortBy,omitempty" bson:"sortBy,omitempty"`
+	SortOrder   string     `json:"sortOrder,omitempty" bson:"sortOrder,omitempty"`
+	Pinned      bool       `json:"pinned" bson:"pinned"` // shown as a smart album
+	Position    int        `json:"position" bson:"position"`
+	LastRunAt   *time.Time `json:"lastRunAt,omitempty" bson:"lastRunAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt" bson:"updatedAt"`
+}
+
+type CreateSavedSearchRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Query       string `json:"query" binding:"required"`
+	WorkspaceID string `json:"workspaceId"`
+	SortBy      string `json:"sortBy"`
+	SortOrder   string `json:"sortOrder"`
+	Pinned      bool   `json:"pinned"`
+}
+
+type UpdateSavedSearchRequest struct {
+	Name      string `json:"name"`
+	Query     string `json:"query"`
+	SortBy    string `json:"sortBy"`
+	SortOrder string `json:"sortOrder"`
+	Pinned    *bool  `json:"pinned"`
+	Position  *int   `json:"position"`
+}
+
+type SmartAlbum struct {
+	SavedSearch
+	MediaCount int64  `json:"mediaCount"`
+	CoverURL   string `json:"coverUrl,omitempty"`
 }
 
 // ── Workspace Stats ──
@@ -304,12 +456,83 @@ type BulkAlbumRequest struct {
 // ── Activity / Audit ──
 
 type MediaActivity struct {
-	ID        string    `json:"id" bson:"_id"`
-	MediaID   string    `json:"mediaId" bson:"mediaId"`
-	UserID    string    `json:"userId" bson:"userId"`
-	Action    string    `json:"action" bson:"action"` // upload, delete, view, download, share, rename, move, tag
-	Details   string    `json:"details,omitempty" bson:"details,omitempty"`
-	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	ID          string            `json:"id" bson:"_id"`
+	MediaID     string            `json:"mediaId" bson:"mediaId"`
+	WorkspaceID string            `json:"workspaceId,omitempty" bson:"workspaceId"`
+	MediaType   string            `json:"mediaType,omitempty" bson:"mediaType,omitempty"`
+	UserID      string            `json:"userId" bson:"userId"`
+	Action      string            `json:"action" bson:"action"` // see services.Audit* constants
+	Details     string            `json:"details,omitempty" bson:"details,omitempty"`
+	Before      map[string]string `json:"before,omitempty" bson:"before,omitempty"`
+	After       map[string]string `json:"after,omitempty" bson:"after,omitempty"`
+	IP          string            `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent   string            `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt" bson:"createdAt"`
+
+	// Per-workspace hash chain; see auditchain.Hash
+	Seq      int64  `json:"seq,omitempty" bson:"seq,omitempty"`
+	PrevHash string `json:"prevHash,omitempty" bson:"prevHash,omitempty"`
+	Hash     string `json:"hash,omitempty" bson:"hash,omitempty"`
+}
+
+type ActivityGroup struct {
+	WorkspaceID string    `json:"workspaceId"`
+	ActorID     string    `json:"actorId"`
+	Action      string    `json:"action"`
+	MediaType   string    `json:"mediaType,omitempty"`
+	TargetType  string    `json:"targetType,omitempty"` // album or channel the media went to or left
+	TargetID    string    `json:"targetId,omitempty"`
+	TargetName  string    `json:"targetName,omitempty"`
+	Count       int       `json:"count"`
+	MediaIDs    []string  `json:"mediaIds"`
+	Summary     string    `json:"summary"`
+	StartedAt   time.Time `json:"startedAt"`
+	EndedAt     time.Time `json:"endedAt"`
+	LastSeq     int64     `json:"lastSeq"`
+}
+
+type ActivityFeed struct {
+	Groups     []ActivityGroup `json:"groups"`
+	Entries    []MediaActivity `json:"entries"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+type AuditChainBreak struct {
+	Seq     int64  `json:"seq"`
+	EntryID string `json:"entryId,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+type AuditVerification struct {
+	WorkspaceID string            `json:"workspaceId"`
+	FromSeq     int64             `json:"fromSeq"`
+	ToSeq       int64             `json:"toSeq"`
+	Entries     int64             `json:"entries"`
+	HeadHash    string            `json:"headHash"`
+	Valid       bool              `json:"valid"`
+	Breaks      []AuditChainBreak `json:"breaks"`
+	Unchained   int64             `json:"unchained"`
+}
+
+// AuditManifest describes an exported audit bundle. It is signed so the
+// bundle can be checked without access to the database.
+type AuditManifest struct {
+	WorkspaceID        string            `json:"workspaceId"`
+	From               *time.Time        `json:"from,omitempty"`
+	To                 *time.Time        `json:"to,omitempty"`
+	FromSeq            int64             `json:"fromSeq"`
+	ToSeq              int64             `json:"toSeq"`
+	Entries            int64             `json:"entries"`
+	PrevHash           string            `json:"prevHash"`
+	HeadHash           string            `json:"headHash"`
+	ChainValid         bool              `json:"chainValid"`
+	Breaks             []AuditChainBreak `json:"breaks"`
+	File               string            `json:"file"`
+	FileSHA256         string            `json:"fileSha256"`
+	HashAlgorithm      string            `json:"hashAlgorithm"`
+	SignatureAlgorithm string            `json:"signatureAlgorithm"`
+	PublicKey          string            `json:"publicKey"`
+	GeneratedAt        time.Time         `json:"generatedAt"`
 }
 
 // Retention Policies
@@ -419,6 +642,7 @@ type ScanRequest struct {
 
 // Media Analytics
 
+// Trend dates are the bucket start (YYYY-MM-DD) in the requested time zone.
 type UploadTrend struct {
 	Date      string `json:"date" bson:"_id"`
 	Count     int64  `json:"count" bson:"count"`
@@ -426,8 +650,9 @@ type UploadTrend struct {
 }
 
 type StorageTrend struct {
-	Date   string `json:"date" bson:"_id"`
-	UsedMB int64  `json:"usedMB" bson:"usedMB"`
+	Date      string  `json:"date" bson:"_id"`
+	UsedBytes int64   `json:"usedBytes" bson:"usedBytes"`
+	UsedMB    float64 `json:"usedMB" bson:"usedMB"`
 }
 
 type FileTypeDistribution struct {
@@ -443,6 +668,98 @@ type UserUploadStats struct {
 	LastUpload time.Time `json:"lastUpload" bson:"lastUpload"`
 }
 
+// MediaUsageRollup holds deduplicated access counts for one media item in one hour.
+type MediaUsageRollup struct {
+	ID          string    `json:"id" bson:"_id"` // mediaId:hourUnix
+	MediaID     string    `json:"mediaId" bson:"mediaId"`
+	WorkspaceID string    `json:"workspaceId,omitempty" bson:"workspaceId,omitempty"`
+	Hour        time.Time `json:"hour" bson:"hour"`
+	Views       int64     `json:"views" bson:"views"`
+	Downloads   int64     `json:"downloads" bson:"downloads"`
+	Streams     int64     `json:"streams" bson:"streams"`
+}
+
+type MediaUsage struct {
+	MediaID   string `json:"mediaId" bson:"_id"`
+	Filename  string `json:"filename,omitempty" bson:"-"`
+	Type      string `json:"type,omitempty" bson:"-"`
+	Views     int64  `json:"views" bson:"views"`
+	Downloads int64  `json:"downloads" bson:"downloads"`
+	Streams   int64  `json:"streams" bson:"streams"`
+}
+
+type MediaUsagePoint struct {
+	Date      string `json:"date"`
+	Views     int64  `json:"views"`
+	Downloads int64  `json:"downloads"`
+	Streams   int64  `json:"streams"`
+}
+
+type MediaUsageReport struct {
+	MediaID        string            `json:"mediaId"`
+	Views          int64             `json:"views"`
+	Downloads      int64             `json:"downloads"`
+	Streams        int64             `json:"streams"`
+	UniqueViewers  int64             `json:"uniqueViewers"`
+	LastAccessedAt *time.Time        `json:"lastAccessedAt,omitempty"`
+	Series         []MediaUsagePoint `json:"series"`
+}
+
+// ── Storage Chargeback ──
+
+// StorageEvent is one change to the bytes a workspace keeps in object storage.
+// Summing Delta over all events up to a point in time gives usage at that time.
+type StorageEvent struct {
+	ID           string    `json:"id" bson:"_id"`
+	WorkspaceID  string    `json:"workspaceId" bson:"workspaceId"`
+	UserID       string    `json:"userId" bson:"userId"`
+	MediaID      string    `json:"mediaId" bson:"mediaId"`
+	StorageClass string    `json:"storageClass" bson:"storageClass"`
+	Delta        int64     `json:"delta" bson:"delta"`
+	Reason       string    `json:"reason" bson:"reason"` // create, copy, delete, move_in, move_out, version_create, version_delete, restore, backfill
+	At           time.Time `json:"at" bson:"at"`
+}
+
+// PriceTier charges PricePerGBMonth for usage up to UpToGBMonths; the last
+// tier of a class leaves UpToGBMonths at 0 and covers everything above.
+type PriceTier struct {
+	UpToGBMonths    float64 `json:"upToGBMonths,omitempty"`
+	PricePerGBMonth float64 `json:"pricePerGBMonth"`
+}
+
+type ChargebackPricing struct {
+	Currency string                 `json:"currency"`
+	Classes  map[string][]PriceTier `json:"classes"`
+}
+
+type ChargebackLine struct {
+	StorageClass string  `json:"storageClass"`
+	GBMonths     float64 `json:"gbMonths"`
+	EndBytes     int64   `json:"endBytes"`
+	Cost         float64 `json:"cost"`
+}
+
+type ChargebackUserLine struct {
+	UserID       string  `json:"userId"`
+	StorageClass string  `json:"storageClass"`
+	GBMonths     float64 `json:"gbMonths"`
+	EndBytes     int64   `json:"endBytes"`
+	Cost         float64 `json:"cost"`
+}
+
+type ChargebackInvoice struct {
+	WorkspaceID   string               `json:"workspaceId"`
+	Month         string               `json:"month"`
+	PeriodStart   time.Time            `json:"periodStart"`
+	PeriodEnd     time.Time            `json:"periodEnd"`
+	Partial       bool                 `json:"partial"` // month still in progress; usage is month-to-date
+	Currency      string               `json:"currency"`
+	Lines         []ChargebackLine     `json:"lines"`
+	Users         []ChargebackUserLine `json:"users"`
+	TotalGBMonths float64              `json:"totalGBMonths"`
+	TotalCost     float64              `json:"totalCost"`
+}
+
 // Media Galleries / Collections
 
 type MediaGallery struct {
@@ -475,6 +792,150 @@ type UpdateGalleryRequest struct {
 	IsPublic    *bool    `json:"isPublic"`
 	MediaIDs    []string `json:"mediaIds"`
 }
+// ── Webhooks ──
+
+type WebhookSubscription struct {
+	ID          string   `json:"id" bson:"_id"`
+	WorkspaceID string   `json:"workspaceId" bson:"workspaceId"`
+	URL         string   `json:"url" bson:"url"`
+	Events      []string `json:"events" bson:"events"` // event types or "media.*"; empty means all
+	// Only returned when the subscription is created
+	Secret      string    `json:"secret,omitempty" bson:"secret"`
+	Description string    `json:"description,omitempty" bson:"description,omitempty"`
+	Active      bool      `json:"active" bson:"active"`
+	CreatedBy   string    `json:"createdBy" bson:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt" bson:"updatedAt"`
+}
+
+type CreateWebhookRequest struct {
+	WorkspaceID string   `json:"workspaceId" binding:"required"`
+	URL         string   `json:"url" binding:"required,url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+}
+
+type UpdateWebhookRequest struct {
+	URL         string   `json:"url" binding:"omitempty,url"`
+	Events      []string `json:"events"`
+	Description *string  `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+type WebhookAttempt struct {
+	At           time.Time `json:"at" bson:"at"`
+	StatusCode   int       `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+	Error        string    `json:"error,omitempty" bson:"error,omitempty"`
+	DurationMs   int64     `json:"durationMs" bson:"durationMs"`
+	ResponseBody string    `json:"responseBody,omitempty" bson:"responseBody,omitempty"`
+}
+
+type WebhookDelivery struct {
+	ID             string           `json:"id" bson:"_id"`
+	SubscriptionID string           `json:"subscriptionId" bson:"subscriptionId"`
+	WorkspaceID    string           `json:"workspaceId" bson:"workspaceId"`
+	EventID        string           `json:"eventId" bson:"eventId"`
+	EventType      string           `json:"eventType" bson:"eventType"`
+	Payload        string           `json:"payload" bson:"payload"`
+	Status         string           `json:"status" bson:"status"` // pending, succeeded, failed
+	Attempts       int              `json:"attempts" bson:"attempts"`
+	NextAttemptAt  time.Time        `json:"nextAttemptAt" bson:"nextAttemptAt"`
+	LockedUntil    time.Time        `json:"-" bson:"lockedUntil"`
+	Log            []WebhookAttempt `json:"log" bson:"log"`
+	CreatedAt      time.Time        `json:"createdAt" bson:"createdAt"`
+	DeliveredAt    *time.Time       `json:"deliveredAt,omitempty" bson:"deliveredAt,omitempty"`
+}
+
+// ── Archives ──
+
+// CreateArchiveRequest picks the media to zip from exactly one source.
+type CreateArchiveRequest struct {
+	Filename string   `json:"filename"` // without .zip, defaults to "media"
+	MediaIDs []string `json:"mediaIds" binding:"omitempty,max=1000"`
+	AlbumID  string   `json:"albumId"`
+	TagID    string   `json:"tagId"`
+	Search   string   `json:"search"` // search DSL, as for /search?expr=
+	Async    bool     `json:"async"`  // build in the background even if small enough to stream
+}
+
+// MediaArchive is an encrypted archive built by a background job. The
+// service decrypts it for holders of the job's signed link until it
+// expires.
+type MediaArchive struct {
+	ID         string           `json:"id" bson:"_id"` // the job's ID
+	UserID     string           `json:"userId" bson:"userId"`
+	Filename   string           `json:"filename" bson:"filename"`
+	S3Key      string           `json:"s3Key" bson:"s3Key"`
+	Encryption *MediaEncryption `json:"encryption" bson:"encryption"`
+	CreatedAt  time.Time        `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  time.Time        `json:"expiresAt" bson:"expiresAt"`
+}
+
+// ── API Keys ──
+
+// APIKey lets another backend service call this one without a user token.
+// Only a hash of the secret part is stored.
+type APIKey struct {
+	ID           string     `json:"id" bson:"_id"` // also the key's public prefix
+	Name         string     `json:"name" bson:"name"`
+	SecretHash   string     `json:"-" bson:"secretHash"`
+	Scopes       []string   `json:"scopes" bson:"scopes"`
+	WorkspaceIDs []string   `json:"workspaceIds,omitempty" bson:"workspaceIds,omitempty"` // empty = every workspace
+	CreatedBy    string     `json:"createdBy" bson:"createdBy"`
+	CreatedAt    time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	LastUsedAt   *time.Time `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	RevokedAt    *time.Time `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name         string   `json:"name" binding:"required,max=100"`
+	Scopes       []string `json:"scopes" binding:"required,min=1,dive,oneof=media:read media:write jobs:write admin"`
+	WorkspaceIDs []string `json:"workspaceIds"`
+	ExpiresIn    int      `json:"expiresIn" binding:"min=0"` // days, 0 = never
+}
+
+// CreatedAPIKey is returned once, when the key is created; Key can't be
+// recovered afterwards.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// ── Encryption at Rest ──
+
+// MediaEncryption records how an object is encrypted. Its data key is
+// stored wrapped by the KMS key KeyID, at KeyVersion.
+type MediaEncryption struct {
+	Mode       string `json:"mode" bson:"mode"` // aes-gcm or sse-c
+	KeyID      string `json:"keyId" bson:"keyId"`
+	KeyVersion int    `json:"keyVersion" bson:"keyVersion"`
+	WrappedKey []byte `json:"-" bson:"wrappedKey"`
+	Size       int64  `json:"-" bson:"size"` // plaintext bytes stored; 0 until uploaded
+}
+
+type WorkspaceEncryption struct {
+	WorkspaceID string     `json:"workspaceId" bson:"_id"`
+	Mode        string     `json:"mode" bson:"mode"`
+	KeyID       string     `json:"keyId" bson:"keyId"`
+	KeyVersion  int        `json:"keyVersion,omitempty" bson:"keyVersion,omitempty"` // set by the last rotation
+	EnabledBy   string     `json:"enabledBy" bson:"enabledBy"`
+	CreatedAt   time.Time  `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt" bson:"updatedAt"`
+	RotatedAt   *time.Time `json:"rotatedAt,omitempty" bson:"rotatedAt,omitempty"`
+}
+
+type EnableEncryptionRequest struct {
+	Mode string `json:"mode" binding:"omitempty,oneof=aes-gcm sse-c"` // default aes-gcm
+}
+
+type KeyRotationResult struct {
+	KeyID      string `json:"keyId"`
+	KeyVersion int    `json:"keyVersion"`
+	Rewrapped  int64  `json:"rewrapped"`
+	Failed     int64  `json:"failed"`
+}
+
 // ── Paginated Response ──
 
 type PaginatedResponse struct {
@@ -0,0 +1,206 @@
+// Package realtime pushes live updates (job progress, scan results, new
+// comments and uploads) to connected clients. Updates are published on a
+// Redis channel so every replica sees them, and each replica fans them out
+// to its own subscribers by topic.
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisChannel   = "realtime:updates"
+	publishTimeout = 2 * time.Second
+	// Updates for a subscriber that falls this far behind are dropped
+	subscriberBuffer = 64
+)
+
+// Update types
+const (
+	JobUpdated     = "job.updated"
+	ScanUpdated    = "scan.updated"
+	CommentCreated = "comment.created"
+	MediaUploaded  = "media.uploaded"
+)
+
+// Scope says which topics an update is delivered to; empty fields are
+// skipped.
+type Scope struct {
+	MediaID     string
+	ChannelID   string
+	WorkspaceID string
+	UserID      string
+}
+
+func (s Scope) topics() []Topic {
+	var topics []Topic
+	if s.MediaID != "" {
+		topics = append(topics, MediaTopic(s.MediaID))
+	}
+	if s.ChannelID != "" {
+		topics = append(topics, ChannelTopic(s.ChannelID))
+	}
+	if s.WorkspaceID != "" {
+		topics = append(topics, WorkspaceTopic(s.WorkspaceID))
+	}
+	if s.UserID != "" {
+		topics = append(topics, UserTopic(s.UserID))
+	}
+	return topics
+}
+
+type Update struct {
+	ID     string          `json:"id"`
+	Type   string          `json:"type"`
+	Topics []Topic         `json:"topics"`
+	At     time.Time       `json:"at"`
+	Data   json.RawMessage `json:"data"`
+}
+
+type Topic string
+
+func MediaTopic(id string) Topic     { return Topic("media:" + id) }
+func ChannelTopic(id string) Topic   { return Topic("channel:" + id) }
+func WorkspaceTopic(id string) Topic { return Topic("workspace:" + id) }
+func UserTopic(id string) Topic      { return Topic("user:" + id) }
+
+// Subscription receives updates for its topics on C until Close. Each
+// update arrives once even if it matches several topics.
+type Subscription struct {
+	C <-chan Update
+
+	hub    *Hub
+	topics []Topic
+	ch     chan Update
+	once   sync.Once
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() { s.hub.remove(s) })
+}
+
+type Hub struct {
+	redis *redis.Client
+
+	mu   sync.RWMutex
+	subs map[Topic]map[*Subscription]struct{}
+}
+
+func NewHub(redis *redis.Client) *Hub {
+	return &Hub{redis: redis, subs: map[Topic]map[*Subscription]struct{}{}}
+}
+
+// Publish sends an update to every replica. Updates are best effort: a
+// failure is logged and clients fall back to polling. A nil Hub is a no-op.
+func (h *Hub) Publish(ctx context.Context, updateType string, scope Scope, data interface{}) {
+	if h == nil {
+		return
+	}
+	topics := scope.topics()
+	if len(topics) == 0 {
+		return
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Failed to encode %s update: %v", updateType, err)
+		return
+	}
+	msg, err := json.Marshal(&Update{
+		ID:     uuid.New().String(),
+		Type:   updateType,
+		Topics: topics,
+		At:     time.Now().UTC(),
+		Data:   payload,
+	})
+	if err != nil {
+		log.Printf("Failed to encode %s update: %v", updateType, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), publishTimeout)
+	defer cancel()
+	if err := h.redis.Publish(ctx, redisChannel, msg).Err(); err != nil {
+		log.Printf("Failed to publish %s update: %v", updateType, err)
+	}
+}
+
+// Subscribe registers interest in topics on this replica.
+func (h *Hub) Subscribe(topics ...Topic) *Subscription {
+	ch := make(chan Update, subscriberBuffer)
+	sub := &Subscription{C: ch, hub: h, topics: topics, ch: ch}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, t := range topics {
+		if h.subs[t] == nil {
+			h.subs[t] = map[*Subscription]struct{}{}
+		}
+		h.subs[t][sub] = struct{}{}
+	}
+	return sub
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, t := range sub.topics {
+		delete(h.subs[t], sub)
+		if len(h.subs[t]) == 0 {
+			delete(h.subs, t)
+		}
+	}
+	close(sub.ch)
+}
+
+// Run relays updates from Redis to local subscribers until ctx is
+// cancelled. The Redis client reconnects on its own; updates published
+// while it is disconnected are lost.
+func (h *Hub) Run(ctx context.Context) {
+	pubsub := h.redis.Subscribe(ctx, redisChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			var update Update
+			if err := json.Unmarshal([]byte(msg.Payload), &update); err != nil {
+				log.Printf("Bad realtime update: %v", err)
+				continue
+			}
+			h.dispatch(update)
+		}
+	}
+}
+
+func (h *Hub) dispatch(update Update) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	seen := map[*Subscription]struct{}{}
+	for _, t := range update.Topics {
+		for sub := range h.subs[t] {
+			if _, ok := seen[sub]; ok {
+				continue
+			}
+			seen[sub] = struct{}{}
+			select {
+			case sub.ch <- update:
+			default:
+				log.Printf("Dropping %s update %s for a slow subscriber", update.Type, update.ID)
+			}
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Permission is what a principal may do with a media item. Each level
+// includes the ones below it.
+type Permission int
+
+const (
+	PermNone Permission = iota
+	PermView
+	PermDownload
+	PermEdit
+	PermOwner
+)
+
+var permissionNames = map[string]Permission{
+	"view":     PermView,
+	"download": PermDownload,
+	"edit":     PermEdit,
+	"owner":    PermOwner,
+}
+
+func (p Permission) String() string {
+	for name, perm := range permissionNames {
+		if perm == p {
+			return name
+		}
+	}
+	return "none"
+}
+
+// ParsePermission maps a MediaShare permission to its level; unknown
+// values grant nothing.
+func ParsePermission(s string) Permission {
+	return permissionNames[s]
+}
+
+var ErrForbidden = errors.New("forbidden")
+
+// Principal is the authenticated caller with the workspaces, channels and
+// roles their token grants. Callers using an API key have KeyID and Scopes
+// set instead of roles.
+type Principal struct {
+	UserID         string
+	WorkspaceIDs   []string
+	ChannelIDs     []string
+	Roles          []string          // platform roles
+	WorkspaceRoles map[string]string // workspace ID -> role name
+	KeyID          string
+	Scopes         []string
+	AnyWorkspace   bool // API key not restricted to WorkspaceIDs
+}
+
+func (p *Principal) InWorkspace(workspaceID string) bool {
+	return workspaceID != "" && (p.AnyWorkspace || contains(p.WorkspaceIDs, workspaceID))
+}
+
+// HasScope reports whether p may act within scope. Users are bounded by
+// the access policy alone; API keys also need the scope, or admin.
+func (p *Principal) HasScope(scope string) bool {
+	return p.KeyID == "" || contains(p.Scopes, scope) || contains(p.Scopes, ScopeAdmin)
+}
+
+func (p *Principal) InChannel(channelID string) bool {
+	return channelID != "" && contains(p.ChannelIDs, channelID)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller set by the auth middleware, or an empty
+// principal that is granted nothing.
+func PrincipalFrom(ctx context.Context) *Principal {
+	if p, ok := ctx.Value(principalKey{}).(*Principal); ok {
+		return p
+	}
+	return &Principal{}
+}
+
+type mediaKey struct{}
+
+// WithMedia records media the request has already loaded, so services
+// acting on it don't look it up again.
+func WithMedia(ctx context.Context, media *models.Media) context.Context {
+	return context.WithValue(ctx, mediaKey{}, media)
+}
+
+// MediaFrom returns the media recorded by WithMedia if it is mediaID.
+func MediaFrom(ctx context.Context, mediaID string) (*models.Media, bool) {
+	media, ok := ctx.Value(mediaKey{}).(*models.Media)
+	if !ok || media.ID != mediaID {
+		return nil, false
+	}
+	return media, true
+}
+
+// AccessPolicy decides what a principal may do with media. Access comes
+// from, strongest first: ownership, a MediaShare, a member role in the
+// media's workspace or membership of its channel (download), and a public
+// album or gallery containing it (view). Workspace guests get only what is
+// shared with them or posted in channels they belong to.
+type AccessPolicy struct {
+	db *database.MongoDB
+}
+
+func NewAccessPolicy(db *database.MongoDB) *AccessPolicy {
+	return &AccessPolicy{db: db}
+}
+
+// RequireMedia returns mongo.ErrNoDocuments if the media doesn't exist and
+// ErrForbidden if p lacks want.
+func (a *AccessPolicy) RequireMedia(ctx context.Context, p *Principal, mediaID string, want Permission) error {
+	_, err := a.LoadMedia(ctx, p, mediaID, want)
+	return err
+}
+
+// LoadMedia is RequireMedia returning the owner, type and metadata of the
+// media, for callers that go on to need them.
+func (a *AccessPolicy) LoadMedia(ctx context.Context, p *Principal, mediaID string, want Permission) (*models.Media, error) {
+	var media models.Media
+	err := a.db.Collection("media").FindOne(ctx, bson.M{"_id": mediaID},
+		options.FindOne().SetProjection(bson.M{"userId": 1, "type": 1, "metadata": 1}),
+	).Decode(&media)
+	if err != nil {
+		return nil, err
+	}
+	got, err := a.resolve(ctx, p, &media, want)
+	if err != nil {
+		return nil, err
+	}
+	if got < want {
+		return nil, ErrForbidden
+	}
+	return &media, nil
+}
+
+// CanView reports whether p may view media loaded with its owner and
+// metadata, for filtering listings.
+func (a *AccessPolicy) CanView(ctx context.Context, p *Principal, media *models.Media) (bool, error) {
+	got, err := a.resolve(ctx, p, media, PermView)
+	if err != nil {
+		return false, err
+	}
+	return got >= PermView, nil
+}
+
+// FilterViewable keeps, in order, the IDs of media p may view. Media that
+// no longer exist are dropped.
+func (a *AccessPolicy) FilterViewable(ctx context.Context, p *Principal, mediaIDs []string) ([]string, error) {
+	cursor, err := a.db.Collection("media").Find(ctx, bson.M{"_id": bson.M{"$in": mediaIDs}},
+		options.Find().SetProjection(bson.M{"userId": 1, "metadata": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var found []models.Media
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.Media, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+
+	viewable := []string{}
+	for _, id := range mediaIDs {
+		media, ok := byID[id]
+		if !ok {
+			continue
+		}
+		ok, err := a.CanView(ctx, p, media)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			viewable = append(viewable, id)
+		}
+	}
+	return viewable, nil
+}
+
+// RequireMediaAll checks want on every ID; missing media count as
+// forbidden so callers can't probe for IDs.
+func (a *AccessPolicy) RequireMediaAll(ctx context.Context, p *Principal, mediaIDs []string, want Permission) error {
+	for _, id := range mediaIDs {
+		if err := a.RequireMedia(ctx, p, id, want); err != nil {
+			return ErrForbidden
+		}
+	}
+	return nil
+}
+
+// resolve works through the sources cheapest first and stops as soon as
+// want is reached, so the result may understate access above want.
+func (a *AccessPolicy) resolve(ctx context.Context, p *Principal, media *models.Media, want Permission) (Permission, error) {
+	if p.UserID == "" {
+		return PermNone, nil
+	}
+	if media.UserID == p.UserID {
+		return PermOwner, nil
+	}
+
+	got := PermNone
+	role, err := a.WorkspaceRole(ctx, p, media.Metadata["workspaceId"])
+	if err != nil {
+		return got, err
+	}
+	// Guests get nothing from the workspace itself, only from the channels
+	// they were added to
+	if role >= RoleMember || p.InChannel(media.Metadata["channelId"]) {
+		got = PermDownload
+	}
+	if got >= want {
+		return got, nil
+	}
+
+	shared, err := sharePermission(ctx, a.db, media.ID, p.UserID)
+	if err != nil {
+		return got, err
+	}
+	if shared > got {
+		got = shared
+	}
+	if got >= want || got >= PermView {
+		return got, nil
+	}
+
+	public := bson.M{"mediaIds": media.ID, "isPublic": true}
+	for _, coll := range []string{"media_albums", "media_galleries"} {
+		n, err := a.db.Collection(coll).CountDocuments(ctx, public, options.Count().SetLimit(1))
+		if err != nil {
+			return got, err
+		}
+		if n > 0 {
+			return PermView, nil
+		}
+	}
+	return got, nil
+}
+
+// activeShares matches shares that haven't expired. The TTL index removes
+// expired ones eventually, but not promptly enough to rely on.
+func activeShares(filter bson.M) bson.M {
+	filter["$or"] = bson.A{
+		bson.M{"expiresAt": nil},
+		bson.M{"expiresAt": bson.M{"$gt": time.Now()}},
+	}
+	return filter
+}
+
+// sharePermission is the strongest permission userID holds on mediaID
+// through unexpired shares.
+func sharePermission(ctx context.Context, db *database.MongoDB, mediaID, userID string) (Permission, error) {
+	cursor, err := db.Collection("media_shares").Find(ctx,
+		activeShares(bson.M{"mediaId": mediaID, "sharedWith": userID}),
+		options.Find().SetProjection(bson.M{"permission": 1}),
+	)
+	if err != nil {
+		return PermNone, err
+	}
+	var shares []models.MediaShare
+	if err := cursor.All(ctx, &shares); err != nil {
+		return PermNone, err
+	}
+	got := PermNone
+	for _, share := range shares {
+		if perm := ParsePermission(share.Permission); perm > got && perm < PermOwner {
+			got = perm
+		}
+	}
+	return got, nil
+}
+
+// requireEditor lets the owner and users holding an edit share change
+// media.
+func requireEditor(ctx context.Context, db *database.MongoDB, media *models.Media, userID string) error {
+	if media.UserID == userID {
+		return nil
+	}
+	perm, err := sharePermission(ctx, db, media.ID, userID)
+	if err != nil {
+		return err
+	}
+	if perm < PermEdit {
+		return fmt.Errorf("unauthorized")
+	}
+	return nil
+}
+
+// RequireWorkspace guards reading what goes on in a workspace as a whole,
+// which guests may not.
+func (a *AccessPolicy) RequireWorkspace(ctx context.Context, p *Principal, workspaceID string) error {
+	return a.RequireRole(ctx, p, workspaceID, RoleMember)
+}
+
+func (a *AccessPolicy) RequireChannel(p *Principal, channelID string) error {
+	if !p.InChannel(channelID) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// RequirePlacement guards putting media into a workspace and channel,
+// which needs membership of both. Empty IDs aren't checked.
+func (a *AccessPolicy) RequirePlacement(ctx context.Context, p *Principal, workspaceID, channelID string) error {
+	if workspaceID != "" {
+		if err := a.RequireRole(ctx, p, workspaceID, RoleMember); err != nil {
+			return err
+		}
+	}
+	if channelID != "" {
+		return a.RequireChannel(p, channelID)
+	}
+	return nil
+}
+
+// RequireCollection guards reading an album or gallery: public ones are
+// open to everyone, others to their creator and members of their
+// workspace, but not its guests.
+func (a *AccessPolicy) RequireCollection(ctx context.Context, p *Principal, createdBy, workspaceID string, isPublic bool) error {
+	if isPublic || (p.UserID != "" && p.UserID == createdBy) {
+		return nil
+	}
+	return a.RequireRole(ctx, p, workspaceID, RoleMember)
+}
+
+// RequireSelf guards per-user listings, which only their owner may read.
+func (a *AccessPolicy) RequireSelf(p *Principal, userID string) error {
+	if p.UserID == "" || p.UserID != userID {
+		return ErrForbidden
+	}
+	return nil
+}
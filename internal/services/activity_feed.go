@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxFeedLimit = 200
+	// Consecutive entries by the same actor further apart than this start a
+	// new group.
+	activityGroupGap = 30 * time.Minute
+	// A group lists at most this many media IDs; Count still covers all.
+	maxGroupMediaIDs = 20
+	// Reconnecting stream clients get at most this many missed entries.
+	maxFeedReplay = 500
+)
+
+var activityVerbs = map[string]string{
+	AuditUpload:         "uploaded",
+	AuditView:           "viewed",
+	AuditDownload:       "downloaded",
+	AuditStream:         "streamed",
+	AuditRename:         "renamed",
+	AuditMetadata:       "updated",
+	AuditMove:           "moved",
+	AuditCopy:           "copied",
+	AuditTag:            "tagged",
+	AuditUntag:          "untagged",
+	AuditShare:          "shared",
+	AuditUnshare:        "unshared",
+	AuditShareLink:      "created a link to",
+	AuditShareLinkOff:   "disabled a link to",
+	AuditTrash:          "trashed",
+	AuditRestore:        "restored",
+	AuditVersionCreate:  "added a version of",
+	AuditVersionDelete:  "deleted a version of",
+	AuditVersionRestore: "restored a version of",
+	AuditDelete:         "deleted",
+	AuditReassign:       "took ownership of",
+	AuditAlbumAdd:       "added",
+	AuditAlbumRemove:    "removed",
+}
+
+var mediaNouns = map[string][2]string{
+	"image":    {"image", "images"},
+	"video":    {"video", "videos"},
+	"audio":    {"audio file", "audio files"},
+	"document": {"document", "documents"},
+}
+
+// ActivityFilter narrows a workspace feed. Empty fields match everything.
+type ActivityFilter struct {
+	Actions   []string
+	ActorID   string
+	MediaType string
+	From      string
+	To        string
+}
+
+type activityMatcher struct {
+	actions   map[string]bool
+	actorID   string
+	mediaType string
+	from, to  time.Time
+}
+
+func (f ActivityFilter) compile() (*activityMatcher, error) {
+	m := &activityMatcher{actorID: f.ActorID, mediaType: f.MediaType}
+	if len(f.Actions) > 0 {
+		m.actions = map[string]bool{}
+		for _, action := range f.Actions {
+			if _, ok := activityVerbs[action]; !ok {
+				return nil, &InvalidParamError{Param: "action", Message: fmt.Sprintf("unknown action %q", action)}
+			}
+			m.actions[action] = true
+		}
+	}
+	var err error
+	if f.From != "" {
+		if m.from, err = parseRangeBound(f.From, time.UTC, false); err != nil {
+			return nil, &InvalidParamError{Param: "from", Message: err.Error()}
+		}
+	}
+	if f.To != "" {
+		if m.to, err = parseRangeBound(f.To, time.UTC, true); err != nil {
+			return nil, &InvalidParamError{Param: "to", Message: err.Error()}
+		}
+	}
+	return m, nil
+}
+
+func (m *activityMatcher) filter(workspaceID string) bson.M {
+	filter := bson.M{"workspaceId": workspaceID, "seq": bson.M{"$exists": true}}
+	if len(m.actions) > 0 {
+		actions := make([]string, 0, len(m.actions))
+		for action := range m.actions {
+			actions = append(actions, action)
+		}
+		filter["action"] = bson.M{"$in": actions}
+	}
+	if m.actorID != "" {
+		filter["userId"] = m.actorID
+	}
+	if m.mediaType != "" {
+		filter["mediaType"] = m.mediaType
+	}
+	createdAt := bson.M{}
+	if !m.from.IsZero() {
+		createdAt["$gte"] = m.from
+	}
+	if !m.to.IsZero() {
+		createdAt["$lt"] = m.to
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+	return filter
+}
+
+func (m *activityMatcher) matches(e *models.MediaActivity) bool {
+	return (m.actions == nil || m.actions[e.Action]) &&
+		(m.actorID == "" || e.UserID == m.actorID) &&
+		(m.mediaType == "" || e.MediaType == m.mediaType) &&
+		(m.from.IsZero() || !e.CreatedAt.Before(m.from)) &&
+		(m.to.IsZero() || e.CreatedAt.Before(m.to))
+}
+
+// GetWorkspaceFeed returns a page of workspace activity, newest first, with
+// the same page folded into display groups. Pages are keyed on the chain
+// seq: pass the returned NextCursor as cursor to continue. A group can be
+// split across pages.
+func (s *ActivityService) GetWorkspaceFeed(ctx context.Context, workspaceID string, f ActivityFilter, cursor string, limit int64) (*models.ActivityFeed, error) {
+	m, err := f.compile()
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxFeedLimit {
+		limit = maxFeedLimit
+	}
+
+	filter := m.filter(workspaceID)
+	if cursor != "" {
+		before, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || before <= 0 {
+			return nil, &InvalidParamError{Param: "cursor", Message: "invalid cursor"}
+		}
+		filter["seq"] = bson.M{"$lt": before}
+	}
+
+	cur, err := s.db.Collection("media_activity").Find(ctx, filter,
+		options.Find().SetSort(bson.M{"seq": -1}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.MediaActivity
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	feed := &models.ActivityFeed{Entries: entries, Groups: groupActivity(entries)}
+	if feed.Entries == nil {
+		feed.Entries = []models.MediaActivity{}
+	}
+	if int64(len(entries)) == limit {
+		feed.NextCursor = strconv.FormatInt(entries[len(entries)-1].Seq, 10)
+	}
+	return feed, nil
+}
+
+// activityTarget is the album or channel an entry put its media in or took
+// it out of, if any, with the album's name at the time.
+func activityTarget(e *models.MediaActivity) (kind, id, name string) {
+	switch e.Action {
+	case AuditAlbumAdd:
+		return "album", e.After["albumId"], e.After["album"]
+	case AuditAlbumRemove:
+		return "album", e.Before["albumId"], e.Before["album"]
+	case AuditUpload:
+		if id := e.After["channelId"]; id != "" {
+			return "channel", id, ""
+		}
+	}
+	return "", "", ""
+}
+
+// groupActivity folds runs of the same actor doing the same thing to the
+// same kind of media in the same place, e.g. "uploaded 12 images to
+// Design", into one group. entries must be newest first.
+func groupActivity(entries []models.MediaActivity) []models.ActivityGroup {
+	groups := []models.ActivityGroup{}
+	var seen map[string]bool
+	for _, e := range entries {
+		targetType, targetID, targetName := activityTarget(&e)
+		if n := len(groups); n > 0 {
+			g := &groups[n-1]
+			if g.ActorID == e.UserID && g.Action == e.Action && g.MediaType == e.MediaType &&
+				g.TargetType == targetType && g.TargetID == targetID &&
+				g.StartedAt.Sub(e.CreatedAt) <= activityGroupGap {
+				g.Count++
+				g.StartedAt = e.CreatedAt
+				if !seen[e.MediaID] && len(g.MediaIDs) < maxGroupMediaIDs {
+					seen[e.MediaID] = true
+					g.MediaIDs = append(g.MediaIDs, e.MediaID)
+				}
+				continue
+			}
+			groups[n-1].Summary = activitySummary(g)
+		}
+		seen = map[string]bool{e.MediaID: true}
+		groups = append(groups, models.ActivityGroup{
+			WorkspaceID: e.WorkspaceID,
+			ActorID:     e.UserID,
+			Action:      e.Action,
+			MediaType:   e.MediaType,
+			TargetType:  targetType,
+			TargetID:    targetID,
+			TargetName:  targetName,
+			Count:       1,
+			MediaIDs:    []string{e.MediaID},
+			StartedAt:   e.CreatedAt,
+			EndedAt:     e.CreatedAt,
+			LastSeq:     e.Seq,
+		})
+	}
+	if n := len(groups); n > 0 {
+		groups[n-1].Summary = activitySummary(&groups[n-1])
+	}
+	return groups
+}
+
+// activitySummary describes a group without the actor, whose display name
+// the UI resolves: "uploaded 12 images to Design". Channels are named by
+// the chat service, so they appear by ID.
+func activitySummary(g *models.ActivityGroup) string {
+	verb, ok := activityVerbs[g.Action]
+	if !ok {
+		verb = g.Action
+	}
+	noun, ok := mediaNouns[g.MediaType]
+	if !ok {
+		noun = [2]string{"file", "files"}
+	}
+	summary := fmt.Sprintf("%s %d %s", verb, g.Count, noun[1])
+	if g.Count == 1 {
+		summary = fmt.Sprintf("%s 1 %s", verb, noun[0])
+	}
+	if g.TargetType == "" {
+		return summary
+	}
+	place := g.TargetName
+	if place == "" {
+		place = g.TargetType + " " + g.TargetID
+	}
+	if g.Action == AuditAlbumRemove {
+		return summary + " from " + place
+	}
+	return summary + " to " + place
+}
+
+func activityChannel(workspaceID string) string {
+	return "activity:ws:" + workspaceID
+}
+
+// SubscribeWorkspace streams new workspace activity matching f. Entries
+// after afterSeq are replayed from the log first so a reconnecting client
+// with a Last-Event-ID misses nothing. The channel closes when ctx is done.
+func (s *ActivityService) SubscribeWorkspace(ctx context.Context, workspaceID string, f ActivityFilter, afterSeq int64) (<-chan models.MediaActivity, error) {
+	m, err := f.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	// Subscribe before replaying so nothing written in between is lost
+	pubsub := s.redis.Subscribe(ctx, activityChannel(workspaceID))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	var replay []models.MediaActivity
+	if afterSeq > 0 {
+		filter := m.filter(workspaceID)
+		filter["seq"] = bson.M{"$gt": afterSeq}
+		cur, err := s.db.Collection("media_activity").Find(ctx, filter,
+			options.Find().SetSort(bson.M{"seq": 1}).SetLimit(maxFeedReplay),
+		)
+		if err == nil {
+			err = cur.All(ctx, &replay)
+		}
+		if err != nil {
+			pubsub.Close()
+			return nil, err
+		}
+	}
+
+	out := make(chan models.MediaActivity, 64)
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+
+		send := func(e models.MediaActivity) bool {
+			select {
+			case out <- e:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		// Live entries can arrive slightly out of seq order, so only those
+		// already covered by the replay are skipped.
+		replayed := afterSeq
+		for _, e := range replay {
+			if !send(e) {
+				return
+			}
+			replayed = e.Seq
+		}
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var e models.MediaActivity
+				if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+					log.Printf("Bad activity message on %s: %v", msg.Channel, err)
+					continue
+				}
+				if e.Seq <= replayed || !m.matches(&e) {
+					continue
+				}
+				if !send(e) {
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
@@ -2,35 +2,32 @@ package services
 
 import (
 	"context"
-	"time"
 
-	"github.com/google/uuid"
 	"github.com/quckapp/media-service/internal/database"
 	"github.com/quckapp/media-service/internal/models"
+	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ActivityService struct {
-	db *database.MongoDB
+	db    *database.MongoDB
+	redis *redis.Client
+	audit *Auditor
 }
 
-func NewActivityService(db *database.MongoDB) *ActivityService {
-	return &ActivityService{db: db}
+func NewActivityService(db *database.MongoDB, redis *redis.Client, audit *Auditor) *ActivityService {
+	return &ActivityService{db: db, redis: redis, audit: audit}
 }
 
+// LogActivity goes through the Auditor so the entry joins the workspace's
+// hash chain like every other activity.
 func (s *ActivityService) LogActivity(ctx context.Context, mediaID, userID, action, details string) error {
-	activity := &models.MediaActivity{
-		ID:        uuid.New().String(),
-		MediaID:   mediaID,
-		UserID:    userID,
-		Action:    action,
-		Details:   details,
-		CreatedAt: time.Now(),
-	}
-
-	_, err := s.db.Collection("media_activity").InsertOne(ctx, activity)
-	return err
+	activity := mediaActivity(auditTarget(ctx, mediaID), action)
+	activity.UserID = userID
+	activity.Details = details
+	s.audit.Record(ctx, activity)
+	return nil
 }
 
 func (s *ActivityService) GetByMedia(ctx context.Context, mediaID string, limit int64) ([]models.MediaActivity, error) {
@@ -13,11 +13,12 @@ import (
 )
 
 type AlbumService struct {
-	db *database.MongoDB
+	db    *database.MongoDB
+	audit *Auditor
 }
 
-func NewAlbumService(db *database.MongoDB) *AlbumService {
-	return &AlbumService{db: db}
+func NewAlbumService(db *database.MongoDB, audit *Auditor) *AlbumService {
+	return &AlbumService{db: db, audit: audit}
 }
 
 func (s *AlbumService) Create(ctx context.Context, userID string, req *models.CreateAlbumRequest) (*models.MediaAlbum, error) {
@@ -146,7 +147,11 @@ func (s *AlbumService) AddMedia(ctx context.Context, albumID, userID string, med
 			"$set":      bson.M{"updatedAt": time.Now()},
 		},
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	s.recordChange(ctx, album, userID, AuditAlbumAdd, mediaIDs, false)
+	return nil
 }
 
 func (s *AlbumService) RemoveMedia(ctx context.Context, albumID, userID string, mediaIDs []string) error {
@@ -165,7 +170,35 @@ func (s *AlbumService) RemoveMedia(ctx context.Context, albumID, userID string,
 			"$set":     bson.M{"updatedAt": time.Now()},
 		},
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	s.recordChange(ctx, album, userID, AuditAlbumRemove, mediaIDs, true)
+	return nil
+}
+
+// recordChange audits the media an add or remove actually changed, given
+// the album as it was before.
+func (s *AlbumService) recordChange(ctx context.Context, album *models.MediaAlbum, userID, action string, mediaIDs []string, wasIn bool) {
+	in := make(map[string]bool, len(album.MediaIDs))
+	for _, id := range album.MediaIDs {
+		in[id] = true
+	}
+	for _, id := range mediaIDs {
+		if in[id] != wasIn {
+			continue
+		}
+		in[id] = !wasIn
+		entry := mediaActivity(auditTarget(ctx, id), action)
+		entry.UserID = userID
+		ref := map[string]string{"albumId": album.ID, "album": album.Name}
+		if wasIn {
+			entry.Before = ref
+		} else {
+			entry.After = ref
+		}
+		s.audit.Record(ctx, entry)
+	}
 }
 
 func (s *AlbumService) GetPublicByWorkspace(ctx context.Context, workspaceID string, limit int64) ([]models.MediaAlbum, error) {
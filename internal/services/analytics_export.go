@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ExportSink receives a report one row at a time. Columns is called once,
+// before any Row, and only after the query has been opened successfully, so
+// an error returned before Columns can still be reported normally.
+type ExportSink interface {
+	Columns(names ...string) error
+	Row(values ...interface{}) error
+}
+
+type exportFunc func(s *AnalyticsService, ctx context.Context, workspaceID string, w *trendWindow, sink ExportSink) error
+
+var exportReports = map[string]exportFunc{
+	"upload-trends":   (*AnalyticsService).exportUploadTrends,
+	"storage-trends":  (*AnalyticsService).exportStorageTrends,
+	"file-types":      (*AnalyticsService).exportFileTypes,
+	"user-stats":      (*AnalyticsService).exportUserStats,
+	"most-viewed":     (*AnalyticsService).exportMostViewed,
+	"unique-viewers":  (*AnalyticsService).exportUniqueViewers,
+	"never-accessed":  (*AnalyticsService).exportNeverAccessed,
+	"workspace-stats": (*AnalyticsService).exportWorkspaceStats,
+}
+
+// Export streams a workspace report restricted to the query's date range.
+// Row-level reports iterate a cursor; trend series hold one entry per bucket.
+func (s *AnalyticsService) Export(ctx context.Context, workspaceID, report string, q TrendQuery, sink ExportSink) error {
+	export, ok := exportReports[report]
+	if !ok {
+		return &InvalidParamError{Param: "report", Message: fmt.Sprintf("unknown report %q", report)}
+	}
+	w, err := q.resolve(time.Now())
+	if err != nil {
+		return err
+	}
+	return export(s, ctx, workspaceID, w, sink)
+}
+
+func (w *trendWindow) createdMatch(workspaceID string) bson.M {
+	match := workspaceMatch(workspaceID)
+	match["createdAt"] = bson.M{"$gte": w.start(), "$lt": w.end}
+	return match
+}
+
+// streamCursor decodes each document into a fresh T and hands it to fn.
+func streamCursor[T any](ctx context.Context, cursor *mongo.Cursor, fn func(T) error) error {
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var doc T
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (s *AnalyticsService) exportUploadTrends(ctx context.Context, workspaceID string, w *trendWindow, sink ExportSink) error {
+	buckets, err := s.uploadBuckets(ctx, workspaceID, w)
+	if err != nil {
+		return err
+	}
+	if err := sink.Columns("date", "count", "totalSize"); err != nil {
+		return err
+	}
+	for _, start := range w.buckets {
+		b := buckets[start.Unix()]
+		if err := sink.Row(w.label(start), b.Count, b.TotalSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AnalyticsService) exportStorageTrends(ctx context.Context, workspaceID string, w *trendWindow, sink ExportSink) error {
+	used, err := s.storedBefore(ctx, workspaceID, w.start())
+	if err != nil {
+		return err
+	}
+	buckets, err := s.uploadBuckets(ctx, workspaceID, w)
+	if err != nil {
+		return err
+	}
+	if err := sink.Columns("date", "usedBytes", "usedMB"); err != nil {
+		return err
+	}
+	for _, start := range w.buckets {
+		used += buckets[start.Unix()].TotalSize
+		if err := sink.Row(w.label(start), used, float64(used)/(1<<20)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AnalyticsService) exportFileTypes(ctx context.Context, workspaceID string, w *trendWindow, sink ExportSink) error {
+	cursor, err := s.db.Collection("media").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: w.createdMatch(workspaceID)}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       "$type",
+			"count":     bson.M{"$sum": 1},
+			"totalSize": bson.M{"$sum": "$size"},
+		}}},
+		{{Key: "$sort", Value: bson.M{"count": -1}}},
+	})
+	if err != nil {
+		return err
+	}
+	if err := sink.Columns("type", "count", "totalSize"); err != nil {
+		cursor.Close(ctx)
+		return err
+	}
+	return streamCursor(ctx, cursor, func(r struct {
+		Type      string `bson:"_id"`
+		Count     int64  `bson:"count"`
+		TotalSize int64  `bson:"totalSize"`
+	}) error {
+		return sink.Row(r.Type, r.Count, r.TotalSize)
+	})
+}
+
+func (s *AnalyticsService) exportUserStats(ctx context.Context, workspaceID string, w *trendWindow, sink ExportSink) error {
+	cursor, err := s.db.Collection("media").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: w.createdMatch(workspaceID)}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$userId",
+			"fileCount":  bson.M{"$sum": 1},
+			"totalSize":  bson.M{"$sum": "$size"},
+			"lastUpload": bson.M{"$max": "$createdAt"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "totalSize", Value: -1}, {Key: "_id", Value: 1}}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	if err := sink.Columns("userId", "fileCount", "totalSize", "lastUpload"); err != nil {
+		cursor.Close(ctx)
+		return err
+	}
+	return streamCursor(ctx, cursor, func(r struct {
+		UserID     string    `bson:"_id"`
+		FileCount  int64     `bson:"fileCount"`
+		TotalSize  int64     `bson:"totalSize"`
+		LastUpload time.Time `bson:"lastUpload"`
+	}) error {
+		return sink.Row(r.UserID, r.FileCount, r.TotalSize, r.LastUpload)
+	})
+}
+
+func (s *AnalyticsService) exportMostViewed(ctx context.Context, workspaceID string, w *trendWindow, sink ExportSink) error {
+	cursor, err := s.db.Collection("media_usage_hourly").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"workspaceId": workspaceID, "hour": bson.M{"$gte": w.start(), "$lt": w.end}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       "$mediaId",
+			"views":     bson.M{"$sum": "$views"},
+			"downloads": bson.M{"$sum": "$downloads"},
+			"streams":   bson.M{"$sum": "$streams"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "views", Value: -1}, {Key: "downloads", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "media",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"pipeline":     bson.A{bson.M{"$project": bson.M{"filename": 1, "type": 1}}},
+			"as":           "media",
+		}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	if err := sink.Columns("mediaId", "filename", "type", "views", "downloads", "streams"); err != nil {
+		cursor.Close(ctx)
+		return err
+	}
+	return streamCursor(ctx, cursor, func(r struct {
+		MediaID   string `bson:"_id"`
+		Views     int64  `bson:"views"`
+		Downloads int64  `bson:"downloads"`
+		Streams   int64  `bson:"streams"`
+		Media     []struct {
+			Filename string `bson:"filename"`
+			Type     string `bson:"type"`
+		} `bson:"media"`
+	}) error {
+		var filename, mediaType string
+		if len(r.Media) > 0 {
+			filename, mediaType = r.Media[0].Filename, r.Media[0].Type
+		}
+		return sink.Row(r.MediaID, filename, mediaType, r.Views, r.Downloads, r.Streams)
+	})
+}
+
+// exportUniqueViewers emits one row per UTC day; days older than the
+// HyperLogLog retention report zero.
+func (s *AnalyticsService) exportUniqueViewers(ctx context.Context, workspaceID string, w *trendWindow, sink ExportSink) error {
+	if err := sink.Columns("date", "uniqueViewers"); err != nil {
+		return err
+	}
+	start := w.start().UTC()
+	for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC); day.Before(w.end); day = day.AddDate(0, 0, 1) {
+		label := day.Format("2006-01-02")
+		count, err := s.redis.PFCount(ctx, workspaceViewersKey(workspaceID, label)).Result()
+		if err != nil {
+			return err
+		}
+		if err := sink.Row(label, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AnalyticsService) exportNeverAccessed(ctx context.Context, workspaceID string, w *trendWindow, sink ExportSink) error {
+	filter := w.createdMatch(workspaceID)
+	filter["lastAccessedAt"] = bson.M{"$exists": false}
+
+	cursor, err := s.db.Collection("media").Find(ctx, filter,
+		options.Find().
+			SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).
+			SetProjection(bson.M{"filename": 1, "type": 1, "userId": 1, "size": 1, "createdAt": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	if err := sink.Columns("mediaId", "filename", "type", "userId", "size", "createdAt"); err != nil {
+		cursor.Close(ctx)
+		return err
+	}
+	return streamCursor(ctx, cursor, func(m struct {
+		ID        string    `bson:"_id"`
+		Filename  string    `bson:"filename"`
+		Type      string    `bson:"type"`
+		UserID    string    `bson:"userId"`
+		Size      int64     `bson:"size"`
+		CreatedAt time.Time `bson:"createdAt"`
+	}) error {
+		return sink.Row(m.ID, m.Filename, m.Type, m.UserID, m.Size, m.CreatedAt)
+	})
+}
+
+// exportWorkspaceStats flattens WorkspaceMediaStats for uploads in the range
+// into dimension/key rows: one per type, one per uploader, then the total.
+func (s *AnalyticsService) exportWorkspaceStats(ctx context.Context, workspaceID string, w *trendWindow, sink ExportSink) error {
+	match := w.createdMatch(workspaceID)
+	group := func(key string) (*mongo.Cursor, error) {
+		return s.db.Collection("media").Aggregate(ctx, mongo.Pipeline{
+			{{Key: "$match", Value: match}},
+			{{Key: "$group", Value: bson.M{
+				"_id":       key,
+				"count":     bson.M{"$sum": 1},
+				"totalSize": bson.M{"$sum": "$size"},
+			}}},
+			{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		}, options.Aggregate().SetAllowDiskUse(true))
+	}
+	type row struct {
+		Key       string `bson:"_id"`
+		Count     int64  `bson:"count"`
+		TotalSize int64  `bson:"totalSize"`
+	}
+
+	byType, err := group("$type")
+	if err != nil {
+		return err
+	}
+	if err := sink.Columns("dimension", "key", "files", "totalSize"); err != nil {
+		byType.Close(ctx)
+		return err
+	}
+
+	var totalFiles, totalSize int64
+	err = streamCursor(ctx, byType, func(r row) error {
+		totalFiles += r.Count
+		totalSize += r.TotalSize
+		return sink.Row("type", r.Key, r.Count, r.TotalSize)
+	})
+	if err != nil {
+		return err
+	}
+
+	byUser, err := group("$userId")
+	if err != nil {
+		return err
+	}
+	err = streamCursor(ctx, byUser, func(r row) error {
+		return sink.Row("user", r.Key, r.Count, r.TotalSize)
+	})
+	if err != nil {
+		return err
+	}
+
+	return sink.Row("total", "", totalFiles, totalSize)
+}
@@ -2,34 +2,185 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/quckapp/media-service/internal/database"
 	"github.com/quckapp/media-service/internal/models"
+	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+const maxTrendDays = 730
+
 type AnalyticsService struct {
-	db *database.MongoDB
+	db    *database.MongoDB
+	redis *redis.Client
+	audit *Auditor
+}
+
+func NewAnalyticsService(db *database.MongoDB, redis *redis.Client, audit *Auditor) *AnalyticsService {
+	return &AnalyticsService{db: db, redis: redis, audit: audit}
+}
+
+// TrendQuery selects the window and bucketing for a trend series. Interval is
+// day, week (ISO, Monday start) or month; Timezone is an IANA name. From and To
+// are optional YYYY-MM-DD dates (To inclusive) or RFC 3339 instants; when From
+// is empty the window is the last Days days up to To.
+type TrendQuery struct {
+	Days     int
+	Interval string
+	Timezone string
+	From     string
+	To       string
+}
+
+// trendWindow is a resolved TrendQuery: the gap-free list of bucket start
+// instants, oldest first, all computed in loc, and the exclusive end.
+type trendWindow struct {
+	interval string
+	loc      *time.Location
+	buckets  []time.Time
+	end      time.Time
+}
+
+func (q TrendQuery) resolve(now time.Time) (*trendWindow, error) {
+	days := q.Days
+	if days == 0 {
+		days = 30
+	}
+	if days < 1 || days > maxTrendDays {
+		return nil, &InvalidParamError{Param: "days", Message: fmt.Sprintf("must be between 1 and %d", maxTrendDays)}
+	}
+
+	interval := q.Interval
+	if interval == "" {
+		interval = "day"
+	}
+	if interval != "day" && interval != "week" && interval != "month" {
+		return nil, &InvalidParamError{Param: "interval", Message: "must be day, week or month"}
+	}
+
+	loc := time.UTC
+	if q.Timezone != "" {
+		var err error
+		// "Local" is the server's zone to Go but no zone to MongoDB
+		if q.Timezone == "Local" {
+			err = fmt.Errorf("not an IANA zone")
+		} else {
+			loc, err = time.LoadLocation(q.Timezone)
+		}
+		if err != nil {
+			return nil, &InvalidParamError{Param: "tz", Message: fmt.Sprintf("unknown time zone %q", q.Timezone)}
+		}
+	}
+
+	end := now.In(loc)
+	if q.To != "" {
+		t, err := parseRangeBound(q.To, loc, true)
+		if err != nil {
+			return nil, &InvalidParamError{Param: "to", Message: err.Error()}
+		}
+		end = t
+	}
+	// The last Days days include the one end falls in, which is the day
+	// before when end is a midnight (To given as a date)
+	lastDay := (&trendWindow{interval: "day", loc: loc}).truncate(end.Add(-time.Nanosecond))
+	start := lastDay.AddDate(0, 0, -(days - 1))
+	if q.From != "" {
+		t, err := parseRangeBound(q.From, loc, false)
+		if err != nil {
+			return nil, &InvalidParamError{Param: "from", Message: err.Error()}
+		}
+		start = t
+	}
+	if !start.Before(end) {
+		return nil, &InvalidParamError{Param: "from", Message: "must be before to"}
+	}
+	if end.Sub(start) > maxTrendDays*24*time.Hour {
+		return nil, &InvalidParamError{Param: "from", Message: fmt.Sprintf("range must not exceed %d days", maxTrendDays)}
+	}
+
+	w := &trendWindow{interval: interval, loc: loc, end: end}
+	for t := w.truncate(start); t.Before(end); t = w.next(t) {
+		w.buckets = append(w.buckets, t)
+	}
+	return w, nil
+}
+
+// parseRangeBound accepts a calendar date in loc or an RFC 3339 instant. A
+// date used as an upper bound covers the whole day.
+func parseRangeBound(value string, loc *time.Location, upper bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		if upper {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected YYYY-MM-DD or RFC 3339 time")
+	}
+	return t.In(loc), nil
+}
+
+func (w *trendWindow) truncate(t time.Time) time.Time {
+	t = t.In(w.loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, w.loc)
+	switch w.interval {
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, w.loc)
+	}
+	return day
+}
+
+func (w *trendWindow) next(t time.Time) time.Time {
+	switch w.interval {
+	case "week":
+		return t.AddDate(0, 0, 7)
+	case "month":
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+func (w *trendWindow) start() time.Time {
+	return w.buckets[0]
+}
+
+// bucketExpr truncates a date field the same way truncate does, server side.
+func (w *trendWindow) bucketExpr(field string) bson.M {
+	return bson.M{"$dateTrunc": bson.M{
+		"date":        field,
+		"unit":        w.interval,
+		"timezone":    w.loc.String(),
+		"startOfWeek": "monday",
+	}}
+}
+
+func (w *trendWindow) label(t time.Time) string {
+	return t.In(w.loc).Format("2006-01-02")
 }
 
-func NewAnalyticsService(db *database.MongoDB) *AnalyticsService {
-	return &AnalyticsService{db: db}
+func workspaceMatch(workspaceID string) bson.M {
+	return bson.M{"metadata.workspaceId": workspaceID}
 }
 
-func (s *AnalyticsService) GetUploadTrends(ctx context.Context, workspaceID string, days int) ([]models.UploadTrend, error) {
-	startDate := time.Now().AddDate(0, 0, -days)
+// uploadBuckets sums uploads per bucket, keyed by bucket start (unix seconds).
+func (s *AnalyticsService) uploadBuckets(ctx context.Context, workspaceID string, w *trendWindow) (map[int64]models.UploadTrend, error) {
+	match := workspaceMatch(workspaceID)
+	match["createdAt"] = bson.M{"$gte": w.start(), "$lt": w.end}
+
 	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.M{
-			"createdAt": bson.M{"$gte": startDate},
-		}}},
+		{{Key: "$match", Value: match}},
 		{{Key: "$group", Value: bson.M{
-			"_id":       bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$createdAt"}},
+			"_id":       w.bucketExpr("$createdAt"),
 			"count":     bson.M{"$sum": 1},
 			"totalSize": bson.M{"$sum": "$size"},
 		}}},
-		{{Key: "$sort", Value: bson.M{"_id": 1}}},
 	}
 
 	cursor, err := s.db.Collection("media").Aggregate(ctx, pipeline)
@@ -39,59 +190,102 @@ func (s *AnalyticsService) GetUploadTrends(ctx context.Context, workspaceID stri
 	defer cursor.Close(ctx)
 
 	var results []struct {
-		Date      string `bson:"_id"`
-		Count     int64  `bson:"count"`
-		TotalSize int64  `bson:"totalSize"`
+		Bucket    time.Time `bson:"_id"`
+		Count     int64     `bson:"count"`
+		TotalSize int64     `bson:"totalSize"`
 	}
 	if err := cursor.All(ctx, &results); err != nil {
 		return nil, err
 	}
 
-	trends := make([]models.UploadTrend, len(results))
-	for i, r := range results {
-		trends[i] = models.UploadTrend{Date: r.Date, Count: r.Count, TotalSize: r.TotalSize}
+	buckets := make(map[int64]models.UploadTrend, len(results))
+	for _, r := range results {
+		buckets[r.Bucket.Unix()] = models.UploadTrend{Count: r.Count, TotalSize: r.TotalSize}
 	}
-	return trends, nil
+	return buckets, nil
 }
 
-func (s *AnalyticsService) GetStorageTrends(ctx context.Context, workspaceID string, days int) ([]models.StorageTrend, error) {
-	startDate := time.Now().AddDate(0, 0, -days)
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.M{
-			"createdAt": bson.M{"$gte": startDate},
-		}}},
-		{{Key: "$group", Value: bson.M{
-			"_id":    bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$createdAt"}},
-			"usedMB": bson.M{"$sum": bson.M{"$divide": []interface{}{"$size", 1048576}}},
-		}}},
-		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+func (s *AnalyticsService) GetUploadTrends(ctx context.Context, workspaceID string, q TrendQuery) ([]models.UploadTrend, error) {
+	w, err := q.resolve(time.Now())
+	if err != nil {
+		return nil, err
 	}
 
-	cursor, err := s.db.Collection("media").Aggregate(ctx, pipeline)
+	buckets, err := s.uploadBuckets(ctx, workspaceID, w)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
 
-	var results []struct {
-		Date   string `bson:"_id"`
-		UsedMB int64  `bson:"usedMB"`
+	trends := make([]models.UploadTrend, len(w.buckets))
+	for i, start := range w.buckets {
+		trend := buckets[start.Unix()]
+		trend.Date = w.label(start)
+		trends[i] = trend
 	}
-	if err := cursor.All(ctx, &results); err != nil {
+	return trends, nil
+}
+
+// GetStorageTrends reports the workspace's total stored bytes at the end of
+// each bucket: everything uploaded before the window plus the running sum of
+// uploads inside it. Deleted media no longer exist, so history only reflects
+// media that are still stored.
+func (s *AnalyticsService) GetStorageTrends(ctx context.Context, workspaceID string, q TrendQuery) ([]models.StorageTrend, error) {
+	w, err := q.resolve(time.Now())
+	if err != nil {
 		return nil, err
 	}
 
-	trends := make([]models.StorageTrend, len(results))
-	for i, r := range results {
-		trends[i] = models.StorageTrend{Date: r.Date, UsedMB: r.UsedMB}
+	baseline, err := s.storedBefore(ctx, workspaceID, w.start())
+	if err != nil {
+		return nil, err
+	}
+	buckets, err := s.uploadBuckets(ctx, workspaceID, w)
+	if err != nil {
+		return nil, err
+	}
+
+	trends := make([]models.StorageTrend, len(w.buckets))
+	used := baseline
+	for i, start := range w.buckets {
+		used += buckets[start.Unix()].TotalSize
+		trends[i] = models.StorageTrend{
+			Date:      w.label(start),
+			UsedBytes: used,
+			UsedMB:    float64(used) / (1 << 20),
+		}
 	}
 	return trends, nil
 }
 
+func (s *AnalyticsService) storedBefore(ctx context.Context, workspaceID string, before time.Time) (int64, error) {
+	match := workspaceMatch(workspaceID)
+	match["createdAt"] = bson.M{"$lt": before}
+
+	cursor, err := s.db.Collection("media").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "totalSize": bson.M{"$sum": "$size"}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		TotalSize int64 `bson:"totalSize"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result.TotalSize, cursor.Err()
+}
+
 func (s *AnalyticsService) GetFileTypeDistribution(ctx context.Context, workspaceID string) ([]models.FileTypeDistribution, error) {
 	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: workspaceMatch(workspaceID)}},
 		{{Key: "$group", Value: bson.M{
-			"_id":       "$contentType",
+			"_id":       "$type",
 			"count":     bson.M{"$sum": 1},
 			"totalSize": bson.M{"$sum": "$size"},
 		}}},
@@ -121,14 +315,19 @@ func (s *AnalyticsService) GetFileTypeDistribution(ctx context.Context, workspac
 }
 
 func (s *AnalyticsService) GetUserUploadStats(ctx context.Context, workspaceID string, limit int64) ([]models.UserUploadStats, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
 	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: workspaceMatch(workspaceID)}},
 		{{Key: "$group", Value: bson.M{
-			"_id":        "$uploadedBy",
+			"_id":        "$userId",
 			"fileCount":  bson.M{"$sum": 1},
 			"totalSize":  bson.M{"$sum": "$size"},
 			"lastUpload": bson.M{"$max": "$createdAt"},
 		}}},
-		{{Key: "$sort", Value: bson.M{"totalSize": -1}}},
+		{{Key: "$sort", Value: bson.D{{Key: "totalSize", Value: -1}, {Key: "_id", Value: 1}}}},
 		{{Key: "$limit", Value: limit}},
 	}
 
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrendQueryResolveDays(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name  string
+		query TrendQuery
+		first time.Time
+		n     int
+		end   time.Time
+	}{
+		{"one day up to now", TrendQuery{Days: 1}, day(10), 1, now},
+		{"days up to now", TrendQuery{Days: 7}, day(4), 7, now},
+		{"one day up to a date", TrendQuery{Days: 1, To: "2026-03-05"}, day(5), 1, day(6)},
+		{"days up to a date", TrendQuery{Days: 7, To: "2026-03-05"}, time.Date(2026, 2, 27, 0, 0, 0, 0, time.UTC), 7, day(6)},
+		{"days up to an instant", TrendQuery{Days: 2, To: "2026-03-05T12:00:00Z"}, day(4), 2, time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := tt.query.resolve(now)
+			if err != nil {
+				t.Fatalf("resolve: %v", err)
+			}
+			if len(w.buckets) != tt.n {
+				t.Fatalf("got %d buckets %v, want %d", len(w.buckets), w.buckets, tt.n)
+			}
+			if !w.buckets[0].Equal(tt.first) {
+				t.Errorf("first bucket %v, want %v", w.buckets[0], tt.first)
+			}
+			if !w.end.Equal(tt.end) {
+				t.Errorf("end %v, want %v", w.end, tt.end)
+			}
+		})
+	}
+}
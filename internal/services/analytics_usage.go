@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Access event types recorded by RecordAccess.
+const (
+	AccessView     = "view"
+	AccessDownload = "download"
+	AccessStream   = "stream"
+)
+
+const (
+	// A viewer is counted at most once per media, event type and window.
+	accessDedupeWindow = 30 * time.Minute
+	// Daily unique-viewer HyperLogLogs are kept this long, which bounds the
+	// window unique viewer reports can cover.
+	viewerRetentionDays = 90
+	accessRecordTimeout = 5 * time.Second
+)
+
+var accessCounterFields = map[string]string{
+	AccessView:     "views",
+	AccessDownload: "downloads",
+	AccessStream:   "streams",
+}
+
+// RecordAccess records a view, download or stream in the background so the
+// request serving the media is never slowed down or failed by analytics.
+// Only the first access per viewer per dedupe window reaches the audit log.
+func (s *AnalyticsService) RecordAccess(ctx context.Context, mediaID, viewerID, event string) {
+	if _, ok := accessCounterFields[event]; !ok || mediaID == "" || viewerID == "" {
+		return
+	}
+	info := RequestInfoFrom(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(WithRequestInfo(context.Background(), info), accessRecordTimeout)
+		defer cancel()
+		if err := s.recordAccess(ctx, mediaID, viewerID, event, time.Now()); err != nil {
+			log.Printf("Failed to record %s of media %s: %v", event, mediaID, err)
+		}
+	}()
+}
+
+func (s *AnalyticsService) recordAccess(ctx context.Context, mediaID, viewerID, event string, now time.Time) error {
+	window := now.Truncate(accessDedupeWindow)
+	dedupeKey := fmt.Sprintf("media:access:%s:%s:%d", event, mediaID, window.Unix())
+	added, err := s.redis.PFAdd(ctx, dedupeKey, viewerID).Result()
+	if err != nil {
+		return err
+	}
+	s.redis.Expire(ctx, dedupeKey, 2*accessDedupeWindow)
+	if added == 0 {
+		return nil
+	}
+
+	update := bson.M{"$set": bson.M{"lastAccessedAt": now}}
+	if event == AccessView {
+		update["$inc"] = bson.M{"viewCount": 1}
+	}
+	var media models.Media
+	err = s.db.Collection("media").FindOneAndUpdate(ctx, bson.M{"_id": mediaID}, update,
+		options.FindOneAndUpdate().SetProjection(bson.M{"type": 1, "metadata": 1}),
+	).Decode(&media)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	workspaceID := media.Metadata["workspaceId"]
+
+	day := now.UTC().Format("2006-01-02")
+	viewerTTL := (viewerRetentionDays + 1) * 24 * time.Hour
+	mediaViewers := viewersKey(mediaID, day)
+	s.redis.PFAdd(ctx, mediaViewers, viewerID)
+	s.redis.Expire(ctx, mediaViewers, viewerTTL)
+	if workspaceID != "" {
+		workspaceViewers := workspaceViewersKey(workspaceID, day)
+		s.redis.PFAdd(ctx, workspaceViewers, viewerID)
+		s.redis.Expire(ctx, workspaceViewers, viewerTTL)
+	}
+
+	hour := now.UTC().Truncate(time.Hour)
+	_, err = s.db.Collection("media_usage_hourly").UpdateOne(ctx,
+		bson.M{"_id": fmt.Sprintf("%s:%d", mediaID, hour.Unix())},
+		bson.M{
+			"$inc":         bson.M{accessCounterFields[event]: 1},
+			"$setOnInsert": bson.M{"mediaId": mediaID, "workspaceId": workspaceID, "hour": hour},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	entry := mediaActivity(&media, event)
+	entry.UserID = viewerID
+	entry.CreatedAt = now
+	s.audit.Record(ctx, entry)
+	return nil
+}
+
+func viewersKey(mediaID, day string) string {
+	return fmt.Sprintf("media:viewers:%s:%s", mediaID, day)
+}
+
+func workspaceViewersKey(workspaceID, day string) string {
+	return fmt.Sprintf("media:viewers:ws:%s:%s", workspaceID, day)
+}
+
+// countViewers merges the daily HyperLogLogs for the last days days.
+func (s *AnalyticsService) countViewers(ctx context.Context, days int, key func(day string) string) (int64, error) {
+	if days < 1 || days > viewerRetentionDays {
+		return 0, &InvalidParamError{Param: "days", Message: fmt.Sprintf("must be between 1 and %d", viewerRetentionDays)}
+	}
+	today := time.Now().UTC()
+	keys := make([]string, days)
+	for i := range keys {
+		keys[i] = key(today.AddDate(0, 0, -i).Format("2006-01-02"))
+	}
+	return s.redis.PFCount(ctx, keys...).Result()
+}
+
+// GetUniqueViewers estimates distinct viewers of any media in the workspace.
+func (s *AnalyticsService) GetUniqueViewers(ctx context.Context, workspaceID string, days int) (int64, error) {
+	return s.countViewers(ctx, days, func(day string) string {
+		return workspaceViewersKey(workspaceID, day)
+	})
+}
+
+func (s *AnalyticsService) GetMostViewed(ctx context.Context, workspaceID string, days int, limit int64) ([]models.MediaUsage, error) {
+	if days < 1 || days > maxTrendDays {
+		return nil, &InvalidParamError{Param: "days", Message: fmt.Sprintf("must be between 1 and %d", maxTrendDays)}
+	}
+	if limit <= 0 {
+		limit = 20
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"workspaceId": workspaceID,
+			"hour":        bson.M{"$gte": time.Now().UTC().AddDate(0, 0, -days)},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       "$mediaId",
+			"views":     bson.M{"$sum": "$views"},
+			"downloads": bson.M{"$sum": "$downloads"},
+			"streams":   bson.M{"$sum": "$streams"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "views", Value: -1}, {Key: "downloads", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$limit", Value: limit}},
+	}
+
+	cursor, err := s.db.Collection("media_usage_hourly").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var usage []models.MediaUsage
+	if err := cursor.All(ctx, &usage); err != nil {
+		return nil, err
+	}
+	if len(usage) == 0 {
+		return usage, nil
+	}
+
+	ids := make([]string, len(usage))
+	for i, u := range usage {
+		ids[i] = u.MediaID
+	}
+	mediaCursor, err := s.db.Collection("media").Find(ctx,
+		bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"filename": 1, "type": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var media []models.Media
+	if err := mediaCursor.All(ctx, &media); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Media, len(media))
+	for _, m := range media {
+		byID[m.ID] = m
+	}
+	for i := range usage {
+		usage[i].Filename = byID[usage[i].MediaID].Filename
+		usage[i].Type = byID[usage[i].MediaID].Type
+	}
+	return usage, nil
+}
+
+const (
+	defaultNeverAccessedLimit = 50
+	maxNeverAccessedLimit     = 200
+)
+
+// GetNeverAccessed lists workspace media older than olderThanDays that have
+// never been viewed, downloaded or streamed, oldest first.
+func (s *AnalyticsService) GetNeverAccessed(ctx context.Context, workspaceID string, olderThanDays int, limit int64) ([]models.Media, error) {
+	if olderThanDays < 0 {
+		return nil, &InvalidParamError{Param: "days", Message: "must not be negative"}
+	}
+	if limit <= 0 {
+		limit = defaultNeverAccessedLimit
+	}
+	if limit > maxNeverAccessedLimit {
+		limit = maxNeverAccessedLimit
+	}
+	filter := workspaceMatch(workspaceID)
+	filter["lastAccessedAt"] = bson.M{"$exists": false}
+	filter["createdAt"] = bson.M{"$lt": time.Now().AddDate(0, 0, -olderThanDays)}
+
+	cursor, err := s.db.Collection("media").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var media []models.Media
+	if err := cursor.All(ctx, &media); err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// GetMediaUsage returns bucketed access counts for one media item. Unique
+// viewers are counted over whole UTC days and capped at the HLL retention.
+func (s *AnalyticsService) GetMediaUsage(ctx context.Context, mediaID string, q TrendQuery) (*models.MediaUsageReport, error) {
+	w, err := q.resolve(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var media models.Media
+	err = s.db.Collection("media").FindOne(ctx, bson.M{"_id": mediaID},
+		options.FindOne().SetProjection(bson.M{"lastAccessedAt": 1}),
+	).Decode(&media)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.db.Collection("media_usage_hourly").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"mediaId": mediaID, "hour": bson.M{"$gte": w.start(), "$lt": w.end}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":       w.bucketExpr("$hour"),
+			"views":     bson.M{"$sum": "$views"},
+			"downloads": bson.M{"$sum": "$downloads"},
+			"streams":   bson.M{"$sum": "$streams"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Bucket    time.Time `bson:"_id"`
+		Views     int64     `bson:"views"`
+		Downloads int64     `bson:"downloads"`
+		Streams   int64     `bson:"streams"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	byBucket := make(map[int64]models.MediaUsagePoint, len(results))
+	for _, r := range results {
+		byBucket[r.Bucket.Unix()] = models.MediaUsagePoint{Views: r.Views, Downloads: r.Downloads, Streams: r.Streams}
+	}
+
+	report := &models.MediaUsageReport{
+		MediaID:        mediaID,
+		LastAccessedAt: media.LastAccessedAt,
+		Series:         make([]models.MediaUsagePoint, len(w.buckets)),
+	}
+	for i, start := range w.buckets {
+		point := byBucket[start.Unix()]
+		point.Date = w.label(start)
+		report.Series[i] = point
+		report.Views += point.Views
+		report.Downloads += point.Downloads
+		report.Streams += point.Streams
+	}
+
+	days := q.Days
+	if days == 0 {
+		days = 30
+	}
+	if days > viewerRetentionDays {
+		days = viewerRetentionDays
+	}
+	report.UniqueViewers, err = s.countViewers(ctx, days, func(day string) string {
+		return viewersKey(mediaID, day)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// API key scopes. Admin implies the others.
+const (
+	ScopeMediaRead  = "media:read"
+	ScopeMediaWrite = "media:write"
+	ScopeJobsWrite  = "jobs:write"
+	ScopeAdmin      = "admin"
+)
+
+const (
+	// Keys look like qk_<id>_<secret>; the id is hex so the first
+	// underscore after the prefix ends it
+	apiKeyPrefix = "qk_"
+	// lastUsedAt is only rewritten when older than this
+	apiKeyTouchInterval = time.Minute
+)
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+type APIKeyService struct {
+	db *database.MongoDB
+}
+
+func NewAPIKeyService(db *database.MongoDB) *APIKeyService {
+	return &APIKeyService{db: db}
+}
+
+// APIKeyUserID is the user ID a key acts as; media it creates are owned
+// by the key.
+func APIKeyUserID(keyID string) string {
+	return "apikey:" + keyID
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *APIKeyService) Create(ctx context.Context, createdBy string, req *models.CreateAPIKeyRequest) (*models.CreatedAPIKey, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	secretStr := base64.RawURLEncoding.EncodeToString(secret)
+
+	key := models.APIKey{
+		ID:           hex.EncodeToString(id),
+		Name:         req.Name,
+		SecretHash:   hashAPIKeySecret(secretStr),
+		Scopes:       req.Scopes,
+		WorkspaceIDs: req.WorkspaceIDs,
+		CreatedBy:    createdBy,
+		CreatedAt:    time.Now(),
+	}
+	if req.ExpiresIn > 0 {
+		exp := time.Now().AddDate(0, 0, req.ExpiresIn)
+		key.ExpiresAt = &exp
+	}
+
+	if _, err := s.db.Collection("api_keys").InsertOne(ctx, &key); err != nil {
+		return nil, err
+	}
+	return &models.CreatedAPIKey{APIKey: key, Key: apiKeyPrefix + key.ID + "_" + secretStr}, nil
+}
+
+func (s *APIKeyService) List(ctx context.Context) ([]models.APIKey, error) {
+	cursor, err := s.db.Collection("api_keys").Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"createdAt": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var keys []models.APIKey
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *APIKeyService) Get(ctx context.Context, keyID string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := s.db.Collection("api_keys").FindOne(ctx, bson.M{"_id": keyID}).Decode(&key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Revoke disables a key at once. Revoking a revoked key keeps the original
+// revocation time.
+func (s *APIKeyService) Revoke(ctx context.Context, keyID string) (*models.APIKey, error) {
+	now := time.Now()
+	_, err := s.db.Collection("api_keys").UpdateOne(ctx,
+		bson.M{"_id": keyID, "revokedAt": nil},
+		bson.M{"$set": bson.M{"revokedAt": now}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, keyID)
+}
+
+// Authenticate returns the key raw belongs to if it is valid, unrevoked
+// and unexpired. Every failure is ErrInvalidAPIKey so callers can't tell
+// which part was wrong.
+func (s *APIKeyService) Authenticate(ctx context.Context, raw string) (*models.APIKey, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(raw, apiKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(raw, apiKeyPrefix) || id == "" || secret == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.Get(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKeySecret(secret)), []byte(key.SecretHash)) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now())) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	s.touch(ctx, key.ID)
+	return key, nil
+}
+
+func (s *APIKeyService) touch(ctx context.Context, keyID string) {
+	now := time.Now()
+	_, err := s.db.Collection("api_keys").UpdateOne(ctx,
+		bson.M{"_id": keyID, "$or": bson.A{
+			bson.M{"lastUsedAt": nil},
+			bson.M{"lastUsedAt": bson.M{"$lt": now.Add(-apiKeyTouchInterval)}},
+		}},
+		bson.M{"$set": bson.M{"lastUsedAt": now}},
+	)
+	if err != nil {
+		log.Printf("Failed to record use of API key %s: %v", keyID, err)
+	}
+}
@@ -0,0 +1,411 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	maxArchiveItems = 5000
+	// Bigger archives are built by a background job rather than streamed,
+	// so a slow client can't hold a request open for hours.
+	maxStreamArchiveItems = 500
+	maxStreamArchiveSize  = 2 << 30
+	// Well under what a multipart upload of uploadPartSize parts can hold
+	maxArchiveSize   = 50 << 30
+	archiveURLExpiry = 24 * time.Hour
+	archiveJobType   = "archive"
+)
+
+var ErrArchiveTooLarge = errors.New("archive is too large")
+
+type ArchiveService struct {
+	db         *database.MongoDB
+	storage    *S3Storage
+	policy     *AccessPolicy
+	search     *SearchService
+	processing *ProcessingService
+	analytics  *AnalyticsService
+}
+
+func NewArchiveService(db *database.MongoDB, storage *S3Storage, policy *AccessPolicy, search *SearchService, processing *ProcessingService, analytics *AnalyticsService) *ArchiveService {
+	return &ArchiveService{db: db, storage: storage, policy: policy, search: search, processing: processing, analytics: analytics}
+}
+
+// ArchivePlan is the media an archive request resolved to, in archive
+// order.
+type ArchivePlan struct {
+	Filename string
+	Items    []models.Media
+	Skipped  int // items the caller may not download
+	Size     int64
+}
+
+// Streamable reports whether the archive is small enough to build while
+// the client waits.
+func (p *ArchivePlan) Streamable() bool {
+	return len(p.Items) <= maxStreamArchiveItems && p.Size <= maxStreamArchiveSize
+}
+
+// Plan resolves req to the media p may download. Hand-picked media must
+// all be downloadable; albums, tags and searches skip what isn't, so one
+// private item doesn't block the rest.
+func (s *ArchiveService) Plan(ctx context.Context, p *Principal, req *models.CreateArchiveRequest) (*ArchivePlan, error) {
+	ids, strict, err := s.sourceIDs(ctx, p, req)
+	if err != nil {
+		return nil, err
+	}
+	ids = dedupeIDs(ids)
+	if len(ids) > maxArchiveItems {
+		return nil, &InvalidParamError{Param: "media", Message: fmt.Sprintf("at most %d items can be archived at once", maxArchiveItems)}
+	}
+
+	cursor, err := s.db.Collection("media").Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var found []models.Media
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.Media, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+
+	plan := &ArchivePlan{Filename: archiveFilename(req.Filename)}
+	for _, id := range ids {
+		media, ok := byID[id]
+		if ok {
+			perm, err := s.policy.resolve(ctx, p, media, PermDownload)
+			if err != nil {
+				return nil, err
+			}
+			ok = perm >= PermDownload
+		}
+		if !ok {
+			if strict {
+				return nil, ErrForbidden
+			}
+			plan.Skipped++
+			continue
+		}
+		plan.Items = append(plan.Items, *media)
+		plan.Size += media.Size
+	}
+
+	if len(plan.Items) == 0 {
+		return nil, &InvalidParamError{Param: "media", Message: "nothing to archive"}
+	}
+	if plan.Size > maxArchiveSize {
+		return nil, ErrArchiveTooLarge
+	}
+	return plan, nil
+}
+
+// sourceIDs lists the media IDs named by req and whether every one of
+// them must be downloadable.
+func (s *ArchiveService) sourceIDs(ctx context.Context, p *Principal, req *models.CreateArchiveRequest) ([]string, bool, error) {
+	sources := 0
+	for _, set := range []bool{len(req.MediaIDs) > 0, req.AlbumID != "", req.TagID != "", req.Search != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, false, &InvalidParamError{Param: "source", Message: "give exactly one of mediaIds, albumId, tagId or search"}
+	}
+
+	switch {
+	case len(req.MediaIDs) > 0:
+		return req.MediaIDs, true, nil
+
+	case req.AlbumID != "":
+		var album models.MediaAlbum
+		if err := s.db.Collection("media_albums").FindOne(ctx, bson.M{"_id": req.AlbumID}).Decode(&album); err != nil {
+			return nil, false, err
+		}
+		if err := s.policy.RequireCollection(ctx, p, album.UserID, album.WorkspaceID, album.IsPublic); err != nil {
+			return nil, false, err
+		}
+		return album.MediaIDs, false, nil
+
+	case req.TagID != "":
+		var tag models.MediaTag
+		if err := s.db.Collection("media_tags").FindOne(ctx, bson.M{"_id": req.TagID}).Decode(&tag); err != nil {
+			return nil, false, err
+		}
+		if tag.UserID != p.UserID {
+			if err := s.policy.RequireWorkspace(ctx, p, tag.WorkspaceID); err != nil {
+				return nil, false, err
+			}
+		}
+		cursor, err := s.db.Collection("media_tag_mappings").Find(ctx,
+			bson.M{"tagId": req.TagID},
+			options.Find().SetLimit(maxArchiveItems+1),
+		)
+		if err != nil {
+			return nil, false, err
+		}
+		var mappings []models.MediaTagMapping
+		if err := cursor.All(ctx, &mappings); err != nil {
+			return nil, false, err
+		}
+		ids := make([]string, len(mappings))
+		for i, m := range mappings {
+			ids[i] = m.MediaID
+		}
+		return ids, false, nil
+
+	default:
+		ids, err := s.search.MatchingIDs(ctx, p.UserID, models.MediaSearchParams{Expr: req.Search}, maxArchiveItems+1)
+		return ids, false, err
+	}
+}
+
+func dedupeIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	out := ids[:0:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func archiveFilename(name string) string {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".zip")
+	if name == "" {
+		name = "media"
+	}
+	return sanitizeArchiveName(name) + ".zip"
+}
+
+// sanitizeArchiveName keeps entries flat and free of control characters.
+// Leading dots are dropped so no entry is hidden or names a parent
+// directory.
+func sanitizeArchiveName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r < 0x20 || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, name)
+	return strings.TrimLeft(strings.TrimSpace(name), ".")
+}
+
+// archiveNames hands out unique entry names. Names are compared
+// case-insensitively so archives extract cleanly on case-insensitive file
+// systems; later duplicates become "name (2).ext".
+type archiveNames map[string]bool
+
+func (n archiveNames) unique(filename, fallback string) string {
+	name := sanitizeArchiveName(filename)
+	if name == "" {
+		name = fallback
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := name
+	for i := 2; n[strings.ToLower(candidate)]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	n[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// Write streams the archive to w, reading each item from storage as it
+// goes so nothing is buffered beyond a single copy.
+func (s *ArchiveService) Write(ctx context.Context, w io.Writer, plan *ArchivePlan, userID string) error {
+	return s.write(ctx, w, plan, userID, nil)
+}
+
+func (s *ArchiveService) write(ctx context.Context, w io.Writer, plan *ArchivePlan, userID string, progress func(done int64)) error {
+	zw := zip.NewWriter(w)
+	names := archiveNames{}
+	var done int64
+	for i := range plan.Items {
+		media := &plan.Items[i]
+		if err := s.writeItem(ctx, zw, names, media); err != nil {
+			return fmt.Errorf("archive %s: %w", media.ID, err)
+		}
+		s.analytics.RecordAccess(ctx, media.ID, userID, AccessDownload)
+
+		done += media.Size
+		if progress != nil {
+			progress(done)
+		}
+	}
+	return zw.Close()
+}
+
+func (s *ArchiveService) writeItem(ctx context.Context, zw *zip.Writer, names archiveNames, media *models.Media) error {
+	body, err := s.storage.OpenMedia(ctx, media)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Images, video and audio are compressed already
+	method := zip.Store
+	if media.Type == "document" {
+		method = zip.Deflate
+	}
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     names.unique(media.Filename, media.ID),
+		Method:   method,
+		Modified: media.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, body)
+	return err
+}
+
+// StartJob builds the archive in the background and returns the job
+// tracking it. The job's progress is pushed like any processing job's, and
+// on completion its result holds a signed link to the archive.
+func (s *ArchiveService) StartJob(ctx context.Context, userID string, plan *ArchivePlan) (*models.ProcessingJob, error) {
+	encryption, err := s.archiveEncryption(ctx, plan)
+	if err != nil {
+		return nil, err
+	}
+	job, err := s.processing.CreateJob(ctx, "", userID, &models.CreateProcessingJobRequest{
+		Type: archiveJobType,
+		Params: map[string]interface{}{
+			"filename": plan.Filename,
+			"items":    len(plan.Items),
+			"skipped":  plan.Skipped,
+			"size":     plan.Size,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	go s.runJob(context.WithoutCancel(ctx), job.ID, userID, plan, encryption)
+	return job, nil
+}
+
+// archiveEncryption gives an archive holding encrypted media a data key of
+// its own, wrapped by the same workspace key as those media, so they are
+// no less protected at rest once zipped. Media under different keys can't
+// share an archive.
+func (s *ArchiveService) archiveEncryption(ctx context.Context, plan *ArchivePlan) (*models.MediaEncryption, error) {
+	var source *models.MediaEncryption
+	for i := range plan.Items {
+		enc := plan.Items[i].Encryption
+		if enc == nil {
+			continue
+		}
+		if source != nil && enc.KeyID != source.KeyID {
+			return nil, &InvalidParamError{Param: "media", Message: "media encrypted by different workspaces must be archived separately"}
+		}
+		source = enc
+	}
+	if source == nil {
+		return nil, nil
+	}
+	return s.storage.NewDataKey(ctx, source.KeyID, source.Mode)
+}
+
+// runJob pipes the archive straight into a multipart upload so it never
+// touches local disk. Archives are kept under archives/ for a bucket
+// lifecycle rule to expire; jobs running when the process stops stay
+// processing. Encrypted archives are recorded so the content endpoint can
+// serve them.
+func (s *ArchiveService) runJob(ctx context.Context, jobID, userID string, plan *ArchivePlan, encryption *models.MediaEncryption) {
+	s.processing.UpdateJobProgress(ctx, jobID, 0)
+
+	lastPct := 0
+	progress := func(done int64) {
+		pct := 99
+		if plan.Size > 0 && done < plan.Size {
+			pct = int(done * 100 / plan.Size)
+		}
+		if pct > lastPct {
+			lastPct = pct
+			s.processing.UpdateJobProgress(ctx, jobID, pct)
+		}
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(s.write(ctx, pw, plan, userID, progress))
+	}()
+
+	now := time.Now()
+	archive := &models.Media{
+		ID:         jobID,
+		UserID:     userID,
+		Filename:   plan.Filename,
+		MimeType:   "application/zip",
+		S3Key:      fmt.Sprintf("archives/%s/%s.zip", userID, jobID),
+		Encryption: encryption,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	size, err := s.storage.PutMedia(ctx, archive, pr)
+	// Unblocks the writer if the upload gave up first
+	pr.CloseWithError(err)
+
+	if err == nil && encryption != nil {
+		encryption.Size = size
+		_, err = s.db.Collection("media_archives").InsertOne(ctx, &models.MediaArchive{
+			ID:         jobID,
+			UserID:     userID,
+			Filename:   archive.Filename,
+			S3Key:      archive.S3Key,
+			Encryption: encryption,
+			CreatedAt:  now,
+			ExpiresAt:  now.Add(archiveURLExpiry),
+		})
+	}
+	var url string
+	if err == nil {
+		url, err = s.storage.MediaContentURL(archive, true, archiveURLExpiry)
+	}
+	if err != nil {
+		log.Printf("Archive job %s failed: %v", jobID, err)
+		s.processing.UpdateJobStatus(ctx, jobID, "failed", nil, err.Error())
+		return
+	}
+
+	s.processing.UpdateJobStatus(ctx, jobID, "completed", map[string]interface{}{
+		"url":       url,
+		"expiresAt": time.Now().Add(archiveURLExpiry),
+		"items":     len(plan.Items),
+		"skipped":   plan.Skipped,
+		"size":      size,
+	}, "")
+}
+
+// archiveContent presents an encrypted archive as media for the content
+// endpoint.
+func archiveContent(a *models.MediaArchive) *models.Media {
+	return &models.Media{
+		ID:         a.ID,
+		UserID:     a.UserID,
+		Filename:   a.Filename,
+		MimeType:   "application/zip",
+		S3Key:      a.S3Key,
+		Encryption: a.Encryption,
+		CreatedAt:  a.CreatedAt,
+		UpdatedAt:  a.CreatedAt,
+	}
+}
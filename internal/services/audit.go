@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/models"
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Audit actions written to media_activity.
+const (
+	AuditUpload         = "upload"
+	AuditView           = "view"
+	AuditDownload       = "download"
+	AuditStream         = "stream"
+	AuditRename         = "rename"
+	AuditMetadata       = "metadata_update"
+	AuditMove           = "move"
+	AuditCopy           = "copy"
+	AuditTag            = "tag"
+	AuditUntag          = "untag"
+	AuditShare          = "share"
+	AuditUnshare        = "unshare"
+	AuditShareLink      = "share_link_create"
+	AuditShareLinkOff   = "share_link_deactivate"
+	AuditTrash          = "trash"
+	AuditRestore        = "restore"
+	AuditVersionCreate  = "version_create"
+	AuditVersionDelete  = "version_delete"
+	AuditVersionRestore = "version_restore"
+	AuditDelete         = "delete"
+	AuditReassign       = "reassign"
+	AuditAlbumAdd       = "album_add"
+	AuditAlbumRemove    = "album_remove"
+)
+
+const (
+	auditQueueSize     = 4096
+	auditWorkers       = 2
+	auditBatchSize     = 100
+	auditFlushInterval = time.Second
+	auditWriteTimeout  = 10 * time.Second
+)
+
+// RequestInfo identifies who made a request and from where.
+type RequestInfo struct {
+	ActorID   string
+	IP        string
+	UserAgent string
+}
+
+type requestInfoKey struct{}
+
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+func RequestInfoFrom(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
+
+// Auditor writes activity entries to media_activity off the request path.
+// Entries are queued and appended in batches to their workspace's hash
+// chain by background workers, then published for live feeds; when the
+// queue is full new entries are dropped and logged rather than blocking.
+type Auditor struct {
+	db    *database.MongoDB
+	redis *redis.Client
+	queue chan *models.MediaActivity
+	wg    sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewAuditor(db *database.MongoDB, redis *redis.Client) *Auditor {
+	a := &Auditor{db: db, redis: redis, queue: make(chan *models.MediaActivity, auditQueueSize)}
+	for i := 0; i < auditWorkers; i++ {
+		a.wg.Add(1)
+		go a.run()
+	}
+	return a
+}
+
+// Record queues entry, filling in the ID, time, and the actor, IP and user
+// agent from ctx where the caller left them empty. A nil Auditor is a no-op.
+func (a *Auditor) Record(ctx context.Context, entry *models.MediaActivity) {
+	if a == nil {
+		return
+	}
+	info := RequestInfoFrom(ctx)
+	entry.ID = uuid.New().String()
+	if entry.UserID == "" {
+		entry.UserID = info.ActorID
+	}
+	if entry.IP == "" {
+		entry.IP = info.IP
+	}
+	if entry.UserAgent == "" {
+		entry.UserAgent = info.UserAgent
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		log.Printf("Audit log closed, dropping %s of media %s", entry.Action, entry.MediaID)
+		return
+	}
+	select {
+	case a.queue <- entry:
+	default:
+		log.Printf("Audit queue full, dropping %s of media %s", entry.Action, entry.MediaID)
+	}
+}
+
+// Close stops accepting entries and waits for queued ones to be written.
+func (a *Auditor) Close(ctx context.Context) {
+	a.mu.Lock()
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		a.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Audit log flush timed out; %d entries lost", len(a.queue))
+	}
+}
+
+func (a *Auditor) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.MediaActivity, 0, auditBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+		defer cancel()
+		a.resolveTargets(ctx, batch)
+		if err := a.writeAudit(ctx, batch); err != nil {
+			log.Printf("Failed to write audit entries: %v", err)
+		}
+		batch = make([]*models.MediaActivity, 0, auditBatchSize)
+	}
+
+	for {
+		select {
+		case entry, ok := <-a.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) == auditBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// auditTarget returns the media an entry is about: the copy the request
+// already loaded if there is one, otherwise just the ID, for the writer to
+// fill in with resolveTargets.
+func auditTarget(ctx context.Context, mediaID string) *models.Media {
+	if media, ok := MediaFrom(ctx, mediaID); ok {
+		return media
+	}
+	return &models.Media{ID: mediaID}
+}
+
+// mediaTarget is auditTarget for callers that need the workspace and owner
+// straight away, such as event and realtime publishing. If the media can't
+// be loaded only the ID is set.
+func mediaTarget(ctx context.Context, db *database.MongoDB, mediaID string) *models.Media {
+	if media, ok := MediaFrom(ctx, mediaID); ok {
+		return media
+	}
+	var media models.Media
+	err := db.Collection("media").FindOne(ctx, bson.M{"_id": mediaID},
+		options.FindOne().SetProjection(bson.M{"userId": 1, "type": 1, "metadata": 1}),
+	).Decode(&media)
+	if err != nil {
+		return &models.Media{ID: mediaID}
+	}
+	return &media
+}
+
+// resolveTargets fills in the workspace and media type of entries queued
+// with only a media ID, in one lookup per batch. Entries whose media is
+// gone keep just the ID.
+func (a *Auditor) resolveTargets(ctx context.Context, batch []*models.MediaActivity) {
+	var ids []string
+	for _, e := range batch {
+		if e.MediaID != "" && e.WorkspaceID == "" && e.MediaType == "" {
+			ids = append(ids, e.MediaID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	cursor, err := a.db.Collection("media").Find(ctx, bson.M{"_id": bson.M{"$in": ids}},
+		options.Find().SetProjection(bson.M{"type": 1, "metadata": 1}),
+	)
+	if err != nil {
+		log.Printf("Failed to resolve audit targets: %v", err)
+		return
+	}
+	var found []models.Media
+	if err := cursor.All(ctx, &found); err != nil {
+		log.Printf("Failed to resolve audit targets: %v", err)
+		return
+	}
+	byID := make(map[string]*models.Media, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+	for _, e := range batch {
+		if media, ok := byID[e.MediaID]; ok && e.WorkspaceID == "" && e.MediaType == "" {
+			e.WorkspaceID = media.Metadata["workspaceId"]
+			e.MediaType = media.Type
+		}
+	}
+}
+
+// mediaActivity starts an entry describing an action on media.
+func mediaActivity(media *models.Media, action string) *models.MediaActivity {
+	return &models.MediaActivity{
+		MediaID:     media.ID,
+		WorkspaceID: media.Metadata["workspaceId"],
+		MediaType:   media.Type,
+		Action:      action,
+	}
+}
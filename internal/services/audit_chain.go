@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/quckapp/media-service/internal/auditchain"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Appends race with other workers and instances on the unique
+// (workspaceId, seq) index; give up after this many lost races.
+const auditChainRetries = 10
+
+// writeAudit groups a batch by workspace, keeping its order, and appends
+// each group to that workspace's chain.
+func (a *Auditor) writeAudit(ctx context.Context, batch []*models.MediaActivity) error {
+	var order []string
+	groups := map[string][]*models.MediaActivity{}
+	for _, e := range batch {
+		if _, ok := groups[e.WorkspaceID]; !ok {
+			order = append(order, e.WorkspaceID)
+		}
+		groups[e.WorkspaceID] = append(groups[e.WorkspaceID], e)
+	}
+
+	var errs []error
+	for _, ws := range order {
+		if err := a.appendChain(ctx, ws, groups[ws]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		a.publish(ctx, ws, groups[ws])
+	}
+	return errors.Join(errs...)
+}
+
+// publish fans written entries out to live feed subscribers. Delivery is
+// best effort; subscribers that miss some catch up from the log.
+func (a *Auditor) publish(ctx context.Context, workspaceID string, entries []*models.MediaActivity) {
+	if a.redis == nil {
+		return
+	}
+	pipe := a.redis.Pipeline()
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		pipe.Publish(ctx, activityChannel(workspaceID), data)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to publish activity for workspace %q: %v", workspaceID, err)
+	}
+}
+
+// appendChain inserts entries after the current head. The insert is ordered,
+// so when another writer takes a seq first everything before the conflict
+// is already stored and only the rest is re-chained onto the new head.
+func (a *Auditor) appendChain(ctx context.Context, workspaceID string, entries []*models.MediaActivity) error {
+	coll := a.db.Collection("media_activity")
+	for attempt := 0; attempt < auditChainRetries; attempt++ {
+		seq, prev, err := auditchain.Head(ctx, coll, workspaceID)
+		if err != nil {
+			return err
+		}
+		auditchain.Link(entries, seq, prev)
+
+		docs := make([]interface{}, len(entries))
+		for i, e := range entries {
+			docs[i] = e
+		}
+		_, err = coll.InsertMany(ctx, docs)
+		if err == nil {
+			return nil
+		}
+
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 || !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+		entries = entries[bulkErr.WriteErrors[0].Index:]
+	}
+	return fmt.Errorf("audit chain for workspace %q: %d entries not written after %d attempts", workspaceID, len(entries), auditChainRetries)
+}
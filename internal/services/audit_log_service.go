@@ -0,0 +1,329 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/quckapp/media-service/internal/auditchain"
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	auditBundleFile   = "activity.ndjson"
+	auditManifestFile = "manifest.json"
+	auditSigFile      = "manifest.sig"
+
+	// Verification reports stop listing breaks after this many
+	maxAuditBreaks = 100
+)
+
+var ErrAuditSigningDisabled = errors.New("audit export signing key is not configured")
+
+type AuditLogService struct {
+	db  *database.MongoDB
+	key ed25519.PrivateKey
+}
+
+// NewAuditLogService takes a base64 Ed25519 key, either the 32-byte seed or
+// the 64-byte private key. Without a key, verification still works but
+// exports are refused.
+func NewAuditLogService(db *database.MongoDB, signingKey string) (*AuditLogService, error) {
+	s := &AuditLogService{db: db}
+	if signingKey == "" {
+		return s, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(signingKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode audit signing key: %w", err)
+	}
+	switch len(raw) {
+	case ed25519.SeedSize:
+		s.key = ed25519.NewKeyFromSeed(raw)
+	case ed25519.PrivateKeySize:
+		s.key = ed25519.PrivateKey(raw)
+	default:
+		return nil, fmt.Errorf("audit signing key must be %d or %d bytes, got %d", ed25519.SeedSize, ed25519.PrivateKeySize, len(raw))
+	}
+	return s, nil
+}
+
+// PublicKey returns the base64 key that verifies export signatures, or ""
+// when signing is disabled.
+func (s *AuditLogService) PublicKey() string {
+	if s.key == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// AuditRange is a contiguous span of a workspace's chain. Dates select the
+// first and last entries created inside them; because entries are chained
+// in write order, a few neighbours just outside the dates may be included.
+type AuditRange struct {
+	WorkspaceID string
+	From, To    *time.Time
+	FromSeq     int64
+	ToSeq       int64
+}
+
+// ResolveAuditRange maps optional from/to bounds (YYYY-MM-DD or RFC 3339,
+// to exclusive for timestamps and inclusive for dates) onto chain positions.
+// An empty range has ToSeq < FromSeq.
+func (s *AuditLogService) ResolveAuditRange(ctx context.Context, workspaceID, from, to string) (*AuditRange, error) {
+	rng := &AuditRange{WorkspaceID: workspaceID}
+	if from != "" {
+		t, err := parseRangeBound(from, time.UTC, false)
+		if err != nil {
+			return nil, &InvalidParamError{Param: "from", Message: err.Error()}
+		}
+		rng.From = &t
+	}
+	if to != "" {
+		t, err := parseRangeBound(to, time.UTC, true)
+		if err != nil {
+			return nil, &InvalidParamError{Param: "to", Message: err.Error()}
+		}
+		rng.To = &t
+	}
+	if rng.From != nil && rng.To != nil && !rng.From.Before(*rng.To) {
+		return nil, &InvalidParamError{Param: "from", Message: "must be before to"}
+	}
+
+	coll := s.db.Collection("media_activity")
+	chainSeq := func(createdAt bson.M, dir int) (int64, error) {
+		filter := bson.M{"workspaceId": workspaceID, "seq": bson.M{"$exists": true}}
+		if len(createdAt) > 0 {
+			filter["createdAt"] = createdAt
+		}
+		var e models.MediaActivity
+		err := coll.FindOne(ctx, filter,
+			options.FindOne().SetSort(bson.M{"seq": dir}).SetProjection(bson.M{"seq": 1}),
+		).Decode(&e)
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return e.Seq, err
+	}
+
+	window := bson.M{}
+	if rng.From != nil {
+		window["$gte"] = *rng.From
+	}
+	if rng.To != nil {
+		window["$lt"] = *rng.To
+	}
+	first, err := chainSeq(window, 1)
+	if err != nil {
+		return nil, err
+	}
+	last, err := chainSeq(window, -1)
+	if err != nil {
+		return nil, err
+	}
+	if first == 0 {
+		rng.FromSeq, rng.ToSeq = 1, 0
+		return rng, nil
+	}
+	rng.FromSeq, rng.ToSeq = first, last
+	return rng, nil
+}
+
+// chainWalker checks entries in seq order: each must follow the previous
+// seq, point at the previous hash, and hash to its stored value.
+type chainWalker struct {
+	result *models.AuditVerification
+	next   int64
+	prev   string
+}
+
+// startChainWalk anchors the walk on the entry before rng.FromSeq so the
+// first entry in range is linked too.
+func (s *AuditLogService) startChainWalk(ctx context.Context, rng *AuditRange) (*chainWalker, error) {
+	w := &chainWalker{
+		result: &models.AuditVerification{
+			WorkspaceID: rng.WorkspaceID,
+			FromSeq:     rng.FromSeq,
+			ToSeq:       rng.ToSeq,
+			Valid:       true,
+			Breaks:      []models.AuditChainBreak{},
+		},
+		next: rng.FromSeq,
+	}
+	if rng.FromSeq > 1 && rng.ToSeq >= rng.FromSeq {
+		var anchor models.MediaActivity
+		err := s.db.Collection("media_activity").FindOne(ctx,
+			bson.M{"workspaceId": rng.WorkspaceID, "seq": rng.FromSeq - 1},
+		).Decode(&anchor)
+		switch {
+		case err == mongo.ErrNoDocuments:
+			w.fail(rng.FromSeq-1, "", "entry is missing")
+		case err != nil:
+			return nil, err
+		default:
+			w.prev = anchor.Hash
+			if auditchain.Hash(&anchor) != anchor.Hash {
+				w.fail(anchor.Seq, anchor.ID, "hash does not match contents")
+			}
+		}
+	}
+	return w, nil
+}
+
+func (w *chainWalker) fail(seq int64, id, reason string) {
+	if len(w.result.Breaks) < maxAuditBreaks {
+		w.result.Breaks = append(w.result.Breaks, models.AuditChainBreak{Seq: seq, EntryID: id, Reason: reason})
+	}
+	w.result.Valid = false
+}
+
+func (w *chainWalker) check(e *models.MediaActivity) {
+	if e.Seq != w.next {
+		w.fail(w.next, "", fmt.Sprintf("entries %d to %d are missing", w.next, e.Seq-1))
+	} else if e.PrevHash != w.prev {
+		w.fail(e.Seq, e.ID, "prevHash does not match the previous entry")
+	}
+	if auditchain.Hash(e) != e.Hash {
+		w.fail(e.Seq, e.ID, "hash does not match contents")
+	}
+	w.prev = e.Hash
+	w.next = e.Seq + 1
+	w.result.Entries++
+	w.result.HeadHash = e.Hash
+}
+
+func (w *chainWalker) finish(rng *AuditRange) *models.AuditVerification {
+	if rng.ToSeq >= rng.FromSeq && w.next <= rng.ToSeq {
+		w.fail(w.next, "", fmt.Sprintf("entries %d to %d are missing", w.next, rng.ToSeq))
+	}
+	return w.result
+}
+
+func (s *AuditLogService) chainCursor(ctx context.Context, rng *AuditRange) (*mongo.Cursor, error) {
+	return s.db.Collection("media_activity").Find(ctx,
+		bson.M{"workspaceId": rng.WorkspaceID, "seq": bson.M{"$gte": rng.FromSeq, "$lte": rng.ToSeq}},
+		options.Find().SetSort(bson.M{"seq": 1}),
+	)
+}
+
+// Verify walks the chain over rng and reports every break it finds. It also
+// counts entries in the workspace that were never chained, which only
+// happens if something wrote to media_activity directly.
+func (s *AuditLogService) Verify(ctx context.Context, rng *AuditRange) (*models.AuditVerification, error) {
+	w, err := s.startChainWalk(ctx, rng)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.chainCursor(ctx, rng)
+	if err != nil {
+		return nil, err
+	}
+	err = streamCursor(ctx, cursor, func(e models.MediaActivity) error {
+		w.check(&e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := w.finish(rng)
+
+	result.Unchained, err = s.db.Collection("media_activity").CountDocuments(ctx,
+		bson.M{"workspaceId": rng.WorkspaceID, "seq": bson.M{"$exists": false}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.Unchained > 0 {
+		result.Valid = false
+	}
+	return result, nil
+}
+
+// ExportBundle writes a zip holding the range as NDJSON, a manifest with
+// the file digest and chain endpoints, and a detached Ed25519 signature of
+// the manifest. The chain is verified while it is written and the result
+// recorded in the manifest.
+func (s *AuditLogService) ExportBundle(ctx context.Context, rng *AuditRange, out io.Writer) error {
+	if s.key == nil {
+		return ErrAuditSigningDisabled
+	}
+	w, err := s.startChainWalk(ctx, rng)
+	if err != nil {
+		return err
+	}
+	cursor, err := s.chainCursor(ctx, rng)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(out)
+	file, err := zw.Create(auditBundleFile)
+	if err != nil {
+		cursor.Close(ctx)
+		return err
+	}
+	digest := sha256.New()
+	enc := json.NewEncoder(io.MultiWriter(file, digest))
+	prevHash := w.prev
+	err = streamCursor(ctx, cursor, func(e models.MediaActivity) error {
+		w.check(&e)
+		return enc.Encode(&e)
+	})
+	if err != nil {
+		return err
+	}
+	result := w.finish(rng)
+
+	manifest := models.AuditManifest{
+		WorkspaceID:        rng.WorkspaceID,
+		From:               rng.From,
+		To:                 rng.To,
+		FromSeq:            rng.FromSeq,
+		ToSeq:              rng.ToSeq,
+		Entries:            result.Entries,
+		PrevHash:           prevHash,
+		HeadHash:           result.HeadHash,
+		ChainValid:         result.Valid,
+		Breaks:             result.Breaks,
+		File:               auditBundleFile,
+		FileSHA256:         hex.EncodeToString(digest.Sum(nil)),
+		HashAlgorithm:      "sha256",
+		SignatureAlgorithm: "ed25519",
+		PublicKey:          s.PublicKey(),
+		GeneratedAt:        time.Now().UTC(),
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeZipFile(zw, auditManifestFile, data); err != nil {
+		return err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, data))
+	if err := writeZipFile(zw, auditSigFile, []byte(sig+"\n")); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeZipFile(zw *zip.Writer, name string, data []byte) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
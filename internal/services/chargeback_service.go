@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const bytesPerGB = 1 << 30
+
+// defaultChargebackPricing is used when CHARGEBACK_PRICING is unset.
+var defaultChargebackPricing = models.ChargebackPricing{
+	Currency: "USD",
+	Classes: map[string][]models.PriceTier{
+		"standard": {
+			{UpToGBMonths: 51200, PricePerGBMonth: 0.023},
+			{UpToGBMonths: 512000, PricePerGBMonth: 0.022},
+			{PricePerGBMonth: 0.021},
+		},
+		"infrequent": {{PricePerGBMonth: 0.0125}},
+		"archive":    {{PricePerGBMonth: 0.004}},
+	},
+}
+
+type ChargebackService struct {
+	db      *database.MongoDB
+	pricing models.ChargebackPricing
+}
+
+// NewChargebackService parses pricingJSON (a models.ChargebackPricing
+// document); an empty string selects the default price list.
+func NewChargebackService(db *database.MongoDB, pricingJSON string) (*ChargebackService, error) {
+	pricing := defaultChargebackPricing
+	if pricingJSON != "" {
+		pricing = models.ChargebackPricing{}
+		if err := json.Unmarshal([]byte(pricingJSON), &pricing); err != nil {
+			return nil, fmt.Errorf("parse chargeback pricing: %w", err)
+		}
+	}
+	if err := validatePricing(pricing); err != nil {
+		return nil, err
+	}
+	return &ChargebackService{db: db, pricing: pricing}, nil
+}
+
+func validatePricing(pricing models.ChargebackPricing) error {
+	if pricing.Currency == "" {
+		return fmt.Errorf("chargeback pricing: currency is required")
+	}
+	if _, ok := pricing.Classes[defaultStorageClass]; !ok {
+		return fmt.Errorf("chargeback pricing: %q class is required", defaultStorageClass)
+	}
+	for class, tiers := range pricing.Classes {
+		if len(tiers) == 0 {
+			return fmt.Errorf("chargeback pricing: class %q has no tiers", class)
+		}
+		prev := 0.0
+		for i, tier := range tiers {
+			last := i == len(tiers)-1
+			if tier.PricePerGBMonth < 0 {
+				return fmt.Errorf("chargeback pricing: class %q tier %d has a negative price", class, i)
+			}
+			if last != (tier.UpToGBMonths == 0) {
+				return fmt.Errorf("chargeback pricing: class %q must end with exactly one unbounded tier", class)
+			}
+			if !last && tier.UpToGBMonths <= prev {
+				return fmt.Errorf("chargeback pricing: class %q tier limits must increase", class)
+			}
+			prev = tier.UpToGBMonths
+		}
+	}
+	return nil
+}
+
+func (s *ChargebackService) Pricing() models.ChargebackPricing {
+	return s.pricing
+}
+
+// price applies graduated tiers: each tier's rate covers only the usage
+// that falls inside it.
+func (s *ChargebackService) price(class string, gbMonths float64) float64 {
+	tiers, ok := s.pricing.Classes[class]
+	if !ok {
+		tiers = s.pricing.Classes[defaultStorageClass]
+	}
+	cost, floor := 0.0, 0.0
+	for _, tier := range tiers {
+		if gbMonths <= floor {
+			break
+		}
+		upper := gbMonths
+		if tier.UpToGBMonths > 0 && tier.UpToGBMonths < upper {
+			upper = tier.UpToGBMonths
+		}
+		cost += (upper - floor) * tier.PricePerGBMonth
+		floor = upper
+	}
+	return cost
+}
+
+// GetInvoice computes month's GB-months for the workspace by integrating the
+// storage_events ledger: each event contributes delta × (time remaining in
+// the period), and usage carried in from earlier months covers the whole
+// period. A month that has not ended is billed up to now.
+func (s *ChargebackService) GetInvoice(ctx context.Context, workspaceID, month string) (*models.ChargebackInvoice, error) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if month != "" {
+		t, err := time.Parse("2006-01", month)
+		if err != nil {
+			return nil, &InvalidParamError{Param: "month", Message: "expected YYYY-MM"}
+		}
+		start = t
+	}
+	if start.After(now) {
+		return nil, &InvalidParamError{Param: "month", Message: "must not be in the future"}
+	}
+	periodEnd := start.AddDate(0, 1, 0)
+	end := periodEnd
+	if now.Before(end) {
+		end = now
+	}
+
+	cursor, err := s.db.Collection("storage_events").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"workspaceId": workspaceID, "at": bson.M{"$lt": end}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"userId": "$userId", "storageClass": "$storageClass"},
+			"byteMs": bson.M{"$sum": bson.M{"$multiply": bson.A{
+				bson.M{"$toDouble": "$delta"},
+				bson.M{"$subtract": bson.A{end, bson.M{"$max": bson.A{"$at", start}}}},
+			}}},
+			"endBytes": bson.M{"$sum": "$delta"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Key struct {
+			UserID       string `bson:"userId"`
+			StorageClass string `bson:"storageClass"`
+		} `bson:"_id"`
+		ByteMs   float64 `bson:"byteMs"`
+		EndBytes int64   `bson:"endBytes"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	// A GB-month is one GB stored for the whole calendar month
+	monthMs := float64(periodEnd.Sub(start).Milliseconds())
+	invoice := &models.ChargebackInvoice{
+		WorkspaceID: workspaceID,
+		Month:       start.Format("2006-01"),
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Partial:     end.Before(periodEnd),
+		Currency:    s.pricing.Currency,
+		Lines:       []models.ChargebackLine{},
+		Users:       []models.ChargebackUserLine{},
+	}
+
+	lines := map[string]*models.ChargebackLine{}
+	for _, r := range rows {
+		gbMonths := r.ByteMs / bytesPerGB / monthMs
+		if gbMonths <= 0 && r.EndBytes == 0 {
+			continue
+		}
+		class := r.Key.StorageClass
+		line, ok := lines[class]
+		if !ok {
+			line = &models.ChargebackLine{StorageClass: class}
+			lines[class] = line
+		}
+		line.GBMonths += gbMonths
+		line.EndBytes += r.EndBytes
+		invoice.Users = append(invoice.Users, models.ChargebackUserLine{
+			UserID:       r.Key.UserID,
+			StorageClass: class,
+			GBMonths:     gbMonths,
+			EndBytes:     r.EndBytes,
+		})
+	}
+
+	for class, line := range lines {
+		line.Cost = roundCents(s.price(class, line.GBMonths))
+		invoice.Lines = append(invoice.Lines, *line)
+		invoice.TotalGBMonths += line.GBMonths
+		invoice.TotalCost += line.Cost
+	}
+	// Tiers apply to the workspace total, so users share each class's cost
+	// in proportion to their usage.
+	for i := range invoice.Users {
+		u := &invoice.Users[i]
+		if line := lines[u.StorageClass]; line.GBMonths > 0 {
+			u.Cost = roundCents(line.Cost * u.GBMonths / line.GBMonths)
+		}
+	}
+	invoice.TotalCost = roundCents(invoice.TotalCost)
+
+	sort.Slice(invoice.Lines, func(i, j int) bool { return invoice.Lines[i].StorageClass < invoice.Lines[j].StorageClass })
+	sort.Slice(invoice.Users, func(i, j int) bool {
+		if invoice.Users[i].Cost != invoice.Users[j].Cost {
+			return invoice.Users[i].Cost > invoice.Users[j].Cost
+		}
+		return invoice.Users[i].UserID < invoice.Users[j].UserID
+	})
+	return invoice, nil
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/events"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Cleanup policies for media left behind by deleted channels, workspaces
+// and users.
+const (
+	CleanupTrash    = "trash"
+	CleanupDelete   = "delete"
+	CleanupReassign = "reassign"
+)
+
+// Actor recorded in the audit log for cleanup changes.
+const cleanupActor = "system:cleanup"
+
+type CleanupPolicies struct {
+	Channel   string
+	Workspace string
+	User      string
+	// Default owner for the reassign policy; user.deleted events may name
+	// their own.
+	ReassignTo string
+}
+
+// CleanupService removes or re-homes media when the channel, workspace or
+// user it belongs to is deleted in another service.
+type CleanupService struct {
+	db       *database.MongoDB
+	media    *MediaService
+	trash    *TrashService
+	policies CleanupPolicies
+}
+
+func NewCleanupService(db *database.MongoDB, media *MediaService, trash *TrashService, policies CleanupPolicies) (*CleanupService, error) {
+	for name, policy := range map[string]string{"channel": policies.Channel, "workspace": policies.Workspace, "user": policies.User} {
+		switch policy {
+		case CleanupTrash, CleanupDelete:
+		case CleanupReassign:
+			if name != "user" && policies.ReassignTo == "" {
+				return nil, fmt.Errorf("cleanup: %s policy reassign needs a default owner", name)
+			}
+		default:
+			return nil, fmt.Errorf("cleanup: unknown %s policy %q", name, policy)
+		}
+	}
+	return &CleanupService{db: db, media: media, trash: trash, policies: policies}, nil
+}
+
+// HandleEvent is an events.Handler. Each policy only touches media that
+// still match the deleted entity, so re-running an event is harmless.
+func (s *CleanupService) HandleEvent(ctx context.Context, event *events.Event) error {
+	ctx = WithRequestInfo(ctx, RequestInfo{ActorID: cleanupActor})
+	switch event.Type {
+	case events.ChannelDeleted:
+		var data events.ChannelDeletedData
+		if err := decodeEventData(event, &data); err != nil {
+			return err
+		}
+		if data.ChannelID == "" {
+			return events.Permanent(fmt.Errorf("channel.deleted without channelId"))
+		}
+		return s.apply(ctx, bson.M{"metadata.channelId": data.ChannelID}, s.policies.Channel, s.policies.ReassignTo)
+
+	case events.WorkspaceDeleted:
+		var data events.WorkspaceDeletedData
+		if err := decodeEventData(event, &data); err != nil {
+			return err
+		}
+		if data.WorkspaceID == "" {
+			return events.Permanent(fmt.Errorf("workspace.deleted without workspaceId"))
+		}
+		return s.apply(ctx, workspaceMatch(data.WorkspaceID), s.policies.Workspace, s.policies.ReassignTo)
+
+	case events.UserDeleted:
+		var data events.UserDeletedData
+		if err := decodeEventData(event, &data); err != nil {
+			return err
+		}
+		if data.UserID == "" {
+			return events.Permanent(fmt.Errorf("user.deleted without userId"))
+		}
+		reassignTo := data.ReassignTo
+		if reassignTo == "" {
+			reassignTo = s.policies.ReassignTo
+		}
+		if s.policies.User == CleanupReassign && (reassignTo == "" || reassignTo == data.UserID) {
+			return events.Permanent(fmt.Errorf("user.deleted for %s: no owner to reassign media to", data.UserID))
+		}
+		return s.apply(ctx, bson.M{"userId": data.UserID}, s.policies.User, reassignTo)
+	}
+	return nil
+}
+
+func decodeEventData(event *events.Event, v interface{}) error {
+	if err := json.Unmarshal(event.Data, v); err != nil {
+		return events.Permanent(fmt.Errorf("decode %s data: %w", event.Type, err))
+	}
+	return nil
+}
+
+// apply runs policy over every media item matching filter. Items that fail
+// are reported together so the event is retried; the ones already handled
+// no longer match.
+func (s *CleanupService) apply(ctx context.Context, filter bson.M, policy, reassignTo string) error {
+	if _, byUser := filter["userId"]; policy == CleanupReassign && !byUser {
+		filter["userId"] = bson.M{"$ne": reassignTo}
+	}
+	cursor, err := s.db.Collection("media").Find(ctx, filter,
+		options.Find().SetProjection(bson.M{"_id": 1, "userId": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	var targets []models.Media
+	if err := cursor.All(ctx, &targets); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, m := range targets {
+		var err error
+		switch policy {
+		case CleanupTrash:
+			err = s.trash.MoveToTrash(ctx, m.ID, m.UserID)
+		case CleanupDelete:
+			err = s.media.Delete(ctx, m.ID, m.UserID)
+		case CleanupReassign:
+			err = s.media.ReassignOwner(ctx, m.ID, m.UserID, reassignTo)
+		}
+		// Gone already, e.g. deleted by a concurrent request
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			errs = append(errs, fmt.Errorf("%s media %s: %w", policy, m.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
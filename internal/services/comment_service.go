@@ -8,16 +8,18 @@ import (
 	"github.com/google/uuid"
 	"github.com/quckapp/media-service/internal/database"
 	"github.com/quckapp/media-service/internal/models"
+	"github.com/quckapp/media-service/internal/realtime"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type CommentService struct {
-	db *database.MongoDB
+	db       *database.MongoDB
+	realtime *realtime.Hub
 }
 
-func NewCommentService(db *database.MongoDB) *CommentService {
-	return &CommentService{db: db}
+func NewCommentService(db *database.MongoDB, hub *realtime.Hub) *CommentService {
+	return &CommentService{db: db, realtime: hub}
 }
 
 func (s *CommentService) Create(ctx context.Context, mediaID, userID string, req *models.CreateCommentRequest) (*models.MediaComment, error) {
@@ -35,6 +37,7 @@ func (s *CommentService) Create(ctx context.Context, mediaID, userID string, req
 	if err != nil {
 		return nil, err
 	}
+	s.realtime.Publish(ctx, realtime.CommentCreated, realtimeScope(mediaTarget(ctx, s.db, mediaID)), comment)
 	return comment, nil
 }
 
@@ -55,9 +58,9 @@ func (s *CommentService) GetByMedia(ctx context.Context, mediaID string, limit i
 	return comments, nil
 }
 
-func (s *CommentService) GetReplies(ctx context.Context, parentID string) ([]models.MediaComment, error) {
+func (s *CommentService) GetReplies(ctx context.Context, mediaID, parentID string) ([]models.MediaComment, error) {
 	cursor, err := s.db.Collection("media_comments").Find(ctx,
-		bson.M{"parentId": parentID},
+		bson.M{"mediaId": mediaID, "parentId": parentID},
 		options.Find().SetSort(bson.M{"createdAt": 1}),
 	)
 	if err != nil {
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/events"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// publishMediaCreated and publishMediaDeleted enqueue their event; call them
+// inside the transaction making the change.
+func publishMediaCreated(ctx context.Context, p *events.Publisher, media *models.Media) error {
+	return p.Enqueue(ctx, events.MediaCreated, media.Metadata["workspaceId"], media.ID, events.MediaCreatedData{
+		MediaID:  media.ID,
+		UserID:   media.UserID,
+		Filename: media.Filename,
+		MimeType: media.MimeType,
+		Type:     media.Type,
+		Size:     media.Size,
+	})
+}
+
+func publishMediaDeleted(ctx context.Context, p *events.Publisher, media *models.Media) error {
+	return p.Enqueue(ctx, events.MediaDeleted, media.Metadata["workspaceId"], media.ID, events.MediaDeletedData{
+		MediaID: media.ID,
+		UserID:  media.UserID,
+		Size:    media.Size,
+	})
+}
+
+// checkWorkspaceQuota publishes quota.exceeded when adding media to a
+// workspace takes it over its storage or file limit. Only the change that
+// crosses a limit publishes, not every addition made while already over.
+func checkWorkspaceQuota(ctx context.Context, db *database.MongoDB, p *events.Publisher, workspaceID string, media *models.Media) {
+	if p == nil || workspaceID == "" {
+		return
+	}
+	var quota models.StorageQuota
+	if err := db.Collection("storage_quotas").FindOne(ctx, bson.M{"workspaceId": workspaceID}).Decode(&quota); err != nil {
+		return
+	}
+
+	cursor, err := db.Collection("media").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: workspaceMatch(workspaceID)}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "size": bson.M{"$sum": "$size"}, "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return
+	}
+	var usage []struct {
+		Size  int64 `bson:"size"`
+		Count int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &usage); err != nil || len(usage) == 0 {
+		return
+	}
+	used, count := usage[0].Size, usage[0].Count
+	maxBytes := quota.MaxStorageMB << 20
+
+	limit := ""
+	switch {
+	case quota.MaxStorageMB > 0 && used > maxBytes && used-media.Size <= maxBytes:
+		limit = "storage"
+	case quota.MaxFileCount > 0 && count > quota.MaxFileCount && count-1 <= quota.MaxFileCount:
+		limit = "files"
+	default:
+		return
+	}
+	p.Publish(ctx, events.QuotaExceeded, workspaceID, workspaceID, events.QuotaExceededData{
+		WorkspaceID:    workspaceID,
+		Limit:          limit,
+		MaxStorageMB:   quota.MaxStorageMB,
+		UsedStorageMB:  used >> 20,
+		MaxFileCount:   quota.MaxFileCount,
+		FileCount:      count,
+		TriggerMediaID: media.ID,
+	})
+}
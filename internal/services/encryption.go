@@ -0,0 +1,535 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/quckapp/media-service/internal/kms"
+	"github.com/quckapp/media-service/internal/models"
+)
+
+// Encryption modes. With aes-gcm the service encrypts objects itself; with
+// sse-c S3 does, using the data key the service sends with each request.
+const (
+	EncryptionAESGCM = "aes-gcm"
+	EncryptionSSEC   = "sse-c"
+)
+
+var (
+	ErrEncryptionDisabled = errors.New("encryption at rest is not configured")
+	ErrContentURL         = errors.New("invalid or expired content URL")
+	ErrPlaintextMove      = errors.New("unencrypted media can't be moved or copied into an encrypted workspace")
+	errCorruptObject      = errors.New("encrypted object is corrupt or truncated")
+)
+
+// aes-gcm objects are a header (magic and a random nonce prefix) followed
+// by the plaintext in segments sealed separately, so they can be streamed
+// both ways and read from any segment. A segment's nonce is the prefix,
+// its index and a flag marking the last one, so segments can't be
+// reordered, dropped or cut off unnoticed.
+const (
+	gcmMagic       = "QKE1"
+	gcmPrefixSize  = 7
+	gcmHeaderSize  = len(gcmMagic) + gcmPrefixSize
+	gcmSegmentSize = 64 << 10
+	gcmTagSize     = 16
+	dataKeySize    = 32
+)
+
+// Encrypted media can't be served by presigned S3 URLs, so the service
+// serves them itself at this path, with URLs it signs the same way
+const contentPath = "/api/v1/media/content/"
+
+// EnableEncryption lets workspaces store media encrypted under keys held
+// in k. Content URLs for encrypted media point at baseURL and are signed
+// with secret, which every replica must share.
+func (s *S3Storage) EnableEncryption(k kms.KMS, baseURL string, secret []byte) {
+	s.kms = k
+	s.contentBase = strings.TrimSuffix(baseURL, "/")
+	s.contentSecret = secret
+}
+
+func (s *S3Storage) EncryptionEnabled() bool {
+	return s.kms != nil
+}
+
+func workspaceKeyID(workspaceID string) string {
+	return "workspace/" + workspaceID
+}
+
+// NewDataKey makes a data key for one object, wrapped by keyID.
+func (s *S3Storage) NewDataKey(ctx context.Context, keyID, mode string) (*models.MediaEncryption, error) {
+	if s.kms == nil {
+		return nil, ErrEncryptionDisabled
+	}
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	version, wrapped, err := s.kms.Wrap(ctx, keyID, key)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MediaEncryption{Mode: mode, KeyID: keyID, KeyVersion: version, WrappedKey: wrapped}, nil
+}
+
+// RotateKey makes a new version of keyID current.
+func (s *S3Storage) RotateKey(ctx context.Context, keyID string) (int, error) {
+	if s.kms == nil {
+		return 0, ErrEncryptionDisabled
+	}
+	return s.kms.Rotate(ctx, keyID)
+}
+
+// RewrapKey wraps enc's data key again under the current version of its
+// KMS key. The object itself is untouched.
+func (s *S3Storage) RewrapKey(ctx context.Context, enc *models.MediaEncryption) (*models.MediaEncryption, error) {
+	return s.RewrapKeyTo(ctx, enc, enc.KeyID)
+}
+
+// RewrapKeyTo wraps enc's data key under the current version of keyID,
+// for objects moving to another workspace.
+func (s *S3Storage) RewrapKeyTo(ctx context.Context, enc *models.MediaEncryption, keyID string) (*models.MediaEncryption, error) {
+	key, err := s.dataKey(ctx, enc)
+	if err != nil {
+		return nil, err
+	}
+	version, wrapped, err := s.kms.Wrap(ctx, keyID, key)
+	if err != nil {
+		return nil, err
+	}
+	rewrapped := *enc
+	rewrapped.KeyID = keyID
+	rewrapped.KeyVersion = version
+	rewrapped.WrappedKey = wrapped
+	return &rewrapped, nil
+}
+
+func (s *S3Storage) dataKey(ctx context.Context, enc *models.MediaEncryption) ([]byte, error) {
+	if s.kms == nil {
+		return nil, ErrEncryptionDisabled
+	}
+	return s.kms.Unwrap(ctx, enc.KeyID, enc.KeyVersion, enc.WrappedKey)
+}
+
+// MediaURL is a URL to fetch m for expiry: a presigned S3 URL, or a signed
+// content URL for encrypted media.
+func (s *S3Storage) MediaURL(m *models.Media, expiry time.Duration) (string, error) {
+	if m.Encryption != nil {
+		return s.contentURL(http.MethodGet, m.ID, "", expiry)
+	}
+	return s.GetPresignedDownloadURL(m.S3Key, expiry)
+}
+
+// MediaContentURL is like MediaURL but serves m inline or as an attachment.
+func (s *S3Storage) MediaContentURL(m *models.Media, attachment bool, expiry time.Duration) (string, error) {
+	if m.Encryption != nil {
+		disposition := "inline"
+		if attachment {
+			disposition = "attachment"
+		}
+		return s.contentURL(http.MethodGet, m.ID, disposition, expiry)
+	}
+	return s.GetPresignedContentURL(m.S3Key, m.Filename, attachment, expiry)
+}
+
+// MediaUploadURL is where the client PUTs m's content: S3, or the service
+// for encrypted media.
+func (s *S3Storage) MediaUploadURL(m *models.Media, expiry time.Duration) (string, error) {
+	if m.Encryption != nil {
+		return s.contentURL(http.MethodPut, m.ID, "", expiry)
+	}
+	return s.GetPresignedUploadURL(m.S3Key, m.MimeType, expiry)
+}
+
+func (s *S3Storage) contentURL(method, mediaID, disposition string, expiry time.Duration) (string, error) {
+	if s.contentSecret == nil {
+		return "", ErrEncryptionDisabled
+	}
+	exp := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	q := url.Values{"exp": {exp}}
+	if disposition != "" {
+		q.Set("disposition", disposition)
+	}
+	q.Set("sig", s.contentSignature(method, mediaID, exp, disposition))
+	return s.contentBase + contentPath + url.PathEscape(mediaID) + "?" + q.Encode(), nil
+}
+
+func (s *S3Storage) contentSignature(method, mediaID, exp, disposition string) string {
+	mac := hmac.New(sha256.New, s.contentSecret)
+	mac.Write([]byte(method + "\n" + mediaID + "\n" + exp + "\n" + disposition))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyContentURL checks the signature and expiry of a content URL used
+// with method.
+func (s *S3Storage) VerifyContentURL(method, mediaID string, query url.Values) error {
+	if s.contentSecret == nil {
+		return ErrContentURL
+	}
+	exp := query.Get("exp")
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrContentURL
+	}
+	want := s.contentSignature(method, mediaID, exp, query.Get("disposition"))
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(want)) {
+		return ErrContentURL
+	}
+	return nil
+}
+
+// PutMedia uploads m's content, encrypting it if m is encrypted, and
+// returns the plaintext size.
+func (s *S3Storage) PutMedia(ctx context.Context, m *models.Media, body io.Reader) (int64, error) {
+	if m.Encryption == nil {
+		return s.UploadStream(ctx, m.S3Key, m.MimeType, body)
+	}
+	key, err := s.dataKey(ctx, m.Encryption)
+	if err != nil {
+		return 0, err
+	}
+	if m.Encryption.Mode == EncryptionSSEC {
+		return s.uploadStream(ctx, m.S3Key, m.MimeType, body, newSSECustomerKey(key))
+	}
+
+	enc, err := newGCMEncrypter(body, key)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.uploadStream(ctx, m.S3Key, "application/octet-stream", enc, nil); err != nil {
+		return 0, err
+	}
+	return enc.size, nil
+}
+
+// OpenMedia reads m's content, decrypting it if need be. The reader can
+// seek, for range requests, and knows its size for encrypted media only.
+func (s *S3Storage) OpenMedia(ctx context.Context, m *models.Media) (io.ReadSeekCloser, error) {
+	if m.Encryption == nil {
+		return &objectReader{size: -1, open: func(off int64) (io.ReadCloser, error) {
+			return s.getObject(ctx, m.S3Key, off, nil)
+		}}, nil
+	}
+	key, err := s.dataKey(ctx, m.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	size := m.Encryption.Size
+	if m.Encryption.Mode == EncryptionSSEC {
+		sse := newSSECustomerKey(key)
+		return &objectReader{size: size, open: func(off int64) (io.ReadCloser, error) {
+			return s.getObject(ctx, m.S3Key, off, sse)
+		}}, nil
+	}
+
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	var prefix []byte
+	return &objectReader{size: size, open: func(off int64) (io.ReadCloser, error) {
+		index := off / gcmSegmentSize
+		if prefix == nil && index > 0 {
+			header, err := s.getObject(ctx, m.S3Key, 0, nil)
+			if err != nil {
+				return nil, err
+			}
+			prefix, err = readGCMHeader(header)
+			header.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		start := int64(0)
+		if prefix != nil {
+			start = int64(gcmHeaderSize) + index*(gcmSegmentSize+gcmTagSize)
+		}
+		body, err := s.getObject(ctx, m.S3Key, start, nil)
+		if err != nil {
+			return nil, err
+		}
+		if prefix == nil {
+			if prefix, err = readGCMHeader(body); err != nil {
+				body.Close()
+				return nil, err
+			}
+		}
+		return &gcmDecrypter{
+			body:   body,
+			aead:   aead,
+			prefix: prefix,
+			index:  index,
+			last:   lastSegment(size),
+			buf:    make([]byte, gcmSegmentSize+gcmTagSize),
+			skip:   int(off - index*gcmSegmentSize),
+		}, nil
+	}}, nil
+}
+
+func (s *S3Storage) getObject(ctx context.Context, key string, off int64, sse *sseCustomerKey) (io.ReadCloser, error) {
+	in := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if off > 0 {
+		in.Range = aws.String(fmt.Sprintf("bytes=%d-", off))
+	}
+	if sse != nil {
+		in.SSECustomerAlgorithm = aws.String(sse.algorithm)
+		in.SSECustomerKey = aws.String(sse.key)
+		in.SSECustomerKeyMD5 = aws.String(sse.keyMD5)
+	}
+	out, err := s.client.GetObject(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// sseCustomerKey is a data key in the form S3 takes it for SSE-C.
+type sseCustomerKey struct {
+	algorithm string
+	key       string
+	keyMD5    string
+}
+
+func newSSECustomerKey(key []byte) *sseCustomerKey {
+	sum := md5.Sum(key)
+	return &sseCustomerKey{
+		algorithm: "AES256",
+		key:       base64.StdEncoding.EncodeToString(key),
+		keyMD5:    base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+// objectReader reads an object from an offset, reopening it after a seek.
+// size is -1 if unknown, which disables seeking from the end.
+type objectReader struct {
+	open func(off int64) (io.ReadCloser, error)
+	size int64
+	off  int64
+	body io.ReadCloser
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	if r.size >= 0 && r.off >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.open(r.off)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.off += int64(n)
+	if err == io.EOF && r.size >= 0 && r.off < r.size {
+		err = errCorruptObject
+	}
+	return n, err
+}
+
+func (r *objectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		if r.size < 0 {
+			return 0, errors.New("object size unknown")
+		}
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if offset != r.off && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.off = offset
+	return offset, nil
+}
+
+func (r *objectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func segmentNonce(prefix []byte, index int64, last bool) []byte {
+	nonce := make([]byte, gcmPrefixSize+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[gcmPrefixSize:], uint32(index))
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// lastSegment is the index of the final segment of size plaintext bytes;
+// empty objects still have one, empty, segment.
+func lastSegment(size int64) int64 {
+	if size == 0 {
+		return 0
+	}
+	return (size - 1) / gcmSegmentSize
+}
+
+func readGCMHeader(r io.Reader) ([]byte, error) {
+	header := make([]byte, gcmHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:len(gcmMagic)]) != gcmMagic {
+		return nil, errCorruptObject
+	}
+	return header[len(gcmMagic):], nil
+}
+
+// gcmEncrypter reads plaintext from src and yields the encrypted object.
+type gcmEncrypter struct {
+	src    *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  int64
+	plain  []byte
+	sealed []byte
+	out    []byte
+	done   bool
+	size   int64
+}
+
+func newGCMEncrypter(src io.Reader, key []byte) (*gcmEncrypter, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, gcmPrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	return &gcmEncrypter{
+		src:    bufio.NewReaderSize(src, gcmSegmentSize),
+		aead:   aead,
+		prefix: prefix,
+		plain:  make([]byte, gcmSegmentSize),
+		sealed: make([]byte, 0, gcmSegmentSize+gcmTagSize),
+		out:    append([]byte(gcmMagic), prefix...),
+	}, nil
+}
+
+func (e *gcmEncrypter) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.seal(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+func (e *gcmEncrypter) seal() error {
+	n, err := io.ReadFull(e.src, e.plain)
+	last := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !last {
+		return err
+	}
+	if !last {
+		// A full segment is the last one if nothing follows it
+		if _, err := e.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+	e.out = e.aead.Seal(e.sealed[:0], segmentNonce(e.prefix, e.index, last), e.plain[:n], nil)
+	e.size += int64(n)
+	e.index++
+	e.done = last
+	return nil
+}
+
+// gcmDecrypter reads an encrypted object from segment index on, dropping
+// the first skip bytes of plaintext.
+type gcmDecrypter struct {
+	body   io.ReadCloser
+	aead   cipher.AEAD
+	prefix []byte
+	index  int64
+	last   int64
+	buf    []byte
+	out    []byte
+	skip   int
+}
+
+func (d *gcmDecrypter) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.index > d.last {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *gcmDecrypter) open() error {
+	n, err := io.ReadFull(d.body, d.buf)
+	if err != nil && (d.index < d.last || (err != io.EOF && err != io.ErrUnexpectedEOF)) {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errCorruptObject
+		}
+		return err
+	}
+	plain, err := d.aead.Open(d.buf[:0], segmentNonce(d.prefix, d.index, d.index == d.last), d.buf[:n], nil)
+	if err != nil {
+		return errCorruptObject
+	}
+	if d.skip > len(plain) {
+		d.skip = len(plain)
+	}
+	d.out = plain[d.skip:]
+	d.skip = 0
+	d.index++
+	return nil
+}
+
+func (d *gcmDecrypter) Close() error {
+	return d.body.Close()
+}
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EncryptionService manages which workspaces keep their media encrypted
+// and serves encrypted content. Only media uploaded after encryption is
+// enabled are encrypted; existing objects are left as they are.
+type EncryptionService struct {
+	db      *database.MongoDB
+	storage *S3Storage
+}
+
+func NewEncryptionService(db *database.MongoDB, storage *S3Storage) *EncryptionService {
+	return &EncryptionService{db: db, storage: storage}
+}
+
+func (s *EncryptionService) Get(ctx context.Context, workspaceID string) (*models.WorkspaceEncryption, error) {
+	var settings models.WorkspaceEncryption
+	err := s.db.Collection("workspace_encryption").FindOne(ctx, bson.M{"_id": workspaceID}).Decode(&settings)
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// Enable turns on encryption for new uploads to a workspace, or changes
+// the mode used from now on. It can't be turned off again.
+func (s *EncryptionService) Enable(ctx context.Context, workspaceID, userID string, req *models.EnableEncryptionRequest) (*models.WorkspaceEncryption, error) {
+	if !s.storage.EncryptionEnabled() {
+		return nil, ErrEncryptionDisabled
+	}
+	mode := req.Mode
+	if mode == "" {
+		mode = EncryptionAESGCM
+	}
+
+	now := time.Now()
+	_, err := s.db.Collection("workspace_encryption").UpdateOne(ctx,
+		bson.M{"_id": workspaceID},
+		bson.M{
+			"$set": bson.M{"mode": mode, "updatedAt": now},
+			"$setOnInsert": bson.M{
+				"keyId":     workspaceKeyID(workspaceID),
+				"enabledBy": userID,
+				"createdAt": now,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, workspaceID)
+}
+
+// Rotate makes a new version of the workspace's key current and rewraps
+// the data keys of its media with it, without touching the objects.
+// Earlier versions are kept, so anything not rewrapped (trashed media,
+// failures) still decrypts.
+func (s *EncryptionService) Rotate(ctx context.Context, workspaceID string) (*models.KeyRotationResult, error) {
+	settings, err := s.Get(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.storage.RotateKey(ctx, settings.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.KeyRotationResult{KeyID: settings.KeyID, KeyVersion: version}
+	for _, collection := range []string{"media", "media_versions"} {
+		if err := s.rewrap(ctx, collection, settings.KeyID, version, result); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	_, err = s.db.Collection("workspace_encryption").UpdateOne(ctx,
+		bson.M{"_id": workspaceID},
+		bson.M{"$set": bson.M{"keyVersion": version, "rotatedAt": now, "updatedAt": now}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// rewrap moves the data keys in collection still wrapped by an older
+// version of keyID to version, counting the outcome in result.
+func (s *EncryptionService) rewrap(ctx context.Context, collection, keyID string, version int, result *models.KeyRotationResult) error {
+	cursor, err := s.db.Collection(collection).Find(ctx,
+		bson.M{"encryption.keyId": keyID, "encryption.keyVersion": bson.M{"$lt": version}},
+		options.Find().SetProjection(bson.M{"encryption": 1}),
+	)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID         string                  `bson:"_id"`
+			Encryption *models.MediaEncryption `bson:"encryption"`
+		}
+		if err := cursor.Decode(&doc); err != nil || doc.Encryption == nil {
+			result.Failed++
+			continue
+		}
+		enc, err := s.storage.RewrapKey(ctx, doc.Encryption)
+		if err == nil {
+			// Matching the old version leaves a concurrent rewrap alone
+			_, err = s.db.Collection(collection).UpdateOne(ctx,
+				bson.M{"_id": doc.ID, "encryption.keyVersion": doc.Encryption.KeyVersion},
+				bson.M{"$set": bson.M{"encryption.keyVersion": enc.KeyVersion, "encryption.wrappedKey": enc.WrappedKey}},
+			)
+		}
+		if err != nil {
+			log.Printf("Failed to rewrap data key of %s %s: %v", collection, doc.ID, err)
+			result.Failed++
+			continue
+		}
+		result.Rewrapped++
+	}
+	return cursor.Err()
+}
+
+// Media loads media with their wrapped data key, which the media cache
+// doesn't hold. Content URLs of versions and archives carry their own ID,
+// so those are loaded as media too.
+func (s *EncryptionService) Media(ctx context.Context, mediaID string) (*models.Media, error) {
+	var media models.Media
+	err := s.db.Collection("media").FindOne(ctx, bson.M{"_id": mediaID}).Decode(&media)
+	if err != mongo.ErrNoDocuments {
+		if err != nil {
+			return nil, err
+		}
+		return &media, nil
+	}
+
+	var version models.MediaVersion
+	err = s.db.Collection("media_versions").FindOne(ctx, bson.M{"_id": mediaID}).Decode(&version)
+	if err != mongo.ErrNoDocuments {
+		if err != nil {
+			return nil, err
+		}
+		return versionContent(&version), nil
+	}
+
+	var archive models.MediaArchive
+	err = s.db.Collection("media_archives").FindOne(ctx,
+		bson.M{"_id": mediaID, "expiresAt": bson.M{"$gt": time.Now()}},
+	).Decode(&archive)
+	if err != nil {
+		return nil, err
+	}
+	return archiveContent(&archive), nil
+}
+
+// Store uploads media or version content through the service, encrypting
+// it.
+func (s *EncryptionService) Store(ctx context.Context, media *models.Media, body io.Reader) error {
+	size, err := s.storage.PutMedia(ctx, media, body)
+	if err != nil {
+		return err
+	}
+	if media.Encryption == nil {
+		return nil
+	}
+	set := bson.M{"$set": bson.M{"encryption.size": size}}
+	res, err := s.db.Collection("media").UpdateOne(ctx, bson.M{"_id": media.ID}, set)
+	if err == nil && res.MatchedCount == 0 {
+		_, err = s.db.Collection("media_versions").UpdateOne(ctx, bson.M{"_id": media.ID}, set)
+	}
+	return err
+}
+
+// Open returns the decrypted content of media.
+func (s *EncryptionService) Open(ctx context.Context, media *models.Media) (io.ReadSeekCloser, error) {
+	return s.storage.OpenMedia(ctx, media)
+}
+
+// VerifyContentURL checks a signed content URL; see S3Storage.MediaURL.
+func (s *EncryptionService) VerifyContentURL(method, mediaID string, query url.Values) error {
+	return s.storage.VerifyContentURL(method, mediaID, query)
+}
+
+// newMediaEncryption gives media uploaded to an encrypted workspace their
+// own data key, or returns nil for other workspaces.
+func newMediaEncryption(ctx context.Context, db *database.MongoDB, storage *S3Storage, workspaceID string) (*models.MediaEncryption, error) {
+	if workspaceID == "" {
+		return nil, nil
+	}
+	var settings models.WorkspaceEncryption
+	err := db.Collection("workspace_encryption").FindOne(ctx, bson.M{"_id": workspaceID}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Fails if the KMS is no longer configured, rather than storing plaintext
+	return storage.NewDataKey(ctx, settings.KeyID, settings.Mode)
+}
+
+// placedEncryption is enc as it must be stored once media go from one
+// workspace to another: with the data key wrapped by the target's key, so
+// the target's rotations cover it. The object itself stays as it is, so
+// unencrypted media can't go into an encrypted workspace.
+func placedEncryption(ctx context.Context, db *database.MongoDB, storage *S3Storage, enc *models.MediaEncryption, from, to string) (*models.MediaEncryption, error) {
+	if from == to || to == "" {
+		return enc, nil
+	}
+	if enc != nil {
+		return storage.RewrapKeyTo(ctx, enc, workspaceKeyID(to))
+	}
+	n, err := db.Collection("workspace_encryption").CountDocuments(ctx, bson.M{"_id": to})
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, ErrPlaintextMove
+	}
+	return nil, nil
+}
@@ -20,14 +20,12 @@ func NewFavoriteService(db *database.MongoDB) *FavoriteService {
 }
 
 func (s *FavoriteService) AddFavorite(ctx context.Context, userID, mediaID string) error {
-	fav := &models.MediaFavorite{
-		ID:        uuid.New().String(),
-		UserID:    userID,
-		MediaID:   mediaID,
-		CreatedAt: time.Now(),
-	}
-
-	_, err := s.db.Collection("media_favorites").InsertOne(ctx, fav)
+	// Upsert so favoriting twice is a no-op rather than a unique index error
+	_, err := s.db.Collection("media_favorites").UpdateOne(ctx,
+		bson.M{"userId": userID, "mediaId": mediaID},
+		bson.M{"$setOnInsert": bson.M{"_id": uuid.New().String(), "createdAt": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
 	return err
 }
 
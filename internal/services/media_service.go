@@ -4,46 +4,87 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/events"
 	"github.com/quckapp/media-service/internal/models"
+	"github.com/quckapp/media-service/internal/realtime"
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type MediaService struct {
-	db      *database.MongoDB
-	redis   *redis.Client
-	storage *S3Storage
+	db       *database.MongoDB
+	redis    *redis.Client
+	storage  *S3Storage
+	audit    *Auditor
+	events   *events.Publisher
+	realtime *realtime.Hub
 }
 
-func NewMediaService(db *database.MongoDB, redis *redis.Client, storage *S3Storage) *MediaService {
-	return &MediaService{db: db, redis: redis, storage: storage}
+func NewMediaService(db *database.MongoDB, redis *redis.Client, storage *S3Storage, audit *Auditor, publisher *events.Publisher, hub *realtime.Hub) *MediaService {
+	return &MediaService{db: db, redis: redis, storage: storage, audit: audit, events: publisher, realtime: hub}
 }
 
 func (s *MediaService) Create(ctx context.Context, userID string, req *models.UploadRequest) (*models.Media, error) {
 	mediaID := uuid.New().String()
 	s3Key := fmt.Sprintf("media/%s/%s/%s", userID, mediaID, req.Filename)
 
+	encryption, err := newMediaEncryption(ctx, s.db, s.storage, req.WorkspaceID)
+	if err != nil {
+		return nil, err
+	}
+
 	media := &models.Media{
-		ID:        mediaID,
-		UserID:    userID,
-		Type:      getMediaType(req.MimeType),
-		Filename:  req.Filename,
-		MimeType:  req.MimeType,
-		Size:      req.Size,
-		S3Key:     s3Key,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	_, err := s.db.Collection("media").InsertOne(ctx, media)
+		ID:           mediaID,
+		UserID:       userID,
+		Type:         getMediaType(req.MimeType),
+		Filename:     req.Filename,
+		MimeType:     req.MimeType,
+		Size:         req.Size,
+		S3Key:        s3Key,
+		TakenAt:      req.TakenAt,
+		StorageClass: req.StorageClass,
+		Encryption:   encryption,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if req.WorkspaceID != "" || req.ChannelID != "" {
+		media.Metadata = map[string]string{}
+		if req.WorkspaceID != "" {
+			media.Metadata["workspaceId"] = req.WorkspaceID
+		}
+		if req.ChannelID != "" {
+			media.Metadata["channelId"] = req.ChannelID
+		}
+	}
+
+	err = s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.db.Collection("media").InsertOne(ctx, media); err != nil {
+			return err
+		}
+		return publishMediaCreated(ctx, s.events, media)
+	})
 	if err != nil {
 		return nil, err
 	}
+	recordStorageEvent(ctx, s.db, media, req.WorkspaceID, media.Size, StorageCreate)
+	if req.WorkspaceID != "" {
+		checkWorkspaceQuota(ctx, s.db, s.events, req.WorkspaceID, media)
+	}
+
+	entry := mediaActivity(media, AuditUpload)
+	entry.UserID = userID
+	entry.After = map[string]string{"filename": media.Filename, "mimeType": media.MimeType, "size": strconv.FormatInt(media.Size, 10)}
+	if req.ChannelID != "" {
+		entry.After["channelId"] = req.ChannelID
+	}
+	s.audit.Record(ctx, entry)
+	s.realtime.Publish(ctx, realtime.MediaUploaded, realtimeScope(media), media)
 
 	return media, nil
 }
@@ -54,7 +95,7 @@ func (s *MediaService) GetPresignedUploadURL(ctx context.Context, userID string,
 		return nil, err
 	}
 
-	uploadURL, err := s.storage.GetPresignedUploadURL(media.S3Key, req.MimeType, 15*time.Minute)
+	uploadURL, err := s.storage.MediaUploadURL(media, 15*time.Minute)
 	if err != nil {
 		return nil, err
 	}
@@ -64,6 +105,7 @@ func (s *MediaService) GetPresignedUploadURL(ctx context.Context, userID string,
 		MediaID:   media.ID,
 		S3Key:     media.S3Key,
 		ExpiresAt: time.Now().Add(15 * time.Minute).Format(time.RFC3339),
+		Encrypted: media.Encryption != nil,
 	}, nil
 }
 
@@ -86,7 +128,7 @@ func (s *MediaService) Get(ctx context.Context, mediaID string) (*models.Media,
 	}
 
 	// Generate signed URL
-	media.URL, _ = s.storage.GetPresignedDownloadURL(media.S3Key, time.Hour)
+	media.URL, _ = s.storage.MediaURL(&media, time.Hour)
 
 	// Cache result
 	if data, err := json.Marshal(media); err == nil {
@@ -112,10 +154,21 @@ func (s *MediaService) Delete(ctx context.Context, mediaID, userID string) error
 	}
 
 	// Delete from DB
-	_, err = s.db.Collection("media").DeleteOne(ctx, bson.M{"_id": mediaID})
+	err = s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.db.Collection("media").DeleteOne(ctx, bson.M{"_id": mediaID}); err != nil {
+			return err
+		}
+		return publishMediaDeleted(ctx, s.events, media)
+	})
 	if err != nil {
 		return err
 	}
+	recordStorageEvent(ctx, s.db, media, media.Metadata["workspaceId"], -media.Size, StorageDelete)
+
+	entry := mediaActivity(media, AuditDelete)
+	entry.UserID = userID
+	entry.Before = map[string]string{"filename": media.Filename, "s3Key": media.S3Key, "size": strconv.FormatInt(media.Size, 10)}
+	s.audit.Record(ctx, entry)
 
 	// Invalidate cache
 	s.redis.Del(ctx, fmt.Sprintf("media:%s", mediaID))
@@ -140,7 +193,7 @@ func (s *MediaService) GetUserMedia(ctx context.Context, userID string, limit in
 
 	// Generate signed URLs
 	for i := range media {
-		media[i].URL, _ = s.storage.GetPresignedDownloadURL(media[i].S3Key, time.Hour)
+		media[i].URL, _ = s.storage.MediaURL(&media[i], time.Hour)
 	}
 
 	return media, nil
@@ -182,7 +235,7 @@ func (s *MediaService) GetMediaByChannel(ctx context.Context, channelID string,
 	}
 
 	for i := range media {
-		media[i].URL, _ = s.storage.GetPresignedDownloadURL(media[i].S3Key, time.Hour)
+		media[i].URL, _ = s.storage.MediaURL(&media[i], time.Hour)
 	}
 
 	return media, nil
@@ -204,7 +257,7 @@ func (s *MediaService) GetMediaByWorkspace(ctx context.Context, workspaceID stri
 	}
 
 	for i := range media {
-		media[i].URL, _ = s.storage.GetPresignedDownloadURL(media[i].S3Key, time.Hour)
+		media[i].URL, _ = s.storage.MediaURL(&media[i], time.Hour)
 	}
 
 	return media, nil
@@ -251,17 +304,28 @@ func (s *MediaService) UpdateMetadata(ctx context.Context, mediaID, userID strin
 	if err != nil {
 		return err
 	}
-	if media.UserID != userID {
+	if err := requireEditor(ctx, s.db, media, userID); err != nil {
+		return err
+	}
+	// Changing where media lives is a move, which only the owner may do
+	if media.UserID != userID && (metadata["workspaceId"] != media.Metadata["workspaceId"] || metadata["channelId"] != media.Metadata["channelId"]) {
 		return fmt.Errorf("unauthorized")
 	}
 
-	_, err = s.db.Collection("media").UpdateOne(ctx,
-		bson.M{"_id": mediaID},
-		bson.M{"$set": bson.M{"metadata": metadata, "updatedAt": time.Now()}},
-	)
+	err = s.place(ctx, media, metadata["workspaceId"], bson.M{"metadata": metadata, "updatedAt": time.Now()})
 	if err != nil {
 		return err
 	}
+	recordWorkspaceChange(ctx, s.db, media, media.Metadata["workspaceId"], metadata["workspaceId"])
+	if ws := metadata["workspaceId"]; ws != media.Metadata["workspaceId"] {
+		checkWorkspaceQuota(ctx, s.db, s.events, ws, media)
+	}
+
+	entry := mediaActivity(media, AuditMetadata)
+	entry.UserID = userID
+	entry.Before = media.Metadata
+	entry.After = metadata
+	s.audit.Record(ctx, entry)
 
 	s.redis.Del(ctx, fmt.Sprintf("media:%s", mediaID))
 	return nil
@@ -272,8 +336,8 @@ func (s *MediaService) Rename(ctx context.Context, mediaID, userID, newFilename
 	if err != nil {
 		return err
 	}
-	if media.UserID != userID {
-		return fmt.Errorf("unauthorized")
+	if err := requireEditor(ctx, s.db, media, userID); err != nil {
+		return err
 	}
 
 	_, err = s.db.Collection("media").UpdateOne(ctx,
@@ -284,6 +348,12 @@ func (s *MediaService) Rename(ctx context.Context, mediaID, userID, newFilename
 		return err
 	}
 
+	entry := mediaActivity(media, AuditRename)
+	entry.UserID = userID
+	entry.Before = map[string]string{"filename": media.Filename}
+	entry.After = map[string]string{"filename": newFilename}
+	s.audit.Record(ctx, entry)
+
 	s.redis.Del(ctx, fmt.Sprintf("media:%s", mediaID))
 	return nil
 }
@@ -296,25 +366,52 @@ func (s *MediaService) CopyMedia(ctx context.Context, mediaID, userID, targetWor
 	if media.UserID != userID {
 		return nil, fmt.Errorf("unauthorized")
 	}
+	if media.Encryption != nil {
+		// The cached copy lacks the wrapped data key the copy needs too
+		if err := s.db.Collection("media").FindOne(ctx, bson.M{"_id": mediaID}).Decode(media); err != nil {
+			return nil, err
+		}
+	}
+
+	encryption, err := placedEncryption(ctx, s.db, s.storage, media.Encryption, media.Metadata["workspaceId"], targetWorkspaceID)
+	if err != nil {
+		return nil, err
+	}
 
 	newID := uuid.New().String()
 	newMedia := &models.Media{
-		ID:        newID,
-		UserID:    userID,
-		Type:      media.Type,
-		Filename:  media.Filename,
-		MimeType:  media.MimeType,
-		Size:      media.Size,
-		S3Key:     media.S3Key, // shares same S3 key
-		Metadata:  map[string]string{"workspaceId": targetWorkspaceID},
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-
-	_, err = s.db.Collection("media").InsertOne(ctx, newMedia)
+		ID:           newID,
+		UserID:       userID,
+		Type:         media.Type,
+		Filename:     media.Filename,
+		MimeType:     media.MimeType,
+		Size:         media.Size,
+		S3Key:        media.S3Key, // shares same S3 key
+		Metadata:     map[string]string{"workspaceId": targetWorkspaceID},
+		StorageClass: media.StorageClass,
+		Encryption:   encryption, // and data key, wrapped by the target workspace's key
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	err = s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.db.Collection("media").InsertOne(ctx, newMedia); err != nil {
+			return err
+		}
+		return publishMediaCreated(ctx, s.events, newMedia)
+	})
 	if err != nil {
 		return nil, err
 	}
+	// Copies share the object but are charged to the target workspace
+	recordStorageEvent(ctx, s.db, newMedia, targetWorkspaceID, newMedia.Size, StorageCopy)
+	s.realtime.Publish(ctx, realtime.MediaUploaded, realtimeScope(newMedia), newMedia)
+	checkWorkspaceQuota(ctx, s.db, s.events, targetWorkspaceID, newMedia)
+
+	entry := mediaActivity(media, AuditCopy)
+	entry.UserID = userID
+	entry.After = map[string]string{"mediaId": newID, "workspaceId": targetWorkspaceID}
+	s.audit.Record(ctx, entry)
 	return newMedia, nil
 }
 
@@ -327,16 +424,122 @@ func (s *MediaService) MoveMedia(ctx context.Context, mediaID, userID, targetWor
 		return fmt.Errorf("unauthorized")
 	}
 
-	_, err = s.db.Collection("media").UpdateOne(ctx,
-		bson.M{"_id": mediaID},
-		bson.M{"$set": bson.M{
-			"metadata.workspaceId": targetWorkspaceID,
-			"updatedAt":            time.Now(),
-		}},
+	err = s.place(ctx, media, targetWorkspaceID, bson.M{
+		"metadata.workspaceId": targetWorkspaceID,
+		"updatedAt":            time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	recordWorkspaceChange(ctx, s.db, media, media.Metadata["workspaceId"], targetWorkspaceID)
+	if targetWorkspaceID != media.Metadata["workspaceId"] {
+		checkWorkspaceQuota(ctx, s.db, s.events, targetWorkspaceID, media)
+	}
+
+	entry := mediaActivity(media, AuditMove)
+	entry.UserID = userID
+	entry.Before = map[string]string{"workspaceId": media.Metadata["workspaceId"]}
+	entry.After = map[string]string{"workspaceId": targetWorkspaceID}
+	s.audit.Record(ctx, entry)
+
+	s.redis.Del(ctx, fmt.Sprintf("media:%s", mediaID))
+	return nil
+}
+
+// place applies set to media now belonging to workspace to, rewrapping
+// the data keys of the media and their versions for it if that is a move.
+func (s *MediaService) place(ctx context.Context, media *models.Media, to string, set bson.M) error {
+	from := media.Metadata["workspaceId"]
+	if from == to {
+		_, err := s.db.Collection("media").UpdateOne(ctx, bson.M{"_id": media.ID}, bson.M{"$set": set})
+		return err
+	}
+	enc := media.Encryption
+	if enc != nil {
+		// The cached copy lacks the wrapped data key to rewrap
+		var stored models.Media
+		if err := s.db.Collection("media").FindOne(ctx, bson.M{"_id": media.ID}).Decode(&stored); err != nil {
+			return err
+		}
+		enc = stored.Encryption
+	}
+	encryption, err := placedEncryption(ctx, s.db, s.storage, enc, from, to)
+	if err != nil {
+		return err
+	}
+	if encryption != nil {
+		set["encryption"] = encryption
+	}
+	versions, err := s.placedVersions(ctx, media.ID, from, to)
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.db.Collection("media").UpdateOne(ctx, bson.M{"_id": media.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+		for id, enc := range versions {
+			_, err := s.db.Collection("media_versions").UpdateOne(ctx,
+				bson.M{"_id": id},
+				bson.M{"$set": bson.M{"encryption": enc}},
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// placedVersions rewraps the data keys of mediaID's encrypted versions for
+// a move between workspaces, by version ID.
+func (s *MediaService) placedVersions(ctx context.Context, mediaID, from, to string) (map[string]*models.MediaEncryption, error) {
+	placed := map[string]*models.MediaEncryption{}
+	cursor, err := s.db.Collection("media_versions").Find(ctx,
+		bson.M{"mediaId": mediaID},
+		options.Find().SetProjection(bson.M{"encryption": 1}),
 	)
+	if err != nil {
+		return nil, err
+	}
+	var versions []models.MediaVersion
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		enc, err := placedEncryption(ctx, s.db, s.storage, v.Encryption, from, to)
+		if err != nil {
+			return nil, err
+		}
+		if enc != nil {
+			placed[v.ID] = enc
+		}
+	}
+	return placed, nil
+}
+
+// ReassignOwner transfers media to newOwner, moving its chargeback usage
+// with it. The change only applies if the media still belongs to fromOwner.
+func (s *MediaService) ReassignOwner(ctx context.Context, mediaID, fromOwner, newOwner string) error {
+	var media models.Media
+	err := s.db.Collection("media").FindOneAndUpdate(ctx,
+		bson.M{"_id": mediaID, "userId": fromOwner},
+		bson.M{"$set": bson.M{"userId": newOwner, "updatedAt": time.Now()}},
+	).Decode(&media)
 	if err != nil {
 		return err
 	}
+	workspaceID := media.Metadata["workspaceId"]
+	recordStorageEvent(ctx, s.db, &media, workspaceID, -media.Size, StorageReassignOut)
+	media.UserID = newOwner
+	recordStorageEvent(ctx, s.db, &media, workspaceID, media.Size, StorageReassignIn)
+
+	entry := mediaActivity(&media, AuditReassign)
+	entry.UserID = newOwner
+	entry.Before = map[string]string{"userId": fromOwner}
+	entry.After = map[string]string{"userId": newOwner}
+	s.audit.Record(ctx, entry)
 
 	s.redis.Del(ctx, fmt.Sprintf("media:%s", mediaID))
 	return nil
@@ -345,7 +548,7 @@ func (s *MediaService) MoveMedia(ctx context.Context, mediaID, userID, targetWor
 func (s *MediaService) BulkMove(ctx context.Context, mediaIDs []string, userID, targetWorkspaceID string) *models.BulkDeleteResponse {
 	resp := &models.BulkDeleteResponse{}
 	for _, id := range mediaIDs {
-		if err := s.MoveMedia(context.Background(), id, userID, targetWorkspaceID); err != nil {
+		if err := s.MoveMedia(ctx, id, userID, targetWorkspaceID); err != nil {
 			resp.Failed = append(resp.Failed, id)
 		} else {
 			resp.Deleted = append(resp.Deleted, id)
@@ -370,7 +573,7 @@ func (s *MediaService) GetMediaByType(ctx context.Context, userID, mediaType str
 	}
 
 	for i := range media {
-		media[i].URL, _ = s.storage.GetPresignedDownloadURL(media[i].S3Key, time.Hour)
+		media[i].URL, _ = s.storage.MediaURL(&media[i], time.Hour)
 	}
 
 	return media, nil
@@ -382,7 +585,7 @@ func (s *MediaService) GetDownloadURL(ctx context.Context, mediaID string) (stri
 		return "", err
 	}
 
-	url, err := s.storage.GetPresignedDownloadURL(media.S3Key, time.Hour)
+	url, err := s.storage.MediaURL(media, time.Hour)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // decoders for previews
+	"image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// Previews stand in for originals where a share link doesn't allow
+// downloads: small enough to browse with, too small to be worth saving.
+const (
+	previewMaxSide   = 640
+	previewQuality   = 80
+	previewMaxBytes  = 50 << 20
+	previewMaxPixels = 64 << 20
+)
+
+var ErrPreviewUnsupported = errors.New("no preview is available for this media")
+
+// renderPreview decodes a JPEG, PNG or GIF and returns it as a JPEG no
+// larger than previewMaxSide on its longest side.
+func renderPreview(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, previewMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > previewMaxBytes {
+		return nil, ErrPreviewUnsupported
+	}
+	// Check the dimensions first so a small, highly compressed file can't
+	// decode into an enormous image
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || cfg.Width*cfg.Height > previewMaxPixels {
+		return nil, ErrPreviewUnsupported
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, downscale(src, previewMaxSide), &jpeg.Options{Quality: previewQuality}); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// downscale fits src within maxSide, averaging the source pixels behind
+// each output pixel. Smaller images are only flattened onto white.
+func downscale(src image.Image, maxSide int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			dw, dh = maxSide, max(1, h*maxSide/w)
+		} else {
+			dw, dh = max(1, w*maxSide/h), maxSide
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*w/dw, b.Min.X+(x+1)*w/dw
+			var sr, sg, sb, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, bl, a := src.At(sx, sy).RGBA()
+					// Transparent areas come out white rather than black
+					sr += uint64(r + 0xffff - a)
+					sg += uint64(g + 0xffff - a)
+					sb += uint64(bl + 0xffff - a)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(sr / n), G: uint16(sg / n), B: uint16(sb / n), A: 0xffff})
+		}
+	}
+	return dst
+}
@@ -6,17 +6,22 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/events"
 	"github.com/quckapp/media-service/internal/models"
+	"github.com/quckapp/media-service/internal/realtime"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ProcessingService struct {
-	db *database.MongoDB
+	db       *database.MongoDB
+	events   *events.Publisher
+	realtime *realtime.Hub
 }
 
-func NewProcessingService(db *database.MongoDB) *ProcessingService {
-	return &ProcessingService{db: db}
+func NewProcessingService(db *database.MongoDB, publisher *events.Publisher, hub *realtime.Hub) *ProcessingService {
+	return &ProcessingService{db: db, events: publisher, realtime: hub}
 }
 
 func (s *ProcessingService) CreateJob(ctx context.Context, mediaID, userID string, req *models.CreateProcessingJobRequest) (*models.ProcessingJob, error) {
@@ -97,12 +102,65 @@ func (s *ProcessingService) UpdateJobStatus(ctx context.Context, jobID, status s
 	if jobError != "" {
 		update["error"] = jobError
 	}
+	if status == "completed" {
+		update["progress"] = 100
+	}
 
-	_, err := s.db.Collection("media_processing_jobs").UpdateOne(ctx,
-		bson.M{"_id": jobID},
-		bson.M{"$set": update},
-	)
-	return err
+	var job models.ProcessingJob
+	err := s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		err := s.db.Collection("media_processing_jobs").FindOneAndUpdate(ctx,
+			bson.M{"_id": jobID},
+			bson.M{"$set": update},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&job)
+		if err != nil || (status != "completed" && status != "failed") {
+			return err
+		}
+		media := mediaTarget(ctx, s.db, job.MediaID)
+		return s.events.Enqueue(ctx, events.JobCompleted, media.Metadata["workspaceId"], job.ID, events.JobCompletedData{
+			JobID:   job.ID,
+			MediaID: job.MediaID,
+			UserID:  job.UserID,
+			Type:    job.Type,
+			Status:  job.Status,
+			Result:  job.Result,
+			Error:   job.Error,
+		})
+	})
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.realtime.Publish(ctx, realtime.JobUpdated, realtime.Scope{MediaID: job.MediaID, UserID: job.UserID}, &job)
+	return nil
+}
+
+// UpdateJobProgress records how far a running job has got, as a percentage,
+// and pushes it to subscribers. Finished jobs are left alone.
+func (s *ProcessingService) UpdateJobProgress(ctx context.Context, jobID string, progress int) error {
+	if progress < 0 {
+		progress = 0
+	}
+	if progress > 100 {
+		progress = 100
+	}
+
+	var job models.ProcessingJob
+	err := s.db.Collection("media_processing_jobs").FindOneAndUpdate(ctx,
+		bson.M{"_id": jobID, "status": bson.M{"$in": bson.A{"pending", "processing"}}},
+		bson.M{"$set": bson.M{"status": "processing", "progress": progress, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.realtime.Publish(ctx, realtime.JobUpdated, realtime.Scope{MediaID: job.MediaID, UserID: job.UserID}, &job)
+	return nil
 }
 
 func (s *ProcessingService) CancelJob(ctx context.Context, jobID, userID string) error {
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimit is a token bucket: Burst requests at once, refilled at Rate
+// per second.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // until a request would be allowed; zero if it is
+	Reset      time.Duration // until the bucket is full again
+}
+
+// The bucket is a hash of the tokens left and when it was last updated.
+// Running it as one script keeps concurrent requests from different
+// replicas from spending the same tokens, and the Redis clock keeps their
+// clocks out of it. Idle buckets expire once they would be full anyway.
+var tokenBucket = redis.NewScript(`
+redis.replicate_commands()
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate)
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = (1 - tokens) / rate
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(tokens), tostring(retry)}
+`)
+
+type RateLimiter struct {
+	redis *redis.Client
+}
+
+func NewRateLimiter(redis *redis.Client) *RateLimiter {
+	return &RateLimiter{redis: redis}
+}
+
+// Allow takes a token from the bucket named key.
+func (r *RateLimiter) Allow(ctx context.Context, key string, limit RateLimit) (*RateLimitResult, error) {
+	res, err := tokenBucket.Run(ctx, r.redis, []string{"ratelimit:" + key},
+		limit.Rate, limit.Burst,
+	).Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	retryStr, _ := res[2].(string)
+	tokens, _ := strconv.ParseFloat(tokensStr, 64)
+	retry, _ := strconv.ParseFloat(retryStr, 64)
+	return &RateLimitResult{
+		Allowed:    allowed == 1,
+		Limit:      limit.Burst,
+		Remaining:  int(math.Floor(tokens)),
+		RetryAfter: time.Duration(retry * float64(time.Second)),
+		Reset:      time.Duration((float64(limit.Burst) - tokens) / limit.Rate * float64(time.Second)),
+	}, nil
+}
@@ -0,0 +1,17 @@
+package services
+
+import (
+	"github.com/quckapp/media-service/internal/models"
+	"github.com/quckapp/media-service/internal/realtime"
+)
+
+// realtimeScope delivers an update about media to everyone following the
+// media itself, its channel or workspace, and to its owner.
+func realtimeScope(media *models.Media) realtime.Scope {
+	return realtime.Scope{
+		MediaID:     media.ID,
+		ChannelID:   media.Metadata["channelId"],
+		WorkspaceID: media.Metadata["workspaceId"],
+		UserID:      media.UserID,
+	}
+}
@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/quckapp/media-service/internal/realtime"
+)
+
+const maxRealtimeTopics = 100
+
+type RealtimeService struct {
+	hub    *realtime.Hub
+	policy *AccessPolicy
+}
+
+func NewRealtimeService(hub *realtime.Hub, policy *AccessPolicy) *RealtimeService {
+	return &RealtimeService{hub: hub, policy: policy}
+}
+
+// RealtimeTopics lists what a client wants to follow. Its own jobs and
+// media are always included.
+type RealtimeTopics struct {
+	MediaIDs     []string
+	ChannelIDs   []string
+	WorkspaceIDs []string
+}
+
+// Subscribe follows the requested topics for p. It needs view access to
+// each media item, membership of each channel and a member role in each
+// workspace, so guests can't follow whole workspaces.
+func (s *RealtimeService) Subscribe(ctx context.Context, p *Principal, t RealtimeTopics) (*realtime.Subscription, error) {
+	if n := len(t.MediaIDs) + len(t.ChannelIDs) + len(t.WorkspaceIDs); n > maxRealtimeTopics {
+		return nil, &InvalidParamError{Param: "topics", Message: fmt.Sprintf("at most %d topics per stream", maxRealtimeTopics)}
+	}
+	if err := s.policy.RequireMediaAll(ctx, p, t.MediaIDs, PermView); err != nil {
+		return nil, err
+	}
+
+	topics := []realtime.Topic{realtime.UserTopic(p.UserID)}
+	for _, id := range t.MediaIDs {
+		topics = append(topics, realtime.MediaTopic(id))
+	}
+	for _, id := range t.ChannelIDs {
+		if err := s.policy.RequireChannel(p, id); err != nil {
+			return nil, err
+		}
+		topics = append(topics, realtime.ChannelTopic(id))
+	}
+	for _, id := range t.WorkspaceIDs {
+		if err := s.policy.RequireWorkspace(ctx, p, id); err != nil {
+			return nil, err
+		}
+		topics = append(topics, realtime.WorkspaceTopic(id))
+	}
+	return s.hub.Subscribe(topics...), nil
+}
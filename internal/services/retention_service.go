@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -49,15 +48,7 @@ func (s *RetentionService) GetByID(ctx context.Context, policyID string) (*model
 	return &policy, nil
 }
 
-func (s *RetentionService) Update(ctx context.Context, policyID, userID string, req *models.UpdateRetentionPolicyRequest) (*models.RetentionPolicy, error) {
-	policy, err := s.GetByID(ctx, policyID)
-	if err != nil {
-		return nil, err
-	}
-	if policy.CreatedBy != userID {
-		return nil, fmt.Errorf("unauthorized")
-	}
-
+func (s *RetentionService) Update(ctx context.Context, policyID string, req *models.UpdateRetentionPolicyRequest) (*models.RetentionPolicy, error) {
 	update := bson.M{"updatedAt": time.Now()}
 	if req.Name != "" {
 		update["name"] = req.Name
@@ -72,7 +63,7 @@ func (s *RetentionService) Update(ctx context.Context, policyID, userID string,
 		update["autoDelete"] = *req.AutoDelete
 	}
 
-	_, err = s.db.Collection("retention_policies").UpdateOne(ctx,
+	_, err := s.db.Collection("retention_policies").UpdateOne(ctx,
 		bson.M{"_id": policyID},
 		bson.M{"$set": update},
 	)
@@ -82,15 +73,8 @@ func (s *RetentionService) Update(ctx context.Context, policyID, userID string,
 	return s.GetByID(ctx, policyID)
 }
 
-func (s *RetentionService) Delete(ctx context.Context, policyID, userID string) error {
-	policy, err := s.GetByID(ctx, policyID)
-	if err != nil {
-		return err
-	}
-	if policy.CreatedBy != userID {
-		return fmt.Errorf("unauthorized")
-	}
-	_, err = s.db.Collection("retention_policies").DeleteOne(ctx, bson.M{"_id": policyID})
+func (s *RetentionService) Delete(ctx context.Context, policyID string) error {
+	_, err := s.db.Collection("retention_policies").DeleteOne(ctx, bson.M{"_id": policyID})
 	return err
 }
 
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WorkspaceRole is a principal's standing in a workspace. Each role
+// includes the ones below it.
+type WorkspaceRole int
+
+const (
+	RoleNone WorkspaceRole = iota
+	RoleGuest
+	RoleMember
+	RoleAdmin
+	RoleOwner
+)
+
+var roleNames = map[string]WorkspaceRole{
+	"guest":  RoleGuest,
+	"member": RoleMember,
+	"admin":  RoleAdmin,
+	"owner":  RoleOwner,
+}
+
+func (r WorkspaceRole) String() string {
+	for name, role := range roleNames {
+		if role == r {
+			return name
+		}
+	}
+	return "none"
+}
+
+// ParseWorkspaceRole maps a role name to its level; unknown names grant
+// nothing.
+func ParseWorkspaceRole(s string) WorkspaceRole {
+	return roleNames[s]
+}
+
+// PlatformAdmin is the token role of QuckApp operators, who hold every
+// workspace role everywhere. An unrestricted API key with the admin scope
+// counts as one.
+const PlatformAdmin = "platform_admin"
+
+func (p *Principal) IsPlatformAdmin() bool {
+	if p.KeyID != "" {
+		return p.AnyWorkspace && contains(p.Scopes, ScopeAdmin)
+	}
+	return contains(p.Roles, PlatformAdmin)
+}
+
+// WorkspaceRole resolves p's role in a workspace from, in order: platform
+// admin, the token's workspaceRoles claim, the workspace_members
+// collection, and plain membership of the token's workspaces (member).
+// API keys are admins of the workspaces they may use with the admin scope
+// and members otherwise.
+func (a *AccessPolicy) WorkspaceRole(ctx context.Context, p *Principal, workspaceID string) (WorkspaceRole, error) {
+	if p.UserID == "" || workspaceID == "" {
+		return RoleNone, nil
+	}
+	if p.IsPlatformAdmin() {
+		return RoleOwner, nil
+	}
+	if p.KeyID != "" {
+		switch {
+		case !p.InWorkspace(workspaceID):
+			return RoleNone, nil
+		case contains(p.Scopes, ScopeAdmin):
+			return RoleAdmin, nil
+		}
+		return RoleMember, nil
+	}
+	if name, ok := p.WorkspaceRoles[workspaceID]; ok {
+		return ParseWorkspaceRole(name), nil
+	}
+
+	var member models.WorkspaceMember
+	err := a.db.Collection("workspace_members").FindOne(ctx, bson.M{"workspaceId": workspaceID, "userId": p.UserID}).Decode(&member)
+	if err == nil {
+		return ParseWorkspaceRole(member.Role), nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return RoleNone, err
+	}
+	if p.InWorkspace(workspaceID) {
+		return RoleMember, nil
+	}
+	return RoleNone, nil
+}
+
+// RequireRole returns ErrForbidden unless p holds at least want in the
+// workspace.
+func (a *AccessPolicy) RequireRole(ctx context.Context, p *Principal, workspaceID string, want WorkspaceRole) error {
+	got, err := a.WorkspaceRole(ctx, p, workspaceID)
+	if err != nil {
+		return err
+	}
+	if got < want {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// RequirePlatformAdmin guards operations that span workspaces.
+func (a *AccessPolicy) RequirePlatformAdmin(p *Principal) error {
+	if !p.IsPlatformAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -1,20 +1,30 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"io"
+	"mime"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/quckapp/media-service/internal/config"
+	"github.com/quckapp/media-service/internal/kms"
 )
 
 type S3Storage struct {
 	client  *s3.Client
 	bucket  string
 	presign *s3.PresignClient
+
+	// Set by EnableEncryption
+	kms           kms.KMS
+	contentBase   string
+	contentSecret []byte
 }
 
 func NewS3Storage(cfg *config.Config) (*S3Storage, error) {
@@ -63,6 +73,24 @@ func (s *S3Storage) GetPresignedDownloadURL(key string, expiry time.Duration) (s
 	return req.URL, nil
 }
 
+// GetPresignedContentURL is like GetPresignedDownloadURL but has S3 serve
+// the object inline or as an attachment named filename.
+func (s *S3Storage) GetPresignedContentURL(key, filename string, attachment bool, expiry time.Duration) (string, error) {
+	disposition := "inline"
+	if attachment {
+		disposition = "attachment"
+	}
+	req, err := s.presign.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket:                     aws.String(s.bucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(mime.FormatMediaType(disposition, map[string]string{"filename": filename})),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
 func (s *S3Storage) Delete(key string) error {
 	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
@@ -70,3 +98,91 @@ func (s *S3Storage) Delete(key string) error {
 	})
 	return err
 }
+
+// S3 parts must be at least 5 MiB, except the last, and there may be at
+// most 10,000 of them, which caps uploads at about 80 GiB.
+const uploadPartSize = 8 << 20
+
+// UploadStream uploads body of unknown length as a multipart upload,
+// holding one part in memory at a time. A failed upload is aborted so no
+// parts are left behind.
+func (s *S3Storage) UploadStream(ctx context.Context, key, contentType string, body io.Reader) (int64, error) {
+	return s.uploadStream(ctx, key, contentType, body, nil)
+}
+
+// uploadStream has S3 encrypt the object with sse, if set.
+func (s *S3Storage) uploadStream(ctx context.Context, key, contentType string, body io.Reader, sse *sseCustomerKey) (int64, error) {
+	in := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	}
+	if sse != nil {
+		in.SSECustomerAlgorithm = aws.String(sse.algorithm)
+		in.SSECustomerKey = aws.String(sse.key)
+		in.SSECustomerKeyMD5 = aws.String(sse.keyMD5)
+	}
+	created, err := s.client.CreateMultipartUpload(ctx, in)
+	if err != nil {
+		return 0, err
+	}
+
+	size, parts, err := s.uploadParts(ctx, key, created.UploadId, body, sse)
+	if err == nil {
+		_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(s.bucket),
+			Key:             aws.String(key),
+			UploadId:        created.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if err != nil {
+		s.client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.bucket),
+			Key:      aws.String(key),
+			UploadId: created.UploadId,
+		})
+		return 0, err
+	}
+	return size, nil
+}
+
+func (s *S3Storage) uploadParts(ctx context.Context, key string, uploadID *string, body io.Reader, sse *sseCustomerKey) (int64, []types.CompletedPart, error) {
+	var (
+		size  int64
+		parts []types.CompletedPart
+		buf   = make([]byte, uploadPartSize)
+	)
+	for number := int32(1); ; number++ {
+		n, err := io.ReadFull(body, buf)
+		if err == io.EOF && number > 1 {
+			return size, parts, nil
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, nil, err
+		}
+
+		part := &s3.UploadPartInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(key),
+			UploadId:   uploadID,
+			PartNumber: aws.Int32(number),
+			Body:       bytes.NewReader(buf[:n]),
+		}
+		if sse != nil {
+			part.SSECustomerAlgorithm = aws.String(sse.algorithm)
+			part.SSECustomerKey = aws.String(sse.key)
+			part.SSECustomerKeyMD5 = aws.String(sse.keyMD5)
+		}
+		out, uerr := s.client.UploadPart(ctx, part)
+		if uerr != nil {
+			return 0, nil, uerr
+		}
+		parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(number)})
+		size += int64(n)
+
+		if err != nil {
+			return size, parts, nil
+		}
+	}
+}
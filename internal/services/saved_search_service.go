@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SavedSearchService struct {
+	db     *database.MongoDB
+	search *SearchService
+}
+
+func NewSavedSearchService(db *database.MongoDB, search *SearchService) *SavedSearchService {
+	return &SavedSearchService{db: db, search: search}
+}
+
+func (s *SavedSearchService) Create(ctx context.Context, userID string, req *models.CreateSavedSearchRequest) (*models.SavedSearch, error) {
+	if _, err := ParseSearchQuery(req.Query); err != nil {
+		return nil, err
+	}
+	if _, err := parseSort(req.SortBy, req.SortOrder); err != nil {
+		return nil, err
+	}
+
+	saved := &models.SavedSearch{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		WorkspaceID: req.WorkspaceID,
+		Name:        req.Name,
+		Query:       req.Query,
+		SortBy:      req.SortBy,
+		SortOrder:   req.SortOrder,
+		Pinned:      req.Pinned,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	_, err := s.db.Collection("media_saved_searches").InsertOne(ctx, saved)
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (s *SavedSearchService) GetByID(ctx context.Context, searchID, userID string) (*models.SavedSearch, error) {
+	var saved models.SavedSearch
+	err := s.db.Collection("media_saved_searches").FindOne(ctx,
+		bson.M{"_id": searchID, "userId": userID},
+	).Decode(&saved)
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+func (s *SavedSearchService) List(ctx context.Context, userID string, pinnedOnly bool) ([]models.SavedSearch, error) {
+	filter := bson.M{"userId": userID}
+	if pinnedOnly {
+		filter["pinned"] = true
+	}
+
+	cursor, err := s.db.Collection("media_saved_searches").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "position", Value: 1}, {Key: "createdAt", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var searches []models.SavedSearch
+	if err := cursor.All(ctx, &searches); err != nil {
+		return nil, err
+	}
+	return searches, nil
+}
+
+func (s *SavedSearchService) Update(ctx context.Context, searchID, userID string, req *models.UpdateSavedSearchRequest) (*models.SavedSearch, error) {
+	update := bson.M{"updatedAt": time.Now()}
+	if req.Name != "" {
+		update["name"] = req.Name
+	}
+	if req.Query != "" {
+		if _, err := ParseSearchQuery(req.Query); err != nil {
+			return nil, err
+		}
+		update["query"] = req.Query
+	}
+	if req.SortBy != "" || req.SortOrder != "" {
+		if _, err := parseSort(req.SortBy, req.SortOrder); err != nil {
+			return nil, err
+		}
+	}
+	if req.SortBy != "" {
+		update["sortBy"] = req.SortBy
+	}
+	if req.SortOrder != "" {
+		update["sortOrder"] = req.SortOrder
+	}
+	if req.Pinned != nil {
+		update["pinned"] = *req.Pinned
+	}
+	if req.Position != nil {
+		update["position"] = *req.Position
+	}
+
+	result, err := s.db.Collection("media_saved_searches").UpdateOne(ctx,
+		bson.M{"_id": searchID, "userId": userID},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("saved search not found")
+	}
+	return s.GetByID(ctx, searchID, userID)
+}
+
+func (s *SavedSearchService) SetPinned(ctx context.Context, searchID, userID string, pinned bool) error {
+	result, err := s.db.Collection("media_saved_searches").UpdateOne(ctx,
+		bson.M{"_id": searchID, "userId": userID},
+		bson.M{"$set": bson.M{"pinned": pinned, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("saved search not found")
+	}
+	return nil
+}
+
+func (s *SavedSearchService) Delete(ctx context.Context, searchID, userID string) error {
+	_, err := s.db.Collection("media_saved_searches").DeleteOne(ctx,
+		bson.M{"_id": searchID, "userId": userID},
+	)
+	return err
+}
+
+// Run re-executes a saved search against the user's current library.
+func (s *SavedSearchService) Run(ctx context.Context, searchID, userID string, page, limit int) (*models.SearchResult, error) {
+	saved, err := s.GetByID(ctx, searchID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.search.Search(ctx, userID, savedSearchParams(saved, page, limit))
+	if err != nil {
+		return nil, err
+	}
+
+	_, _ = s.db.Collection("media_saved_searches").UpdateOne(ctx,
+		bson.M{"_id": searchID},
+		bson.M{"$set": bson.M{"lastRunAt": time.Now()}},
+	)
+	return result, nil
+}
+
+// ListSmartAlbums returns the user's pinned searches with their current size and cover.
+func (s *SavedSearchService) ListSmartAlbums(ctx context.Context, userID string) ([]models.SmartAlbum, error) {
+	pinned, err := s.List(ctx, userID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	albums := make([]models.SmartAlbum, 0, len(pinned))
+	for _, saved := range pinned {
+		album := models.SmartAlbum{SavedSearch: saved}
+		result, err := s.search.Search(ctx, userID, savedSearchParams(&saved, 0, 1))
+		if err == nil {
+			album.MediaCount = result.Total
+			if len(result.Media) > 0 {
+				album.CoverURL = result.Media[0].URL
+			}
+		}
+		albums = append(albums, album)
+	}
+	return albums, nil
+}
+
+func savedSearchParams(saved *models.SavedSearch, page, limit int) models.MediaSearchParams {
+	return models.MediaSearchParams{
+		Expr:        saved.Query,
+		WorkspaceID: saved.WorkspaceID,
+		SortBy:      saved.SortBy,
+		SortOrder:   saved.SortOrder,
+		Page:        page,
+		Limit:       limit,
+	}
+}
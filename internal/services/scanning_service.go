@@ -6,17 +6,22 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/events"
 	"github.com/quckapp/media-service/internal/models"
+	"github.com/quckapp/media-service/internal/realtime"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ScanningService struct {
-	db *database.MongoDB
+	db       *database.MongoDB
+	events   *events.Publisher
+	realtime *realtime.Hub
 }
 
-func NewScanningService(db *database.MongoDB) *ScanningService {
-	return &ScanningService{db: db}
+func NewScanningService(db *database.MongoDB, publisher *events.Publisher, hub *realtime.Hub) *ScanningService {
+	return &ScanningService{db: db, events: publisher, realtime: hub}
 }
 
 func (s *ScanningService) ScanMedia(ctx context.Context, req *models.ScanRequest) (*models.MediaScan, error) {
@@ -71,9 +76,38 @@ func (s *ScanningService) ListFlagged(ctx context.Context, limit int64) ([]model
 }
 
 func (s *ScanningService) UpdateStatus(ctx context.Context, scanID, status string) error {
-	_, err := s.db.Collection("media_scans").UpdateOne(ctx,
-		bson.M{"_id": scanID},
-		bson.M{"$set": bson.M{"status": status}},
-	)
-	return err
+	var scan models.MediaScan
+	var media *models.Media
+	err := s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		err := s.db.Collection("media_scans").FindOneAndUpdate(ctx,
+			bson.M{"_id": scanID},
+			bson.M{"$set": bson.M{"status": status}},
+		).Decode(&scan)
+		if err != nil {
+			return err
+		}
+		media = mediaTarget(ctx, s.db, scan.MediaID)
+
+		// Publish only on the transition so repeated updates don't re-alert
+		if status != "flagged" || scan.Status == "flagged" {
+			return nil
+		}
+		return s.events.Enqueue(ctx, events.ScanFlagged, media.Metadata["workspaceId"], scan.MediaID, events.ScanFlaggedData{
+			ScanID:     scan.ID,
+			MediaID:    scan.MediaID,
+			ScanType:   scan.ScanType,
+			Confidence: scan.Confidence,
+			Details:    scan.Details,
+		})
+	})
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	scan.Status = status
+	s.realtime.Publish(ctx, realtime.ScanUpdated, realtimeScope(media), &scan)
+	return nil
 }
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// InvalidParamError reports a query parameter the caller must fix (HTTP 400).
+type InvalidParamError struct {
+	Param   string `json:"param"`
+	Message string `json:"message"`
+}
+
+func (e *InvalidParamError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Param, e.Message)
+}
+
+const facetLimit = 50
+
+var sizeFacetBoundaries = bson.A{int64(0), int64(1 << 20), int64(10 << 20), int64(100 << 20), int64(1 << 30)}
+
+var sizeFacetLabels = map[string]string{
+	"0":         "< 1 MB",
+	"1048576":   "1–10 MB",
+	"10485760":  "10–100 MB",
+	"104857600": "100 MB–1 GB",
+	"1GB+":      "≥ 1 GB",
+}
+
+// Search only covers the caller's own media, so there is no uploader facet.
+var facetPipelines = map[string]bson.A{
+	"type": {
+		bson.M{"$group": bson.M{"_id": "$type", "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.M{"count": -1}},
+	},
+	"workspace": {
+		bson.M{"$match": bson.M{"metadata.workspaceId": bson.M{"$nin": bson.A{nil, ""}}}},
+		bson.M{"$group": bson.M{"_id": "$metadata.workspaceId", "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.M{"count": -1}},
+		bson.M{"$limit": facetLimit},
+	},
+	"month": {
+		bson.M{"$group": bson.M{
+			"_id":   bson.M{"$dateToString": bson.M{"format": "%Y-%m", "date": "$createdAt"}},
+			"count": bson.M{"$sum": 1},
+		}},
+		bson.M{"$sort": bson.M{"_id": -1}},
+	},
+	"size": {
+		bson.M{"$bucket": bson.M{
+			"groupBy":    "$size",
+			"boundaries": sizeFacetBoundaries,
+			"default":    "1GB+",
+			"output":     bson.M{"count": bson.M{"$sum": 1}},
+		}},
+	},
+	"tag": {
+		bson.M{"$lookup": bson.M{
+			"from":         "media_tag_mappings",
+			"localField":   "_id",
+			"foreignField": "mediaId",
+			"as":           "tagMappings",
+		}},
+		bson.M{"$unwind": "$tagMappings"},
+		bson.M{"$group": bson.M{"_id": "$tagMappings.tagId", "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.M{"count": -1}},
+		bson.M{"$limit": facetLimit},
+	},
+}
+
+func parseFacets(spec string) ([]string, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := facetPipelines[name]; !ok {
+			return nil, &InvalidParamError{Param: "facets", Message: fmt.Sprintf("unknown facet %q", name)}
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// computeFacets runs a single $facet aggregation over the search filter.
+func (s *SearchService) computeFacets(ctx context.Context, filter bson.M, names []string) (map[string][]models.FacetBucket, error) {
+	stage := bson.M{}
+	for _, name := range names {
+		stage[name] = facetPipelines[name]
+	}
+
+	cursor, err := s.db.Collection("media").Aggregate(ctx, bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$facet": stage},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	raw := map[string][]struct {
+		ID    interface{} `bson:"_id"`
+		Count int64       `bson:"count"`
+	}{}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	facets := make(map[string][]models.FacetBucket, len(names))
+	for _, name := range names {
+		buckets := make([]models.FacetBucket, 0, len(raw[name]))
+		for _, r := range raw[name] {
+			value := ""
+			if r.ID != nil {
+				value = fmt.Sprint(r.ID)
+			}
+			bucket := models.FacetBucket{Value: value, Count: r.Count}
+			if name == "size" {
+				bucket.Label = sizeFacetLabels[value]
+			}
+			buckets = append(buckets, bucket)
+		}
+		facets[name] = buckets
+	}
+
+	if tags, ok := facets["tag"]; ok && len(tags) > 0 {
+		s.labelTagFacet(ctx, tags)
+	}
+	return facets, nil
+}
+
+func (s *SearchService) labelTagFacet(ctx context.Context, buckets []models.FacetBucket) {
+	ids := make([]string, len(buckets))
+	for i, b := range buckets {
+		ids[i] = b.Value
+	}
+
+	cursor, err := s.db.Collection("media_tags").Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return
+	}
+	var tags []models.MediaTag
+	if err := cursor.All(ctx, &tags); err != nil {
+		return
+	}
+
+	names := make(map[string]string, len(tags))
+	for _, t := range tags {
+		names[t.ID] = t.Name
+	}
+	for i := range buckets {
+		buckets[i].Label = names[buckets[i].Value]
+	}
+}
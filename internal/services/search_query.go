@@ -0,0 +1,429 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// QueryError reports a search query that could not be parsed or compiled.
+// Position is the byte offset of the offending token in the original query.
+type QueryError struct {
+	Position int    `json:"position"`
+	Token    string `json:"token"`
+	Message  string `json:"message"`
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("invalid search query at position %d (%q): %s", e.Position, e.Token, e.Message)
+}
+
+// QueryTerm is a single `field:value` filter or free-text word of a search query.
+type QueryTerm struct {
+	Field  string // empty for free text
+	Value  string
+	Negate bool
+	Pos    int
+	Raw    string
+}
+
+type SearchQuery struct {
+	Terms []QueryTerm
+}
+
+var queryFields = map[string]bool{
+	"type":      true,
+	"tag":       true,
+	"size":      true,
+	"taken":     true,
+	"created":   true,
+	"ext":       true,
+	"mime":      true,
+	"name":      true,
+	"workspace": true,
+	"channel":   true,
+	"album":     true,
+}
+
+// ParseSearchQuery tokenizes a query such as
+// `type:image tag:design size:>5MB taken:2025-01..2025-06 "logo"`.
+func ParseSearchQuery(input string) (*SearchQuery, error) {
+	for i, r := range input {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(input[i:]); size == 1 {
+				return nil, &QueryError{Position: i, Token: input[i : i+1], Message: "invalid UTF-8"}
+			}
+		}
+	}
+
+	q := &SearchQuery{}
+	i := 0
+	for i < len(input) {
+		if space, size := spaceAt(input, i); space {
+			i += size
+			continue
+		}
+
+		start := i
+		term := QueryTerm{Pos: start}
+		if input[i] == '-' && i+1 < len(input) && !startsSpace(input, i+1) {
+			term.Negate = true
+			i++
+		}
+
+		// Bare quoted phrase
+		if input[i] == '"' {
+			value, next, err := readQuoted(input, i)
+			if err != nil {
+				return nil, err
+			}
+			term.Value = value
+			term.Raw = input[start:next]
+			i = next
+			if term.Value == "" {
+				return nil, &QueryError{Position: start, Token: term.Raw, Message: "empty phrase"}
+			}
+			q.Terms = append(q.Terms, term)
+			continue
+		}
+
+		wordStart := i
+		for i < len(input) && input[i] != ':' && input[i] != '"' {
+			space, size := spaceAt(input, i)
+			if space {
+				break
+			}
+			i += size
+		}
+		word := input[wordStart:i]
+
+		if i < len(input) && input[i] == ':' {
+			field := strings.ToLower(word)
+			if !queryFields[field] {
+				return nil, &QueryError{Position: wordStart, Token: word, Message: "unknown field"}
+			}
+			i++
+			term.Field = field
+			if i < len(input) && input[i] == '"' {
+				value, next, err := readQuoted(input, i)
+				if err != nil {
+					return nil, err
+				}
+				term.Value = value
+				i = next
+			} else {
+				valueStart := i
+				for i < len(input) {
+					space, size := spaceAt(input, i)
+					if space {
+						break
+					}
+					i += size
+				}
+				term.Value = input[valueStart:i]
+			}
+			term.Raw = input[start:i]
+			if term.Value == "" {
+				return nil, &QueryError{Position: start, Token: term.Raw, Message: "missing value for " + field}
+			}
+		} else {
+			if i < len(input) && input[i] == '"' {
+				return nil, &QueryError{Position: i, Token: input[start : i+1], Message: "unexpected quote"}
+			}
+			term.Value = word
+			term.Raw = input[start:i]
+		}
+
+		q.Terms = append(q.Terms, term)
+	}
+	return q, nil
+}
+
+// spaceAt reports whether the rune starting at input[i] is whitespace,
+// and its width in bytes.
+func spaceAt(input string, i int) (bool, int) {
+	r, size := utf8.DecodeRuneInString(input[i:])
+	return unicode.IsSpace(r), size
+}
+
+func startsSpace(input string, i int) bool {
+	space, _ := spaceAt(input, i)
+	return space
+}
+
+func readQuoted(input string, open int) (string, int, error) {
+	end := strings.IndexByte(input[open+1:], '"')
+	if end < 0 {
+		return "", 0, &QueryError{Position: open, Token: input[open:], Message: "unterminated quote"}
+	}
+	return input[open+1 : open+1+end], open + end + 2, nil
+}
+
+// compileQuery turns a parsed query into Mongo filter clauses. Tags and albums
+// are resolved against the requesting user's data.
+func (s *SearchService) compileQuery(ctx context.Context, userID string, q *SearchQuery) ([]bson.M, error) {
+	clauses := make([]bson.M, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		clause, err := s.compileTerm(ctx, userID, term)
+		if err != nil {
+			return nil, err
+		}
+		if term.Negate {
+			clause = bson.M{"$nor": bson.A{clause}}
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+func (s *SearchService) compileTerm(ctx context.Context, userID string, term QueryTerm) (bson.M, error) {
+	invalid := func(msg string) error {
+		return &QueryError{Position: term.Pos, Token: term.Raw, Message: msg}
+	}
+
+	switch term.Field {
+	case "":
+		return containsFilename(term.Value), nil
+	case "name":
+		return containsFilename(term.Value), nil
+	case "type":
+		t := strings.ToLower(term.Value)
+		switch t {
+		case "image", "video", "audio", "document":
+			return bson.M{"type": t}, nil
+		}
+		return nil, invalid("type must be one of image, video, audio, document")
+	case "ext":
+		ext := strings.TrimPrefix(strings.ToLower(term.Value), ".")
+		return bson.M{"filename": primitive.Regex{Pattern: `\.` + regexp.QuoteMeta(ext) + `$`, Options: "i"}}, nil
+	case "mime":
+		mime := strings.ToLower(term.Value)
+		if strings.HasSuffix(mime, "/*") {
+			return bson.M{"mimeType": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(strings.TrimSuffix(mime, "*")), Options: "i"}}, nil
+		}
+		return bson.M{"mimeType": mime}, nil
+	case "workspace":
+		return bson.M{"metadata.workspaceId": term.Value}, nil
+	case "channel":
+		return bson.M{"metadata.channelId": term.Value}, nil
+	case "size":
+		cond, err := compileRange(term.Value, parseSize)
+		if err != nil {
+			return nil, invalid(err.Error())
+		}
+		return bson.M{"size": cond}, nil
+	case "taken", "created":
+		cond, err := compileDateRange(term.Value)
+		if err != nil {
+			return nil, invalid(err.Error())
+		}
+		field := "createdAt"
+		if term.Field == "taken" {
+			field = "takenAt"
+		}
+		return bson.M{field: cond}, nil
+	case "tag":
+		ids, err := s.mediaIDsForTag(ctx, userID, term.Value)
+		if err != nil {
+			return nil, err
+		}
+		if ids == nil {
+			return nil, invalid("unknown tag")
+		}
+		return bson.M{"_id": bson.M{"$in": ids}}, nil
+	case "album":
+		var album models.MediaAlbum
+		err := s.db.Collection("media_albums").FindOne(ctx, bson.M{"_id": term.Value}).Decode(&album)
+		if err != nil {
+			return nil, invalid("unknown album")
+		}
+		return bson.M{"_id": bson.M{"$in": album.MediaIDs}}, nil
+	}
+	return nil, invalid("unknown field")
+}
+
+// mediaIDsForTag returns nil when no tag with the given name exists for the user.
+func (s *SearchService) mediaIDsForTag(ctx context.Context, userID, name string) ([]string, error) {
+	cursor, err := s.db.Collection("media_tags").Find(ctx, bson.M{
+		"userId": userID,
+		"name":   primitive.Regex{Pattern: "^" + regexp.QuoteMeta(name) + "$", Options: "i"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var tags []models.MediaTag
+	if err := cursor.All(ctx, &tags); err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	tagIDs := make([]string, len(tags))
+	for i, t := range tags {
+		tagIDs[i] = t.ID
+	}
+
+	mappingCursor, err := s.db.Collection("media_tag_mappings").Find(ctx, bson.M{"tagId": bson.M{"$in": tagIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var mappings []models.MediaTagMapping
+	if err := mappingCursor.All(ctx, &mappings); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(mappings))
+	for _, m := range mappings {
+		ids = append(ids, m.MediaID)
+	}
+	return ids, nil
+}
+
+func containsFilename(text string) bson.M {
+	return bson.M{"filename": primitive.Regex{Pattern: regexp.QuoteMeta(text), Options: "i"}}
+}
+
+// compileRange handles `5MB`, `>5MB`, `<=1GB` and `1MB..10MB` (either bound may be omitted).
+func compileRange(value string, parse func(string) (int64, error)) (bson.M, error) {
+	if lo, hi, ok := strings.Cut(value, ".."); ok {
+		cond := bson.M{}
+		if lo != "" {
+			v, err := parse(lo)
+			if err != nil {
+				return nil, err
+			}
+			cond["$gte"] = v
+		}
+		if hi != "" {
+			v, err := parse(hi)
+			if err != nil {
+				return nil, err
+			}
+			cond["$lte"] = v
+		}
+		if len(cond) == 0 {
+			return nil, fmt.Errorf("range needs at least one bound")
+		}
+		return cond, nil
+	}
+
+	op, rest := splitOperator(value)
+	v, err := parse(rest)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{op: v}, nil
+}
+
+// compileDateRange handles `2025`, `2025-01`, `2025-01-15`, comparisons and
+// `2025-01..2025-06`. Each date covers its whole period, so `..2025-06` includes June.
+func compileDateRange(value string) (bson.M, error) {
+	if lo, hi, ok := strings.Cut(value, ".."); ok {
+		cond := bson.M{}
+		if lo != "" {
+			start, _, err := parsePeriod(lo)
+			if err != nil {
+				return nil, err
+			}
+			cond["$gte"] = start
+		}
+		if hi != "" {
+			_, end, err := parsePeriod(hi)
+			if err != nil {
+				return nil, err
+			}
+			cond["$lt"] = end
+		}
+		if len(cond) == 0 {
+			return nil, fmt.Errorf("range needs at least one bound")
+		}
+		return cond, nil
+	}
+
+	op, rest := splitOperator(value)
+	start, end, err := parsePeriod(rest)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "$gt":
+		return bson.M{"$gte": end}, nil
+	case "$gte":
+		return bson.M{"$gte": start}, nil
+	case "$lt":
+		return bson.M{"$lt": start}, nil
+	case "$lte":
+		return bson.M{"$lt": end}, nil
+	default:
+		return bson.M{"$gte": start, "$lt": end}, nil
+	}
+}
+
+func splitOperator(value string) (string, string) {
+	switch {
+	case strings.HasPrefix(value, ">="):
+		return "$gte", value[2:]
+	case strings.HasPrefix(value, "<="):
+		return "$lte", value[2:]
+	case strings.HasPrefix(value, ">"):
+		return "$gt", value[1:]
+	case strings.HasPrefix(value, "<"):
+		return "$lt", value[1:]
+	case strings.HasPrefix(value, "="):
+		return "$eq", value[1:]
+	}
+	return "$eq", value
+}
+
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+func parseSize(value string) (int64, error) {
+	upper := strings.ToUpper(value)
+	factor := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(upper, u.suffix) {
+			factor = u.factor
+			upper = strings.TrimSuffix(upper, u.suffix)
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(upper, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use e.g. 500KB, 5MB, 1.5GB)", value)
+	}
+	return int64(n * float64(factor)), nil
+}
+
+// parsePeriod returns the half-open interval [start, end) covered by a year,
+// month or day in UTC.
+func parsePeriod(value string) (time.Time, time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+	if t, err := time.Parse("2006-01", value); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	}
+	if t, err := time.Parse("2006", value); err == nil {
+		return t, t.AddDate(1, 0, 0), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q (use YYYY, YYYY-MM or YYYY-MM-DD)", value)
+}
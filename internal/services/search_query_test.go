@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []QueryTerm
+	}{
+		{"empty", "  ", nil},
+		{"free text", "logo draft", []QueryTerm{
+			{Value: "logo", Pos: 0, Raw: "logo"},
+			{Value: "draft", Pos: 5, Raw: "draft"},
+		}},
+		{"fields", "type:image Size:>5MB taken:2025-01..2025-06", []QueryTerm{
+			{Field: "type", Value: "image", Pos: 0, Raw: "type:image"},
+			{Field: "size", Value: ">5MB", Pos: 11, Raw: "Size:>5MB"},
+			{Field: "taken", Value: "2025-01..2025-06", Pos: 21, Raw: "taken:2025-01..2025-06"},
+		}},
+		{"negation", "-tag:draft - logo", []QueryTerm{
+			{Field: "tag", Value: "draft", Negate: true, Pos: 0, Raw: "-tag:draft"},
+			{Value: "-", Pos: 11, Raw: "-"},
+			{Value: "logo", Pos: 13, Raw: "logo"},
+		}},
+		{"phrases", `"brand logo" name:"q1 deck" -"old"`, []QueryTerm{
+			{Value: "brand logo", Pos: 0, Raw: `"brand logo"`},
+			{Field: "name", Value: "q1 deck", Pos: 13, Raw: `name:"q1 deck"`},
+			{Value: "old", Negate: true, Pos: 28, Raw: `-"old"`},
+		}},
+		{"multibyte words", "voilà tag:Åland", []QueryTerm{
+			{Value: "voilà", Pos: 0, Raw: "voilà"},
+			{Field: "tag", Value: "Åland", Pos: 7, Raw: "tag:Åland"},
+		}},
+		{"unicode spaces", "logo\u00a0draft\u2003tag:x", []QueryTerm{
+			{Value: "logo", Pos: 0, Raw: "logo"},
+			{Value: "draft", Pos: 6, Raw: "draft"},
+			{Field: "tag", Value: "x", Pos: 14, Raw: "tag:x"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := ParseSearchQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseSearchQuery(%q): %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(q.Terms, tt.want) {
+				t.Errorf("ParseSearchQuery(%q) =\n%+v\nwant\n%+v", tt.input, q.Terms, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		position int
+		message  string
+	}{
+		{"unknown field", "logo color:red", 5, "unknown field"},
+		{"missing value", "type: logo", 0, "missing value for type"},
+		{"empty phrase", `logo ""`, 5, "empty phrase"},
+		{"unterminated quote", `name:"logo`, 5, "unterminated quote"},
+		{"unexpected quote", `lo"go"`, 2, "unexpected quote"},
+		{"invalid UTF-8", "logo \xc3 draft", 5, "invalid UTF-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSearchQuery(tt.input)
+			var qerr *QueryError
+			if !errors.As(err, &qerr) {
+				t.Fatalf("ParseSearchQuery(%q) error = %v, want a QueryError", tt.input, err)
+			}
+			if qerr.Position != tt.position || qerr.Message != tt.message {
+				t.Errorf("got %q at %d, want %q at %d", qerr.Message, qerr.Position, tt.message, tt.position)
+			}
+		})
+	}
+}
@@ -20,7 +20,7 @@ func NewSearchService(db *database.MongoDB, storage *S3Storage) *SearchService {
 	return &SearchService{db: db, storage: storage}
 }
 
-func (s *SearchService) Search(ctx context.Context, userID string, params models.MediaSearchParams) ([]models.Media, int64, error) {
+func (s *SearchService) Search(ctx context.Context, userID string, params models.MediaSearchParams) (*models.SearchResult, error) {
 	if params.Limit <= 0 {
 		params.Limit = 20
 	}
@@ -28,6 +28,94 @@ func (s *SearchService) Search(ctx context.Context, userID string, params models
 		params.Page = 0
 	}
 
+	facetNames, err := parseFacets(params.Facets)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := s.buildFilter(ctx, userID, params)
+	if err != nil {
+		return nil, err
+	}
+
+	sort, err := parseSort(params.SortBy, params.SortOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.db.Collection("media").CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := int64(params.Page * params.Limit)
+	cursor, err := s.db.Collection("media").Find(ctx, filter,
+		options.Find().
+			SetSort(sort).
+			SetSkip(skip).
+			SetLimit(int64(params.Limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var media []models.Media
+	if err := cursor.All(ctx, &media); err != nil {
+		return nil, err
+	}
+
+	for i := range media {
+		media[i].URL, _ = s.storage.MediaURL(&media[i], time.Hour)
+	}
+
+	result := &models.SearchResult{Media: media, Total: total}
+	if len(facetNames) > 0 {
+		result.Facets, err = s.computeFacets(ctx, filter, facetNames)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// MatchingIDs returns the IDs of up to limit media matching params, in
+// the requested order, for operations on a whole result set.
+func (s *SearchService) MatchingIDs(ctx context.Context, userID string, params models.MediaSearchParams, limit int64) ([]string, error) {
+	filter, err := s.buildFilter(ctx, userID, params)
+	if err != nil {
+		return nil, err
+	}
+	sort, err := parseSort(params.SortBy, params.SortOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := s.db.Collection("media").Find(ctx, filter,
+		options.Find().
+			SetSort(sort).
+			SetLimit(limit).
+			SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var ids []string
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		ids = append(ids, doc.ID)
+	}
+	return ids, cursor.Err()
+}
+
+func (s *SearchService) buildFilter(ctx context.Context, userID string, params models.MediaSearchParams) (bson.M, error) {
 	filter := bson.M{"userId": userID}
 
 	if params.Type != "" {
@@ -67,43 +155,21 @@ func (s *SearchService) Search(ctx context.Context, userID string, params models
 		}
 	}
 
-	// Sorting
-	sortField := "createdAt"
-	sortOrder := -1
-	if params.SortBy != "" {
-		sortField = params.SortBy
-	}
-	if params.SortOrder == "asc" {
-		sortOrder = 1
-	}
-
-	total, err := s.db.Collection("media").CountDocuments(ctx, filter)
-	if err != nil {
-		return nil, 0, err
-	}
-
-	skip := int64(params.Page * params.Limit)
-	cursor, err := s.db.Collection("media").Find(ctx, filter,
-		options.Find().
-			SetSort(bson.M{sortField: sortOrder}).
-			SetSkip(skip).
-			SetLimit(int64(params.Limit)),
-	)
-	if err != nil {
-		return nil, 0, err
-	}
-	defer cursor.Close(ctx)
-
-	var media []models.Media
-	if err := cursor.All(ctx, &media); err != nil {
-		return nil, 0, err
-	}
-
-	for i := range media {
-		media[i].URL, _ = s.storage.GetPresignedDownloadURL(media[i].S3Key, time.Hour)
+	if params.Expr != "" {
+		query, err := ParseSearchQuery(params.Expr)
+		if err != nil {
+			return nil, err
+		}
+		clauses, err := s.compileQuery(ctx, userID, query)
+		if err != nil {
+			return nil, err
+		}
+		if len(clauses) > 0 {
+			filter["$and"] = clauses
+		}
 	}
 
-	return media, total, nil
+	return filter, nil
 }
 
 func (s *SearchService) GetWorkspaceStats(ctx context.Context, workspaceID string) (*models.WorkspaceMediaStats, error) {
@@ -172,6 +238,11 @@ func (s *SearchService) GetWorkspaceStats(ctx context.Context, workspaceID strin
 	)
 	stats.RecentUploads = recentCount
 
+	var quota models.StorageQuota
+	if err := s.db.Collection("storage_quotas").FindOne(ctx, bson.M{"workspaceId": workspaceID}).Decode(&quota); err == nil {
+		stats.StorageLimit = quota.MaxStorageMB << 20
+	}
+
 	return stats, nil
 }
 
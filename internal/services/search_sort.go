@@ -0,0 +1,71 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// sortableFields maps the public sort keys accepted by Search to document
+// fields. Each one is backed by a {userId, field} index created by
+// the migrations package.
+var sortableFields = map[string]string{
+	"createdAt": "createdAt",
+	"updatedAt": "updatedAt",
+	"size":      "size",
+	"filename":  "filename",
+	"takenAt":   "takenAt",
+	"viewCount": "viewCount",
+}
+
+const maxSortKeys = 3
+
+// parseSort accepts a comma-separated list such as `size,-createdAt`. A
+// leading `-` or `+` overrides sortOrder for that key.
+func parseSort(sortBy, sortOrder string) (bson.D, error) {
+	defaultDir := -1
+	switch strings.ToLower(sortOrder) {
+	case "", "desc":
+	case "asc":
+		defaultDir = 1
+	default:
+		return nil, &InvalidParamError{Param: "sortOrder", Message: "must be asc or desc"}
+	}
+
+	if sortBy == "" {
+		return bson.D{{Key: "createdAt", Value: defaultDir}, {Key: "_id", Value: defaultDir}}, nil
+	}
+
+	keys := strings.Split(sortBy, ",")
+	if len(keys) > maxSortKeys {
+		return nil, &InvalidParamError{Param: "sortBy", Message: fmt.Sprintf("at most %d sort keys are allowed", maxSortKeys)}
+	}
+
+	sort := bson.D{}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		dir := defaultDir
+		switch {
+		case strings.HasPrefix(key, "-"):
+			dir, key = -1, key[1:]
+		case strings.HasPrefix(key, "+"):
+			dir, key = 1, key[1:]
+		}
+
+		field, ok := sortableFields[key]
+		if !ok {
+			return nil, &InvalidParamError{Param: "sortBy", Message: fmt.Sprintf("unsupported sort field %q", key)}
+		}
+		if seen[field] {
+			continue
+		}
+		seen[field] = true
+		sort = append(sort, bson.E{Key: field, Value: dir})
+	}
+
+	// Stable pagination when sort values tie
+	sort = append(sort, bson.E{Key: "_id", Value: sort[len(sort)-1].Value})
+	return sort, nil
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Share link actions; views and downloads count against the link's limits.
+const (
+	ShareLinkInfo     = "info"
+	ShareLinkUnlock   = "unlock"
+	ShareLinkView     = "view"
+	ShareLinkDownload = "download"
+)
+
+// URLs handed to share link visitors are short-lived so a leaked one
+// can't outlive the link's limits for long.
+const shareLinkURLExpiry = 5 * time.Minute
+
+// sharedLinkPath is where share links are served, for preview URLs.
+const sharedLinkPath = "/api/v1/media/shared/"
+
+// Access tokens from UnlockShareLink last long enough to browse a shared
+// album without entering the password again.
+const shareLinkAccessExpiry = 30 * time.Minute
+
+var (
+	ErrShareLinkNotFound    = errors.New("share link not found")
+	ErrShareLinkExpired     = errors.New("share link has expired")
+	ErrShareLinkExhausted   = errors.New("share link has reached its limit")
+	ErrShareLinkPassword    = errors.New("share link password is missing or wrong")
+	ErrShareLinkNoDownloads = errors.New("share link does not allow downloads")
+)
+
+// openShareLink loads an active link and checks its expiry and password.
+// An access token from UnlockShareLink is accepted in place of the
+// password.
+func (s *SharingService) openShareLink(ctx context.Context, token, password string) (*models.MediaShareLink, error) {
+	var link models.MediaShareLink
+	err := s.db.Collection("media_share_links").FindOne(ctx, bson.M{"token": token, "isActive": true}).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrShareLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return &link, ErrShareLinkExpired
+	}
+	if link.PasswordHash != "" && !validShareLinkAccess(&link, password) &&
+		bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+		return &link, ErrShareLinkPassword
+	}
+	return &link, nil
+}
+
+// UnlockShareLink exchanges a link's password for an access token, for
+// browsers that can't send the password header when following a link. The
+// token never outlives the link.
+func (s *SharingService) UnlockShareLink(ctx context.Context, token, password string, info RequestInfo) (*models.ShareLinkAccessToken, error) {
+	link, err := s.openShareLink(ctx, token, password)
+	s.logShareLinkAccess(ctx, link, "", ShareLinkUnlock, err, info)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(shareLinkAccessExpiry).Truncate(time.Second)
+	if link.ExpiresAt != nil && link.ExpiresAt.Before(expiresAt) {
+		expiresAt = link.ExpiresAt.Truncate(time.Second)
+	}
+	return &models.ShareLinkAccessToken{AccessToken: shareLinkAccess(link, expiresAt), ExpiresAt: expiresAt}, nil
+}
+
+// shareLinkAccess signs the link and expiry with the link's password hash,
+// so every replica can check it and changing the password revokes it.
+func shareLinkAccess(link *models.MediaShareLink, expiresAt time.Time) string {
+	exp := strconv.FormatInt(expiresAt.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(link.PasswordHash))
+	mac.Write([]byte(link.ID + "." + exp))
+	return exp + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func validShareLinkAccess(link *models.MediaShareLink, token string) bool {
+	exp, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	unix, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() >= unix {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(shareLinkAccess(link, time.Unix(unix, 0))))
+}
+
+// consumeShareLink counts one view or download, failing if that would
+// exceed the link's limit. The check and increment are a single update so
+// concurrent visitors can't overshoot it.
+func (s *SharingService) consumeShareLink(ctx context.Context, link *models.MediaShareLink, action string) error {
+	counter, limit := "viewCount", link.MaxViews
+	if action == ShareLinkDownload {
+		counter, limit = "downloadCount", link.MaxDownloads
+	}
+	filter := bson.M{"_id": link.ID, "isActive": true}
+	if limit > 0 {
+		filter[counter] = bson.M{"$lt": limit}
+	}
+	res, err := s.db.Collection("media_share_links").UpdateOne(ctx, filter, bson.M{"$inc": bson.M{counter: 1}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrShareLinkExhausted
+	}
+	return nil
+}
+
+// shareLinkTarget is what a link points at. Links created before albums
+// and galleries could be shared have no target type.
+func shareLinkTarget(link *models.MediaShareLink) string {
+	if link.TargetType == "" {
+		return models.ShareTargetMedia
+	}
+	return link.TargetType
+}
+
+var shareLinkCollections = map[string]string{
+	models.ShareTargetAlbum:   "media_albums",
+	models.ShareTargetGallery: "media_galleries",
+}
+
+// sharedCollection holds the fields albums and galleries have in common.
+// Albums record their owner as userId, galleries as createdBy.
+type sharedCollection struct {
+	Name        string   `bson:"name"`
+	Description string   `bson:"description"`
+	MediaIDs    []string `bson:"mediaIds"`
+	WorkspaceID string   `bson:"workspaceId"`
+	UserID      string   `bson:"userId"`
+	CreatedBy   string   `bson:"createdBy"`
+}
+
+func (c *sharedCollection) owner() string {
+	if c.UserID != "" {
+		return c.UserID
+	}
+	return c.CreatedBy
+}
+
+func (s *SharingService) findCollection(ctx context.Context, targetType, targetID string) (*sharedCollection, error) {
+	name, ok := shareLinkCollections[targetType]
+	if !ok {
+		return nil, fmt.Errorf("unknown share target %q", targetType)
+	}
+	var coll sharedCollection
+	if err := s.db.Collection(name).FindOne(ctx, bson.M{"_id": targetID}).Decode(&coll); err != nil {
+		return nil, err
+	}
+	return &coll, nil
+}
+
+// CreateCollectionShareLink creates a link to an album or gallery for its
+// owner. The link serves whatever the collection holds when it is opened,
+// not a snapshot.
+func (s *SharingService) CreateCollectionShareLink(ctx context.Context, targetType, targetID, userID string, req *models.CreateShareLinkRequest) (*models.MediaShareLink, error) {
+	coll, err := s.findCollection(ctx, targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if coll.owner() != userID {
+		return nil, ErrForbidden
+	}
+
+	link, err := newShareLink(userID, req)
+	if err != nil {
+		return nil, err
+	}
+	link.TargetType = targetType
+	link.TargetID = targetID
+
+	if _, err := s.db.Collection("media_share_links").InsertOne(ctx, link); err != nil {
+		return nil, err
+	}
+
+	entry := s.shareLinkActivity(ctx, link, AuditShareLink)
+	entry.UserID = userID
+	entry.After = map[string]string{"linkId": link.ID, targetType + "Id": targetID}
+	if link.ExpiresAt != nil {
+		entry.After["expiresAt"] = link.ExpiresAt.Format(time.RFC3339)
+	}
+	s.audit.Record(ctx, entry)
+	return link, nil
+}
+
+func (s *SharingService) GetCollectionShareLinks(ctx context.Context, targetType, targetID, userID string) ([]models.MediaShareLink, error) {
+	cursor, err := s.db.Collection("media_share_links").Find(ctx,
+		bson.M{"targetType": targetType, "targetId": targetID, "createdBy": userID},
+		options.Find().SetSort(bson.M{"createdAt": -1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var links []models.MediaShareLink
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+	return links, nil
+}
+
+// shareLinkActivity starts an audit entry for a change to link. Collection
+// links are attributed to the collection's workspace.
+func (s *SharingService) shareLinkActivity(ctx context.Context, link *models.MediaShareLink, action string) *models.MediaActivity {
+	target := shareLinkTarget(link)
+	if target == models.ShareTargetMedia {
+		return mediaActivity(auditTarget(ctx, link.MediaID), action)
+	}
+	entry := &models.MediaActivity{Action: action, Details: target + " " + link.TargetID}
+	if coll, err := s.findCollection(ctx, target, link.TargetID); err == nil {
+		entry.WorkspaceID = coll.WorkspaceID
+	}
+	return entry
+}
+
+// GetSharedLink describes what a share link grants. For a media link this
+// doesn't count a view; an album or gallery listing does, since it hands
+// out a preview of every item.
+func (s *SharingService) GetSharedLink(ctx context.Context, token, password string, info RequestInfo) (*models.SharedLink, error) {
+	link, err := s.openShareLink(ctx, token, password)
+	if err != nil {
+		s.logShareLinkAccess(ctx, link, "", ShareLinkInfo, err, info)
+		return nil, err
+	}
+
+	out := &models.SharedLink{TargetType: shareLinkTarget(link)}
+	if out.TargetType == models.ShareTargetMedia {
+		media, err := s.shareLinkMedia(ctx, link.MediaID)
+		s.logShareLinkAccess(ctx, link, "", ShareLinkInfo, err, info)
+		if err != nil {
+			return nil, err
+		}
+		out.Media = &models.SharedLinkItem{
+			Filename: media.Filename,
+			MimeType: media.MimeType,
+			Type:     media.Type,
+			Size:     media.Size,
+		}
+	} else {
+		coll, err := s.shareLinkCollection(ctx, link)
+		if err == nil {
+			err = s.consumeShareLink(ctx, link, ShareLinkView)
+		}
+		s.logShareLinkAccess(ctx, link, "", ShareLinkView, err, info)
+		if err != nil {
+			return nil, err
+		}
+		link.ViewCount++
+
+		out.Name = coll.Name
+		out.Description = coll.Description
+		if out.Items, err = s.sharedLinkItems(ctx, link, coll.MediaIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	out.AllowDownload = link.AllowDownload
+	out.ExpiresAt = link.ExpiresAt
+	if link.MaxViews > 0 {
+		left := max(link.MaxViews-link.ViewCount, 0)
+		out.ViewsLeft = &left
+	}
+	if link.MaxDownloads > 0 {
+		left := max(link.MaxDownloads-link.DownloadCount, 0)
+		out.DownloadsLeft = &left
+	}
+	return out, nil
+}
+
+// sharedLinkItems lists a collection's media in its order, skipping items
+// that have since been deleted. There is no stored thumbnail rendition, so
+// images are previewed through a short-lived inline URL of the original,
+// or a rendered preview when the link doesn't allow downloads.
+func (s *SharingService) sharedLinkItems(ctx context.Context, link *models.MediaShareLink, mediaIDs []string) ([]models.SharedLinkItem, error) {
+	items := []models.SharedLinkItem{}
+	if len(mediaIDs) == 0 {
+		return items, nil
+	}
+	cursor, err := s.db.Collection("media").Find(ctx, bson.M{"_id": bson.M{"$in": mediaIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var found []models.Media
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*models.Media, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+
+	for _, id := range mediaIDs {
+		media, ok := byID[id]
+		if !ok {
+			continue
+		}
+		item := models.SharedLinkItem{
+			MediaID:  media.ID,
+			Filename: media.Filename,
+			MimeType: media.MimeType,
+			Type:     media.Type,
+			Size:     media.Size,
+		}
+		switch {
+		case media.Type != "image":
+		case !link.AllowDownload:
+			item.ThumbnailURL = sharedLinkPath + link.Token + "/items/" + media.ID + "/preview"
+		default:
+			url, err := s.storage.MediaContentURL(media, false, shareLinkURLExpiry)
+			if err != nil {
+				return nil, err
+			}
+			item.ThumbnailURL = url
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// OpenSharedLinkMedia returns a short-lived URL serving shared media inline
+// or as an attachment. Collection links name the item by mediaID; media
+// links ignore it. Every view and download counts against the link's
+// limits, including views of a collection's items.
+func (s *SharingService) OpenSharedLinkMedia(ctx context.Context, token, password, mediaID, action string, info RequestInfo) (string, error) {
+	link, err := s.openShareLink(ctx, token, password)
+	if err == nil && action == ShareLinkDownload && !link.AllowDownload {
+		err = ErrShareLinkNoDownloads
+	}
+	var media *models.Media
+	if err == nil {
+		media, err = s.shareLinkItem(ctx, link, mediaID)
+	}
+	if err == nil {
+		err = s.consumeShareLink(ctx, link, action)
+	}
+	s.logShareLinkAccess(ctx, link, mediaID, action, err, info)
+	if err != nil {
+		return "", err
+	}
+	return s.storage.MediaContentURL(media, action == ShareLinkDownload, shareLinkURLExpiry)
+}
+
+// OpenSharedLinkPreview renders the preview of an image in a shared album
+// or gallery that sharedLinkItems pointed to. Previews make up the listing,
+// which counted as the view, so they aren't counted or logged one by one.
+func (s *SharingService) OpenSharedLinkPreview(ctx context.Context, token, password, mediaID string) ([]byte, error) {
+	link, err := s.openShareLink(ctx, token, password)
+	if err != nil {
+		return nil, err
+	}
+	if shareLinkTarget(link) == models.ShareTargetMedia {
+		return nil, ErrShareLinkNotFound
+	}
+	media, err := s.shareLinkItem(ctx, link, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if media.Type != "image" {
+		return nil, ErrPreviewUnsupported
+	}
+
+	body, err := s.storage.OpenMedia(ctx, media)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return renderPreview(body)
+}
+
+// shareLinkItem resolves the media a request on link is for. An item of a
+// collection must be in it now, so removing media from an album also
+// withdraws it from the album's links.
+func (s *SharingService) shareLinkItem(ctx context.Context, link *models.MediaShareLink, mediaID string) (*models.Media, error) {
+	if shareLinkTarget(link) == models.ShareTargetMedia {
+		if mediaID != "" && mediaID != link.MediaID {
+			return nil, ErrShareLinkNotFound
+		}
+		return s.shareLinkMedia(ctx, link.MediaID)
+	}
+	coll, err := s.shareLinkCollection(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	if !contains(coll.MediaIDs, mediaID) {
+		return nil, ErrShareLinkNotFound
+	}
+	return s.shareLinkMedia(ctx, mediaID)
+}
+
+func (s *SharingService) shareLinkCollection(ctx context.Context, link *models.MediaShareLink) (*sharedCollection, error) {
+	coll, err := s.findCollection(ctx, shareLinkTarget(link), link.TargetID)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrShareLinkNotFound
+	}
+	return coll, err
+}
+
+func (s *SharingService) shareLinkMedia(ctx context.Context, mediaID string) (*models.Media, error) {
+	var media models.Media
+	err := s.db.Collection("media").FindOne(ctx, bson.M{"_id": mediaID}).Decode(&media)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrShareLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// logShareLinkAccess records an attempt on a link that exists, whether it
+// was granted or not, against the media it was for if known. Unknown
+// tokens aren't logged.
+func (s *SharingService) logShareLinkAccess(ctx context.Context, link *models.MediaShareLink, mediaID, action string, cause error, info RequestInfo) {
+	if link == nil {
+		return
+	}
+	if mediaID == "" {
+		mediaID = link.MediaID
+	}
+	outcome := "granted"
+	switch {
+	case errors.Is(cause, ErrShareLinkExpired):
+		outcome = "expired"
+	case errors.Is(cause, ErrShareLinkExhausted):
+		outcome = "limit_reached"
+	case errors.Is(cause, ErrShareLinkPassword):
+		outcome = "bad_password"
+	case errors.Is(cause, ErrShareLinkNoDownloads):
+		outcome = "download_denied"
+	case errors.Is(cause, ErrShareLinkNotFound):
+		outcome = "media_missing"
+	case cause != nil:
+		outcome = "error"
+	}
+	_, err := s.db.Collection("share_link_access").InsertOne(context.WithoutCancel(ctx), &models.ShareLinkAccess{
+		ID:        uuid.New().String(),
+		LinkID:    link.ID,
+		MediaID:   mediaID,
+		Action:    action,
+		Outcome:   outcome,
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+		At:        time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to log access to share link %s: %v", link.ID, err)
+	}
+}
+
+// GetShareLinkAccessLog lists attempts on a link, newest first, for its
+// creator.
+func (s *SharingService) GetShareLinkAccessLog(ctx context.Context, linkID, userID string, limit int64) ([]models.ShareLinkAccess, error) {
+	var link models.MediaShareLink
+	err := s.db.Collection("media_share_links").FindOne(ctx, bson.M{"_id": linkID}).Decode(&link)
+	if err != nil {
+		return nil, err
+	}
+	if link.CreatedBy != userID {
+		return nil, ErrForbidden
+	}
+
+	cursor, err := s.db.Collection("share_link_access").Find(ctx,
+		bson.M{"linkId": linkID},
+		options.Find().SetSort(bson.M{"at": -1}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []models.ShareLinkAccess
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -4,24 +4,34 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/events"
 	"github.com/quckapp/media-service/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type SharingService struct {
-	db *database.MongoDB
+	db      *database.MongoDB
+	storage *S3Storage
+	audit   *Auditor
+	events  *events.Publisher
 }
 
-func NewSharingService(db *database.MongoDB) *SharingService {
-	return &SharingService{db: db}
+func NewSharingService(db *database.MongoDB, storage *S3Storage, audit *Auditor, publisher *events.Publisher) *SharingService {
+	return &SharingService{db: db, storage: storage, audit: audit, events: publisher}
 }
 
 func (s *SharingService) ShareWithUser(ctx context.Context, userID string, req *models.ShareMediaRequest) (*models.MediaShare, error) {
+	if req.SharedWith == userID {
+		return nil, fmt.Errorf("cannot share media with yourself")
+	}
 	share := &models.MediaShare{
 		ID:         uuid.New().String(),
 		MediaID:    req.MediaID,
@@ -36,16 +46,36 @@ func (s *SharingService) ShareWithUser(ctx context.Context, userID string, req *
 		share.ExpiresAt = &exp
 	}
 
-	_, err := s.db.Collection("media_shares").InsertOne(ctx, share)
+	target := mediaTarget(ctx, s.db, share.MediaID)
+	err := s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.db.Collection("media_shares").InsertOne(ctx, share); err != nil {
+			return err
+		}
+		return s.events.Enqueue(ctx, events.MediaShared, target.Metadata["workspaceId"], share.MediaID, events.MediaSharedData{
+			MediaID:    share.MediaID,
+			SharedBy:   userID,
+			SharedWith: share.SharedWith,
+			Permission: share.Permission,
+			ExpiresAt:  share.ExpiresAt,
+		})
+	})
 	if err != nil {
 		return nil, err
 	}
+
+	entry := mediaActivity(target, AuditShare)
+	entry.UserID = userID
+	entry.After = map[string]string{"shareId": share.ID, "sharedWith": share.SharedWith, "permission": share.Permission}
+	if share.ExpiresAt != nil {
+		entry.After["expiresAt"] = share.ExpiresAt.Format(time.RFC3339)
+	}
+	s.audit.Record(ctx, entry)
 	return share, nil
 }
 
 func (s *SharingService) GetSharedWithUser(ctx context.Context, userID string, limit int64) ([]models.MediaShare, error) {
 	cursor, err := s.db.Collection("media_shares").Find(ctx,
-		bson.M{"sharedWith": userID},
+		activeShares(bson.M{"sharedWith": userID}),
 		options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(limit),
 	)
 	if err != nil {
@@ -60,6 +90,35 @@ func (s *SharingService) GetSharedWithUser(ctx context.Context, userID string, l
 	return shares, nil
 }
 
+// GetSharedMedia resolves the caller's unexpired shares to the media they
+// grant access to, skipping media that has since been deleted.
+func (s *SharingService) GetSharedMedia(ctx context.Context, userID string, limit int64) ([]models.SharedMedia, error) {
+	cursor, err := s.db.Collection("media_shares").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: activeShares(bson.M{"sharedWith": userID})}},
+		{{Key: "$sort", Value: bson.M{"createdAt": -1}}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$lookup", Value: bson.M{"from": "media", "localField": "mediaId", "foreignField": "_id", "as": "media"}}},
+		{{Key: "$unwind", Value: "$media"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		models.MediaShare `bson:",inline"`
+		Media             models.Media `bson:"media"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	items := make([]models.SharedMedia, len(rows))
+	for i, row := range rows {
+		items[i] = models.SharedMedia{Share: row.MediaShare, Media: row.Media}
+	}
+	return items, nil
+}
+
 func (s *SharingService) GetSharedByUser(ctx context.Context, userID string, limit int64) ([]models.MediaShare, error) {
 	cursor, err := s.db.Collection("media_shares").Find(ctx,
 		bson.M{"sharedBy": userID},
@@ -78,61 +137,103 @@ func (s *SharingService) GetSharedByUser(ctx context.Context, userID string, lim
 }
 
 func (s *SharingService) RevokeShare(ctx context.Context, shareID, userID string) error {
-	_, err := s.db.Collection("media_shares").DeleteOne(ctx,
+	var share models.MediaShare
+	err := s.db.Collection("media_shares").FindOneAndDelete(ctx,
 		bson.M{"_id": shareID, "sharedBy": userID},
-	)
-	return err
+	).Decode(&share)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	entry := mediaActivity(auditTarget(ctx, share.MediaID), AuditUnshare)
+	entry.UserID = userID
+	entry.Before = map[string]string{"shareId": share.ID, "sharedWith": share.SharedWith, "permission": share.Permission}
+	s.audit.Record(ctx, entry)
+	return nil
 }
 
 func (s *SharingService) CreateShareLink(ctx context.Context, mediaID, userID string, req *models.CreateShareLinkRequest) (*models.MediaShareLink, error) {
-	token := generateToken(32)
+	link, err := newShareLink(userID, req)
+	if err != nil {
+		return nil, err
+	}
+	link.MediaID = mediaID
 
+	target := mediaTarget(ctx, s.db, mediaID)
+	err = s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.db.Collection("media_share_links").InsertOne(ctx, link); err != nil {
+			return err
+		}
+		return s.events.Enqueue(ctx, events.MediaShared, target.Metadata["workspaceId"], mediaID, events.MediaSharedData{
+			MediaID:   mediaID,
+			SharedBy:  userID,
+			LinkID:    link.ID,
+			ExpiresAt: link.ExpiresAt,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entry := mediaActivity(target, AuditShareLink)
+	entry.UserID = userID
+	entry.After = map[string]string{"linkId": link.ID}
+	if link.ExpiresAt != nil {
+		entry.After["expiresAt"] = link.ExpiresAt.Format(time.RFC3339)
+	}
+	s.audit.Record(ctx, entry)
+	return link, nil
+}
+
+func newShareLink(userID string, req *models.CreateShareLinkRequest) (*models.MediaShareLink, error) {
 	link := &models.MediaShareLink{
-		ID:        uuid.New().String(),
-		MediaID:   mediaID,
-		CreatedBy: userID,
-		Token:     token,
-		IsActive:  true,
-		ViewCount: 0,
-		CreatedAt: time.Now(),
+		ID:            uuid.New().String(),
+		CreatedBy:     userID,
+		Token:         generateToken(32),
+		IsActive:      true,
+		MaxViews:      req.MaxViews,
+		MaxDownloads:  req.MaxDownloads,
+		AllowDownload: req.AllowDownload == nil || *req.AllowDownload,
+		CreatedAt:     time.Now(),
 	}
 
 	if req.ExpiresIn > 0 {
 		exp := time.Now().Add(time.Duration(req.ExpiresIn) * time.Hour)
 		link.ExpiresAt = &exp
 	}
-
-	_, err := s.db.Collection("media_share_links").InsertOne(ctx, link)
-	if err != nil {
-		return nil, err
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		link.PasswordHash = string(hash)
+		link.HasPassword = true
 	}
 	return link, nil
 }
 
-func (s *SharingService) GetShareLink(ctx context.Context, token string) (*models.MediaShareLink, error) {
+func (s *SharingService) DeactivateShareLink(ctx context.Context, linkID, userID string) error {
 	var link models.MediaShareLink
-	err := s.db.Collection("media_share_links").FindOne(ctx,
-		bson.M{"token": token, "isActive": true},
+	err := s.db.Collection("media_share_links").FindOneAndUpdate(ctx,
+		bson.M{"_id": linkID, "createdBy": userID, "isActive": true},
+		bson.M{"$set": bson.M{"isActive": false}},
 	).Decode(&link)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Increment view count
-	_, _ = s.db.Collection("media_share_links").UpdateOne(ctx,
-		bson.M{"_id": link.ID},
-		bson.M{"$inc": bson.M{"viewCount": 1}},
-	)
-
-	return &link, nil
-}
-
-func (s *SharingService) DeactivateShareLink(ctx context.Context, linkID, userID string) error {
-	_, err := s.db.Collection("media_share_links").UpdateOne(ctx,
-		bson.M{"_id": linkID, "createdBy": userID},
-		bson.M{"$set": bson.M{"isActive": false}},
-	)
-	return err
+	entry := s.shareLinkActivity(ctx, &link, AuditShareLinkOff)
+	entry.UserID = userID
+	entry.Before = map[string]string{"linkId": link.ID, "isActive": "true"}
+	entry.After = map[string]string{"linkId": link.ID, "isActive": "false"}
+	s.audit.Record(ctx, entry)
+	return nil
 }
 
 func (s *SharingService) GetShareLinks(ctx context.Context, mediaID, userID string) ([]models.MediaShareLink, error) {
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/models"
+)
+
+// Storage event reasons.
+const (
+	StorageCreate        = "create"
+	StorageCopy          = "copy"
+	StorageDelete        = "delete"
+	StorageMoveIn        = "move_in"
+	StorageMoveOut       = "move_out"
+	StorageVersionCreate = "version_create"
+	StorageVersionDelete = "version_delete"
+	StorageRestore       = "restore"
+	StorageReassignOut   = "reassign_out"
+	StorageReassignIn    = "reassign_in"
+)
+
+const defaultStorageClass = "standard"
+
+func storageClassOf(media *models.Media) string {
+	if media.StorageClass == "" {
+		return defaultStorageClass
+	}
+	return media.StorageClass
+}
+
+// recordStorageEvent appends to the storage_events ledger used for
+// chargeback. Bytes are charged while the object exists, so trashed media
+// keep accruing until they are permanently deleted. Failures are logged
+// rather than failing the operation that already happened.
+func recordStorageEvent(ctx context.Context, db *database.MongoDB, media *models.Media, workspaceID string, delta int64, reason string) {
+	if delta == 0 {
+		return
+	}
+	event := &models.StorageEvent{
+		ID:           uuid.New().String(),
+		WorkspaceID:  workspaceID,
+		UserID:       media.UserID,
+		MediaID:      media.ID,
+		StorageClass: storageClassOf(media),
+		Delta:        delta,
+		Reason:       reason,
+		At:           time.Now(),
+	}
+	if _, err := db.Collection("storage_events").InsertOne(ctx, event); err != nil {
+		log.Printf("Failed to record storage event %s for media %s: %v", reason, media.ID, err)
+	}
+}
+
+// recordWorkspaceChange moves a media item's bytes between workspaces.
+func recordWorkspaceChange(ctx context.Context, db *database.MongoDB, media *models.Media, from, to string) {
+	if from == to {
+		return
+	}
+	recordStorageEvent(ctx, db, media, from, -media.Size, StorageMoveOut)
+	recordStorageEvent(ctx, db, media, to, media.Size, StorageMoveIn)
+}
@@ -3,21 +3,24 @@ package services
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/quckapp/media-service/internal/database"
 	"github.com/quckapp/media-service/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type TagService struct {
-	db *database.MongoDB
+	db    *database.MongoDB
+	audit *Auditor
 }
 
-func NewTagService(db *database.MongoDB) *TagService {
-	return &TagService{db: db}
+func NewTagService(db *database.MongoDB, audit *Auditor) *TagService {
+	return &TagService{db: db, audit: audit}
 }
 
 func (s *TagService) Create(ctx context.Context, userID string, req *models.CreateTagRequest) (*models.MediaTag, error) {
@@ -128,6 +131,7 @@ func (s *TagService) Delete(ctx context.Context, tagID, userID string) error {
 }
 
 func (s *TagService) TagMedia(ctx context.Context, mediaID string, tagIDs []string) error {
+	var added []string
 	for _, tagID := range tagIDs {
 		mapping := models.MediaTagMapping{
 			ID:      uuid.New().String(),
@@ -135,14 +139,23 @@ func (s *TagService) TagMedia(ctx context.Context, mediaID string, tagIDs []stri
 			TagID:   tagID,
 			AddedAt: time.Now(),
 		}
-		_, _ = s.db.Collection("media_tag_mappings").InsertOne(ctx, mapping)
+		if _, err := s.db.Collection("media_tag_mappings").InsertOne(ctx, mapping); err != nil {
+			// Already tagged (unique mediaId+tagId index)
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+			s.auditTags(ctx, mediaID, AuditTag, added)
+			return err
+		}
 
 		// Increment count
 		_, _ = s.db.Collection("media_tags").UpdateOne(ctx,
 			bson.M{"_id": tagID},
 			bson.M{"$inc": bson.M{"mediaCount": 1}},
 		)
+		added = append(added, tagID)
 	}
+	s.auditTags(ctx, mediaID, AuditTag, added)
 	return nil
 }
 
@@ -158,6 +171,7 @@ func (s *TagService) UntagMedia(ctx context.Context, mediaID, tagID string) erro
 			bson.M{"_id": tagID},
 			bson.M{"$inc": bson.M{"mediaCount": -1}},
 		)
+		s.auditTags(ctx, mediaID, AuditUntag, []string{tagID})
 	}
 	return nil
 }
@@ -222,7 +236,10 @@ func (s *TagService) GetMediaByTag(ctx context.Context, tagID string, limit int6
 }
 
 func (s *TagService) BulkTag(ctx context.Context, mediaIDs, tagIDs []string) error {
+	added := map[string]int{}
+	var err error
 	for _, mediaID := range mediaIDs {
+		var tagged []string
 		for _, tagID := range tagIDs {
 			mapping := models.MediaTagMapping{
 				ID:      uuid.New().String(),
@@ -230,15 +247,41 @@ func (s *TagService) BulkTag(ctx context.Context, mediaIDs, tagIDs []string) err
 				TagID:   tagID,
 				AddedAt: time.Now(),
 			}
-			_, _ = s.db.Collection("media_tag_mappings").InsertOne(ctx, mapping)
+			if _, err = s.db.Collection("media_tag_mappings").InsertOne(ctx, mapping); err != nil {
+				if mongo.IsDuplicateKeyError(err) {
+					err = nil
+					continue
+				}
+				break
+			}
+			added[tagID]++
+			tagged = append(tagged, tagID)
+		}
+		s.auditTags(ctx, mediaID, AuditTag, tagged)
+		if err != nil {
+			break
 		}
 	}
-	// Update counts
-	for _, tagID := range tagIDs {
+	// Update counts, including for what was added before a failure
+	for tagID, n := range added {
 		_, _ = s.db.Collection("media_tags").UpdateOne(ctx,
 			bson.M{"_id": tagID},
-			bson.M{"$inc": bson.M{"mediaCount": len(mediaIDs)}},
+			bson.M{"$inc": bson.M{"mediaCount": n}},
 		)
 	}
-	return nil
+	return err
+}
+
+func (s *TagService) auditTags(ctx context.Context, mediaID, action string, tagIDs []string) {
+	if len(tagIDs) == 0 {
+		return
+	}
+	entry := mediaActivity(auditTarget(ctx, mediaID), action)
+	tags := map[string]string{"tagIds": strings.Join(tagIDs, ",")}
+	if action == AuditUntag {
+		entry.Before = tags
+	} else {
+		entry.After = tags
+	}
+	s.audit.Record(ctx, entry)
 }
@@ -7,9 +7,11 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/events"
 	"github.com/quckapp/media-service/internal/models"
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -17,10 +19,12 @@ type TrashService struct {
 	db      *database.MongoDB
 	redis   *redis.Client
 	storage *S3Storage
+	audit   *Auditor
+	events  *events.Publisher
 }
 
-func NewTrashService(db *database.MongoDB, redis *redis.Client, storage *S3Storage) *TrashService {
-	return &TrashService{db: db, redis: redis, storage: storage}
+func NewTrashService(db *database.MongoDB, redis *redis.Client, storage *S3Storage, audit *Auditor, publisher *events.Publisher) *TrashService {
+	return &TrashService{db: db, redis: redis, storage: storage, audit: audit, events: publisher}
 }
 
 func (s *TrashService) MoveToTrash(ctx context.Context, mediaID, userID string) error {
@@ -55,6 +59,11 @@ func (s *TrashService) MoveToTrash(ctx context.Context, mediaID, userID string)
 		return err
 	}
 
+	entry := mediaActivity(&media, AuditTrash)
+	entry.UserID = userID
+	entry.After = map[string]string{"trashId": trashed.ID, "expiresAt": trashed.ExpiresAt.Format(time.RFC3339)}
+	s.audit.Record(ctx, entry)
+
 	// Invalidate cache
 	s.redis.Del(ctx, fmt.Sprintf("media:%s", mediaID))
 	return nil
@@ -76,8 +85,21 @@ func (s *TrashService) RestoreFromTrash(ctx context.Context, trashID, userID str
 	}
 
 	// Remove from trash
-	_, err = s.db.Collection("media_trash").DeleteOne(ctx, bson.M{"_id": trashID})
-	return err
+	err = s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.db.Collection("media_trash").DeleteOne(ctx, bson.M{"_id": trashID}); err != nil {
+			return err
+		}
+		return publishMediaDeleted(ctx, s.events, &trashed.OriginalDoc)
+	})
+	if err != nil {
+		return err
+	}
+
+	entry := mediaActivity(&trashed.OriginalDoc, AuditRestore)
+	entry.UserID = userID
+	entry.Before = map[string]string{"trashId": trashID}
+	s.audit.Record(ctx, entry)
+	return nil
 }
 
 func (s *TrashService) GetTrash(ctx context.Context, userID string, limit int64) ([]models.TrashedMedia, error) {
@@ -111,7 +133,13 @@ func (s *TrashService) PermanentDelete(ctx context.Context, trashID, userID stri
 
 	// Remove from trash
 	_, err = s.db.Collection("media_trash").DeleteOne(ctx, bson.M{"_id": trashID})
-	return err
+	if err != nil {
+		return err
+	}
+	media := trashed.OriginalDoc
+	recordStorageEvent(ctx, s.db, &media, media.Metadata["workspaceId"], -media.Size, StorageDelete)
+	s.recordPermanentDelete(ctx, &trashed)
+	return nil
 }
 
 func (s *TrashService) EmptyTrash(ctx context.Context, userID string) (int64, error) {
@@ -133,9 +161,39 @@ func (s *TrashService) EmptyTrash(ctx context.Context, userID string) (int64, er
 	}
 
 	// Remove all from trash
-	result, err := s.db.Collection("media_trash").DeleteMany(ctx, bson.M{"userId": userID})
+	ids := make([]string, len(trashed))
+	for i, t := range trashed {
+		ids[i] = t.ID
+	}
+	var result *mongo.DeleteResult
+	err = s.db.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = s.db.Collection("media_trash").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return err
+		}
+		for i := range trashed {
+			if err := publishMediaDeleted(ctx, s.events, &trashed[i].OriginalDoc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
+	for i := range trashed {
+		media := trashed[i].OriginalDoc
+		recordStorageEvent(ctx, s.db, &media, media.Metadata["workspaceId"], -media.Size, StorageDelete)
+		s.recordPermanentDelete(ctx, &trashed[i])
+	}
 	return result.DeletedCount, nil
 }
+
+func (s *TrashService) recordPermanentDelete(ctx context.Context, trashed *models.TrashedMedia) {
+	entry := mediaActivity(&trashed.OriginalDoc, AuditDelete)
+	entry.UserID = trashed.UserID
+	entry.Details = "permanently deleted from trash"
+	entry.Before = map[string]string{"filename": trashed.OriginalDoc.Filename, "s3Key": trashed.OriginalDoc.S3Key}
+	s.audit.Record(ctx, entry)
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,16 +16,25 @@ import (
 type VersionService struct {
 	db      *database.MongoDB
 	storage *S3Storage
+	audit   *Auditor
 }
 
-func NewVersionService(db *database.MongoDB, storage *S3Storage) *VersionService {
-	return &VersionService{db: db, storage: storage}
+func NewVersionService(db *database.MongoDB, storage *S3Storage, audit *Auditor) *VersionService {
+	return &VersionService{db: db, storage: storage, audit: audit}
 }
 
 func (s *VersionService) CreateVersion(ctx context.Context, mediaID, userID string, req *models.CreateVersionRequest) (*models.MediaVersion, error) {
+	media, err := s.media(ctx, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireEditor(ctx, s.db, media, userID); err != nil {
+		return nil, err
+	}
+
 	// Get current max version
 	var latest models.MediaVersion
-	err := s.db.Collection("media_versions").FindOne(ctx,
+	err = s.db.Collection("media_versions").FindOne(ctx,
 		bson.M{"mediaId": mediaID},
 		options.FindOne().SetSort(bson.M{"version": -1}),
 	).Decode(&latest)
@@ -35,6 +45,10 @@ func (s *VersionService) CreateVersion(ctx context.Context, mediaID, userID stri
 	}
 
 	s3Key := fmt.Sprintf("media/%s/%s/v%d/%s", userID, mediaID, nextVersion, req.Filename)
+	encryption, err := newMediaEncryption(ctx, s.db, s.storage, media.Metadata["workspaceId"])
+	if err != nil {
+		return nil, err
+	}
 
 	version := &models.MediaVersion{
 		ID:         uuid.New().String(),
@@ -47,12 +61,23 @@ func (s *VersionService) CreateVersion(ctx context.Context, mediaID, userID stri
 		UploadedBy: userID,
 		Comment:    req.Comment,
 		CreatedAt:  time.Now(),
+		Encryption: encryption,
 	}
 
 	_, err = s.db.Collection("media_versions").InsertOne(ctx, version)
 	if err != nil {
 		return nil, err
 	}
+	version.UploadURL, err = s.storage.MediaUploadURL(versionContent(version), 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	recordStorageEvent(ctx, s.db, media, media.Metadata["workspaceId"], version.Size, StorageVersionCreate)
+
+	entry := mediaActivity(media, AuditVersionCreate)
+	entry.UserID = userID
+	entry.After = map[string]string{"versionId": version.ID, "version": strconv.Itoa(version.Version), "filename": version.Filename}
+	s.audit.Record(ctx, entry)
 	return version, nil
 }
 
@@ -73,7 +98,7 @@ func (s *VersionService) GetVersions(ctx context.Context, mediaID string) ([]mod
 
 	// Generate signed URLs
 	for i := range versions {
-		versions[i].URL, _ = s.storage.GetPresignedDownloadURL(versions[i].S3Key, time.Hour)
+		versions[i].URL, _ = s.storage.MediaURL(versionContent(&versions[i]), time.Hour)
 	}
 
 	return versions, nil
@@ -86,7 +111,7 @@ func (s *VersionService) GetVersion(ctx context.Context, versionID string) (*mod
 		return nil, err
 	}
 
-	version.URL, _ = s.storage.GetPresignedDownloadURL(version.S3Key, time.Hour)
+	version.URL, _ = s.storage.MediaURL(versionContent(&version), time.Hour)
 	return &version, nil
 }
 
@@ -103,7 +128,20 @@ func (s *VersionService) DeleteVersion(ctx context.Context, versionID, userID st
 	_ = s.storage.Delete(version.S3Key)
 
 	_, err = s.db.Collection("media_versions").DeleteOne(ctx, bson.M{"_id": versionID})
-	return err
+	if err != nil {
+		return err
+	}
+	target := auditTarget(ctx, version.MediaID)
+	if media, err := s.media(ctx, version.MediaID); err == nil {
+		recordStorageEvent(ctx, s.db, media, media.Metadata["workspaceId"], -version.Size, StorageVersionDelete)
+		target = media
+	}
+
+	entry := mediaActivity(target, AuditVersionDelete)
+	entry.UserID = userID
+	entry.Before = map[string]string{"versionId": version.ID, "version": strconv.Itoa(version.Version), "filename": version.Filename}
+	s.audit.Record(ctx, entry)
+	return nil
 }
 
 func (s *VersionService) RestoreVersion(ctx context.Context, versionID, userID string) error {
@@ -111,17 +149,63 @@ func (s *VersionService) RestoreVersion(ctx context.Context, versionID, userID s
 	if err != nil {
 		return err
 	}
+	media, err := s.media(ctx, version.MediaID)
+	if err != nil {
+		return err
+	}
+	if err := requireEditor(ctx, s.db, media, userID); err != nil {
+		return err
+	}
 
-	// Update the main media record to point to this version
-	_, err = s.db.Collection("media").UpdateOne(ctx,
-		bson.M{"_id": version.MediaID},
-		bson.M{"$set": bson.M{
-			"filename":  version.Filename,
-			"mimeType":  version.MimeType,
-			"size":      version.Size,
-			"s3Key":     version.S3Key,
-			"updatedAt": time.Now(),
-		}},
-	)
-	return err
+	// Update the main media record to point to this version, which is
+	// decrypted with its own data key, if any
+	set := bson.M{
+		"filename":  version.Filename,
+		"mimeType":  version.MimeType,
+		"size":      version.Size,
+		"s3Key":     version.S3Key,
+		"updatedAt": time.Now(),
+	}
+	update := bson.M{"$set": set}
+	if version.Encryption != nil {
+		set["encryption"] = version.Encryption
+	} else {
+		update["$unset"] = bson.M{"encryption": ""}
+	}
+	_, err = s.db.Collection("media").UpdateOne(ctx, bson.M{"_id": version.MediaID}, update)
+	if err != nil {
+		return err
+	}
+	// Keep the media's ledger total equal to its current size
+	recordStorageEvent(ctx, s.db, media, media.Metadata["workspaceId"], version.Size-media.Size, StorageRestore)
+
+	entry := mediaActivity(media, AuditVersionRestore)
+	entry.UserID = userID
+	entry.Before = map[string]string{"filename": media.Filename, "s3Key": media.S3Key}
+	entry.After = map[string]string{"filename": version.Filename, "s3Key": version.S3Key, "version": strconv.Itoa(version.Version)}
+	s.audit.Record(ctx, entry)
+	return nil
+}
+
+func (s *VersionService) media(ctx context.Context, mediaID string) (*models.Media, error) {
+	var media models.Media
+	err := s.db.Collection("media").FindOne(ctx, bson.M{"_id": mediaID}).Decode(&media)
+	if err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// versionContent presents a version as media for storage, which signs
+// content URLs for it under the version's ID.
+func versionContent(v *models.MediaVersion) *models.Media {
+	return &models.Media{
+		ID:         v.ID,
+		Filename:   v.Filename,
+		MimeType:   v.MimeType,
+		Size:       v.Size,
+		S3Key:      v.S3Key,
+		Encryption: v.Encryption,
+		UpdatedAt:  v.CreatedAt,
+	}
 }
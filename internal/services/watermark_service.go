@@ -39,6 +39,15 @@ func (s *WatermarkService) Upload(ctx context.Context, userID string, req *model
 	return watermark, nil
 }
 
+func (s *WatermarkService) GetByID(ctx context.Context, watermarkID string) (*models.Watermark, error) {
+	var watermark models.Watermark
+	err := s.db.Collection("watermarks").FindOne(ctx, bson.M{"_id": watermarkID}).Decode(&watermark)
+	if err != nil {
+		return nil, err
+	}
+	return &watermark, nil
+}
+
 func (s *WatermarkService) List(ctx context.Context, workspaceID string) ([]models.Watermark, error) {
 	cursor, err := s.db.Collection("watermarks").Find(ctx,
 		bson.M{"workspaceId": workspaceID},
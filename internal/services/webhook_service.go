@@ -0,0 +1,591 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/quckapp/media-service/internal/database"
+	"github.com/quckapp/media-service/internal/events"
+	"github.com/quckapp/media-service/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	webhookPending   = "pending"
+	webhookSucceeded = "succeeded"
+	webhookFailed    = "failed"
+
+	webhookInterval    = 2 * time.Second
+	webhookBatchSize   = 20
+	webhookLease       = time.Minute
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 8
+	webhookBaseDelay   = 30 * time.Second
+	// Attempts beyond this are dropped from the delivery log
+	webhookLogSize      = 20
+	webhookResponseSize = 1024
+)
+
+// Headers sent with every webhook request. The signature is
+// "t=<timestamp>,v1=<hex HMAC-SHA256 of "<timestamp>.<body>">" keyed with
+// the subscription secret; receivers should reject stale timestamps.
+const (
+	WebhookEventHeader     = "X-QuckApp-Event"
+	WebhookDeliveryHeader  = "X-QuckApp-Delivery"
+	WebhookTimestampHeader = "X-QuckApp-Timestamp"
+	WebhookSignatureHeader = "X-QuckApp-Signature"
+)
+
+// WebhookService manages per-workspace webhook subscriptions and delivers
+// domain events to them. Events arrive through Sink, are stored as one
+// delivery per matching subscription and are sent by Run with retries.
+type WebhookService struct {
+	db     *database.MongoDB
+	policy *AccessPolicy
+	client *http.Client
+	wake   chan struct{}
+}
+
+// NewWebhookService refuses to deliver to loopback, private and link-local
+// addresses unless allowPrivate is set, so subscriptions can't be used to
+// reach internal services.
+func NewWebhookService(db *database.MongoDB, policy *AccessPolicy, allowPrivate bool) *WebhookService {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = rejectPrivateAddr
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &WebhookService{
+		db:     db,
+		policy: policy,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   webhookTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+func rejectPrivateAddr(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("webhook url must be an absolute http(s) url")
+	}
+	return nil
+}
+
+func validateWebhookEvents(types []string) error {
+	for _, t := range types {
+		if t == "" || strings.Count(t, "*") > 1 || (strings.Contains(t, "*") && !strings.HasSuffix(t, ".*")) {
+			return fmt.Errorf("invalid event filter %q", t)
+		}
+	}
+	return nil
+}
+
+// webhookMatches reports whether a subscription's filter accepts eventType.
+// Filters are exact types or a domain wildcard such as "media.*"; no
+// filter accepts everything.
+func webhookMatches(filter []string, eventType string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		if f == eventType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(f, "*"); ok && strings.HasPrefix(eventType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SignWebhook returns the signature header value for body sent at ts.
+func SignWebhook(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", ts)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (s *WebhookService) Create(ctx context.Context, userID string, req *models.CreateWebhookRequest) (*models.WebhookSubscription, error) {
+	if err := validateWebhookURL(req.URL); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookEvents(req.Events); err != nil {
+		return nil, err
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+	eventTypes := req.Events
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	webhook := &models.WebhookSubscription{
+		ID:          uuid.New().String(),
+		WorkspaceID: req.WorkspaceID,
+		URL:         req.URL,
+		Events:      eventTypes,
+		Secret:      secret,
+		Description: req.Description,
+		Active:      true,
+		CreatedBy:   userID,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	_, err = s.db.Collection("webhooks").InsertOne(ctx, webhook)
+	if err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) List(ctx context.Context, workspaceID string) ([]models.WebhookSubscription, error) {
+	cursor, err := s.db.Collection("webhooks").Find(ctx,
+		bson.M{"workspaceId": workspaceID},
+		options.Find().SetSort(bson.M{"createdAt": -1}).SetProjection(bson.M{"secret": 0}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var webhooks []models.WebhookSubscription
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (s *WebhookService) GetByID(ctx context.Context, webhookID string) (*models.WebhookSubscription, error) {
+	var webhook models.WebhookSubscription
+	err := s.db.Collection("webhooks").FindOne(ctx, bson.M{"_id": webhookID},
+		options.FindOne().SetProjection(bson.M{"secret": 0}),
+	).Decode(&webhook)
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// Get returns a subscription to an admin of its workspace.
+func (s *WebhookService) Get(ctx context.Context, webhookID string, p *Principal) (*models.WebhookSubscription, error) {
+	return s.getOwned(ctx, webhookID, p)
+}
+
+// getOwned loads a subscription p may manage: webhooks belong to their
+// workspace, so any of its admins may, not only whoever created it.
+func (s *WebhookService) getOwned(ctx context.Context, webhookID string, p *Principal) (*models.WebhookSubscription, error) {
+	webhook, err := s.GetByID(ctx, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.policy.RequireRole(ctx, p, webhook.WorkspaceID, RoleAdmin); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) Update(ctx context.Context, webhookID string, p *Principal, req *models.UpdateWebhookRequest) (*models.WebhookSubscription, error) {
+	if _, err := s.getOwned(ctx, webhookID, p); err != nil {
+		return nil, err
+	}
+
+	update := bson.M{"updatedAt": time.Now()}
+	if req.URL != "" {
+		if err := validateWebhookURL(req.URL); err != nil {
+			return nil, err
+		}
+		update["url"] = req.URL
+	}
+	if req.Events != nil {
+		if err := validateWebhookEvents(req.Events); err != nil {
+			return nil, err
+		}
+		update["events"] = req.Events
+	}
+	if req.Description != nil {
+		update["description"] = *req.Description
+	}
+	if req.Active != nil {
+		update["active"] = *req.Active
+	}
+
+	_, err := s.db.Collection("webhooks").UpdateOne(ctx,
+		bson.M{"_id": webhookID},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, webhookID)
+}
+
+// Delete removes the subscription; deliveries still pending for it are
+// dropped when they come due.
+func (s *WebhookService) Delete(ctx context.Context, webhookID string, p *Principal) error {
+	if _, err := s.getOwned(ctx, webhookID, p); err != nil {
+		return err
+	}
+	_, err := s.db.Collection("webhooks").DeleteOne(ctx, bson.M{"_id": webhookID})
+	return err
+}
+
+func (s *WebhookService) ListDeliveries(ctx context.Context, webhookID string, p *Principal, status string, limit int64) ([]models.WebhookDelivery, error) {
+	if _, err := s.getOwned(ctx, webhookID, p); err != nil {
+		return nil, err
+	}
+	filter := bson.M{"subscriptionId": webhookID}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := s.db.Collection("webhook_deliveries").Find(ctx, filter,
+		options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(limit),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var deliveries []models.WebhookDelivery
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+func (s *WebhookService) GetDelivery(ctx context.Context, webhookID, deliveryID string, p *Principal) (*models.WebhookDelivery, error) {
+	if _, err := s.getOwned(ctx, webhookID, p); err != nil {
+		return nil, err
+	}
+	var delivery models.WebhookDelivery
+	err := s.db.Collection("webhook_deliveries").FindOne(ctx,
+		bson.M{"_id": deliveryID, "subscriptionId": webhookID},
+	).Decode(&delivery)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Redeliver queues a delivery to be sent again right away with a fresh
+// retry budget, whatever its current status. Its log is kept.
+func (s *WebhookService) Redeliver(ctx context.Context, webhookID, deliveryID string, p *Principal) (*models.WebhookDelivery, error) {
+	if _, err := s.getOwned(ctx, webhookID, p); err != nil {
+		return nil, err
+	}
+	var delivery models.WebhookDelivery
+	err := s.db.Collection("webhook_deliveries").FindOneAndUpdate(ctx,
+		bson.M{"_id": deliveryID, "subscriptionId": webhookID},
+		bson.M{
+			"$set": bson.M{
+				"status":        webhookPending,
+				"attempts":      0,
+				"nextAttemptAt": time.Now(),
+				"lockedUntil":   time.Time{},
+			},
+			"$unset": bson.M{"deliveredAt": ""},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&delivery)
+	if err != nil {
+		return nil, err
+	}
+	s.notify()
+	return &delivery, nil
+}
+
+func (s *WebhookService) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Sink is an events.Sink that queues a delivery for every active
+// subscription in the event's workspace whose filter matches. Delivery IDs
+// derive from the event and subscription, so a re-sunk batch is a no-op.
+func (s *WebhookService) Sink(ctx context.Context, batch []events.Event) error {
+	byWorkspace := map[string][]events.Event{}
+	for _, event := range batch {
+		if event.WorkspaceID != "" {
+			byWorkspace[event.WorkspaceID] = append(byWorkspace[event.WorkspaceID], event)
+		}
+	}
+	if len(byWorkspace) == 0 {
+		return nil
+	}
+	workspaceIDs := make([]string, 0, len(byWorkspace))
+	for ws := range byWorkspace {
+		workspaceIDs = append(workspaceIDs, ws)
+	}
+
+	cursor, err := s.db.Collection("webhooks").Find(ctx, bson.M{
+		"workspaceId": bson.M{"$in": workspaceIDs},
+		"active":      true,
+	}, options.Find().SetProjection(bson.M{"secret": 0}))
+	if err != nil {
+		return err
+	}
+	var subs []models.WebhookSubscription
+	if err := cursor.All(ctx, &subs); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var docs []interface{}
+	for _, sub := range subs {
+		for _, event := range byWorkspace[sub.WorkspaceID] {
+			if !webhookMatches(sub.Events, event.Type) {
+				continue
+			}
+			payload, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, &models.WebhookDelivery{
+				ID:             event.ID + ":" + sub.ID,
+				SubscriptionID: sub.ID,
+				WorkspaceID:    sub.WorkspaceID,
+				EventID:        event.ID,
+				EventType:      event.Type,
+				Payload:        string(payload),
+				Status:         webhookPending,
+				NextAttemptAt:  now,
+				Log:            []models.WebhookAttempt{},
+				CreatedAt:      now,
+			})
+		}
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	_, err = s.db.Collection("webhook_deliveries").InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil && !onlyDuplicateKeys(err) {
+		return err
+	}
+	s.notify()
+	return nil
+}
+
+func onlyDuplicateKeys(err error) bool {
+	bwe, ok := err.(mongo.BulkWriteException)
+	if !ok || bwe.WriteConcernError != nil {
+		return false
+	}
+	for _, we := range bwe.WriteErrors {
+		if we.Code != 11000 {
+			return false
+		}
+	}
+	return true
+}
+
+// Run sends due deliveries until ctx is cancelled.
+func (s *WebhookService) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := s.dispatchBatch(ctx)
+			if err != nil {
+				log.Printf("Webhook dispatch failed: %v", err)
+			}
+			if err != nil || n < webhookBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// dispatchBatch claims up to webhookBatchSize due deliveries and sends them
+// concurrently. It returns how many were claimed.
+func (s *WebhookService) dispatchBatch(ctx context.Context) (int, error) {
+	coll := s.db.Collection("webhook_deliveries")
+	now := time.Now()
+	due := bson.M{
+		"status":        webhookPending,
+		"nextAttemptAt": bson.M{"$lte": now},
+		"lockedUntil":   bson.M{"$lte": now},
+	}
+	cursor, err := coll.Find(ctx, due,
+		options.Find().SetSort(bson.M{"nextAttemptAt": 1}).SetLimit(webhookBatchSize),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var candidates []models.WebhookDelivery
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return 0, err
+	}
+
+	var claimed []models.WebhookDelivery
+	for _, d := range candidates {
+		filter := bson.M{"_id": d.ID}
+		for k, v := range due {
+			filter[k] = v
+		}
+		res, err := coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"lockedUntil": now.Add(webhookLease)}})
+		if err != nil {
+			return len(claimed), err
+		}
+		if res.ModifiedCount == 1 {
+			claimed = append(claimed, d)
+		}
+	}
+
+	done := make(chan struct{}, len(claimed))
+	for i := range claimed {
+		go func(d *models.WebhookDelivery) {
+			defer func() { done <- struct{}{} }()
+			s.attempt(ctx, d)
+		}(&claimed[i])
+	}
+	for range claimed {
+		<-done
+	}
+	return len(claimed), nil
+}
+
+// attempt sends one delivery and records the outcome. A delivery whose
+// subscription was deleted or deactivated fails without being sent.
+func (s *WebhookService) attempt(ctx context.Context, d *models.WebhookDelivery) {
+	coll := s.db.Collection("webhook_deliveries")
+
+	var sub models.WebhookSubscription
+	err := s.db.Collection("webhooks").FindOne(ctx, bson.M{"_id": d.SubscriptionID}).Decode(&sub)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Printf("Failed to load webhook %s: %v", d.SubscriptionID, err)
+		return
+	}
+	if err == mongo.ErrNoDocuments || !sub.Active {
+		_, err := coll.UpdateOne(ctx, bson.M{"_id": d.ID}, bson.M{"$set": bson.M{
+			"status":      webhookFailed,
+			"lockedUntil": time.Time{},
+		}, "$push": bson.M{"log": bson.M{"$each": []models.WebhookAttempt{{
+			At:    time.Now(),
+			Error: "subscription deleted or inactive",
+		}}, "$slice": -webhookLogSize}}})
+		if err != nil {
+			log.Printf("Failed to update webhook delivery %s: %v", d.ID, err)
+		}
+		return
+	}
+
+	entry := s.send(ctx, &sub, d)
+	attempts := d.Attempts + 1
+	set := bson.M{"attempts": attempts, "lockedUntil": time.Time{}}
+	switch {
+	case entry.Error == "":
+		set["status"] = webhookSucceeded
+		set["deliveredAt"] = entry.At
+	case attempts >= webhookMaxAttempts:
+		set["status"] = webhookFailed
+	default:
+		set["nextAttemptAt"] = time.Now().Add(webhookBackoff(attempts))
+	}
+	_, err = coll.UpdateOne(ctx, bson.M{"_id": d.ID}, bson.M{
+		"$set":  set,
+		"$push": bson.M{"log": bson.M{"$each": []models.WebhookAttempt{entry}, "$slice": -webhookLogSize}},
+	})
+	if err != nil {
+		log.Printf("Failed to update webhook delivery %s: %v", d.ID, err)
+	}
+}
+
+func (s *WebhookService) send(ctx context.Context, sub *models.WebhookSubscription, d *models.WebhookDelivery) models.WebhookAttempt {
+	start := time.Now()
+	entry := models.WebhookAttempt{At: start}
+	body := []byte(d.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	ts := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "QuckApp-Webhooks/1.0")
+	req.Header.Set(WebhookEventHeader, d.EventType)
+	req.Header.Set(WebhookDeliveryHeader, d.ID)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(ts, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(sub.Secret, ts, body))
+
+	resp, err := s.client.Do(req)
+	entry.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseSize))
+	entry.StatusCode = resp.StatusCode
+	entry.ResponseBody = string(respBody)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		entry.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return entry
+}
+
+// webhookBackoff doubles from webhookBaseDelay: 30s, 1m, 2m ... about 32m
+// before the last attempt.
+func webhookBackoff(attempts int) time.Duration {
+	return webhookBaseDelay << (attempts - 1)
+}